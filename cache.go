@@ -0,0 +1,113 @@
+package metakit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CountCache caches total row counts keyed by the signature of the count query, i.e. its
+// WHERE clause and arguments, so repeated counts of the same filter skip the COUNT query.
+// Only totals are cached, never the data rows. It is safe for concurrent use.
+type CountCache struct {
+	mu      sync.Mutex
+	config  CacheConfig
+	entries map[string]countCacheEntry
+	now     func() time.Time
+}
+
+// countCacheEntry is a cached total and the time it expires
+type countCacheEntry struct {
+	total   int64
+	expires time.Time
+}
+
+// NewCountCache creates a count cache that keeps totals for config.TTL and at most config.MaxSize
+// signatures (0 for no limit). A cache whose config is not enabled always counts.
+//
+// Example:
+//
+//	countCache := NewCountCache(CacheConfig{Enabled: true, TTL: time.Minute, MaxSize: 1000})
+//	metadata := NewMetadata().WithCountCache(countCache)
+func NewCountCache(config CacheConfig) *CountCache {
+	return &CountCache{
+		config:  config,
+		entries: make(map[string]countCacheEntry),
+		now:     time.Now,
+	}
+}
+
+// InvalidateCount removes the cached total of the signature, e.g. after writes changing it.
+// Signatures are returned by CountSignature.
+func (c *CountCache) InvalidateCount(signature string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, signature)
+}
+
+// enabled reports whether the cache is set and enabled
+func (c *CountCache) enabled() bool {
+	return c != nil && c.config.Enabled && c.config.TTL > 0
+}
+
+// count returns the cached total of the signature, calling count and caching its result
+// when there is none or it expired. Unknown totals (-1) are not cached.
+func (c *CountCache) count(signature string, count func() (int64, error)) (int64, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[signature]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.total, nil
+	}
+
+	total, err := count()
+	if err != nil || total < 0 {
+		return total, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.config.MaxSize > 0 && len(c.entries) >= c.config.MaxSize {
+		c.evict(now)
+	}
+	c.entries[signature] = countCacheEntry{total: total, expires: now.Add(c.config.TTL)}
+	return total, nil
+}
+
+// evict removes expired entries and, when the cache is still full, the entry expiring first
+func (c *CountCache) evict(now time.Time) {
+	var oldest string
+	for signature, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, signature)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+			oldest = signature
+		}
+	}
+	if len(c.entries) >= c.config.MaxSize {
+		delete(c.entries, oldest)
+	}
+}
+
+// countSignature hashes a count query and its arguments into a cache key
+func countSignature(query string, args []interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s %#v", query, args)))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithCountCache caches the total row count in the count cache and returns the metadata for method chaining.
+// Requests counting the same query and filters within the cache's TTL reuse the cached total.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithFilter("status", FilterEq, "open").WithCountCache(countCache)
+//	err := Paginate(db.Model(&Ticket{}), metadata, &tickets)
+func (m *Metadata) WithCountCache(cache *CountCache) *Metadata {
+	m.CountCache = cache
+	return m
+}
@@ -0,0 +1,92 @@
+package metakit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// countCountQueries counts the COUNT queries executed against db
+func countCountQueries(t *testing.T, db *gorm.DB) *int {
+	var executed int
+	err := db.Callback().Query().After("gorm:query").Register("test:count_queries", func(tx *gorm.DB) {
+		if !tx.DryRun && strings.Contains(tx.Statement.SQL.String(), "count(*)") {
+			executed++
+		}
+	})
+	assert.NoError(t, err)
+	return &executed
+}
+
+func TestCountCache(t *testing.T) {
+	db := setupTestDB(t)
+	executed := countCountQueries(t, db)
+
+	countCache := NewCountCache(CacheConfig{Enabled: true, TTL: time.Minute})
+	now := time.Now()
+	countCache.now = func() time.Time { return now }
+
+	paginate := func(minAge int) *Metadata {
+		metadata := NewMetadata().WithPageSize(2).WithFilter("age", FilterGte, minAge).WithCountCache(countCache)
+		var users []User
+		assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+		return metadata
+	}
+
+	assert.Equal(t, int64(3), paginate(30).TotalRows)
+	assert.Equal(t, 1, *executed)
+
+	// The second identical count within the TTL doesn't hit the database
+	assert.Equal(t, int64(3), paginate(30).TotalRows)
+	assert.Equal(t, 1, *executed)
+
+	// Different filter arguments have their own signature
+	assert.Equal(t, int64(4), paginate(28).TotalRows)
+	assert.Equal(t, 2, *executed)
+
+	// Invalidation and expiry count again
+	signature, err := CountSignature(db.Model(&User{}), NewMetadata().WithFilter("age", FilterGte, 30))
+	assert.NoError(t, err)
+	countCache.InvalidateCount(signature)
+	assert.Equal(t, int64(3), paginate(30).TotalRows)
+	assert.Equal(t, 3, *executed)
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, int64(3), paginate(30).TotalRows)
+	assert.Equal(t, 4, *executed)
+
+	// Disabled caches always count
+	metadata := NewMetadata().WithCountCache(NewCountCache(CacheConfig{TTL: time.Minute}))
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, 6, *executed)
+}
+
+func TestCountCacheMaxSize(t *testing.T) {
+	countCache := NewCountCache(CacheConfig{Enabled: true, TTL: time.Minute, MaxSize: 2})
+	now := time.Now()
+	countCache.now = func() time.Time { return now }
+
+	calls := 0
+	count := func() (int64, error) {
+		calls++
+		return 7, nil
+	}
+
+	for _, signature := range []string{"a", "b", "c"} {
+		now = now.Add(time.Second)
+		_, err := countCache.count(signature, count)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, len(countCache.entries))
+
+	// The entry expiring first was evicted
+	_, _ = countCache.count("a", count)
+	assert.Equal(t, 4, calls)
+	_, _ = countCache.count("c", count)
+	assert.Equal(t, 4, calls)
+}
@@ -0,0 +1,403 @@
+package metakit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// coerceCursorValue converts a decoded cursor value to the expected kind of the cursor field.
+// It returns ErrCursorTypeMismatch when the value cannot represent that kind.
+// reflect.Invalid disables the check and returns the value unchanged.
+func coerceCursorValue(value interface{}, kind reflect.Kind) (interface{}, error) {
+	mismatch := fmt.Errorf("%w: expected %v, got %T", ErrCursorTypeMismatch, kind, value)
+
+	switch kind {
+	case reflect.Invalid:
+		return value, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch v := value.(type) {
+		case int64:
+			if v >= 0 {
+				return uint64(v), nil
+			}
+		case string:
+			if u, err := strconv.ParseUint(v, 10, 64); err == nil {
+				return u, nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch v := value.(type) {
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+	case reflect.String:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case reflect.Bool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+	default:
+		return value, nil
+	}
+
+	return nil, mismatch
+}
+
+// cursorState is the cursor payload used when page metadata or extra data travels with the cursor
+type cursorState struct {
+	Value    json.RawMessage `json:"value"`
+	PageSize int             `json:"page_size"`
+	Field    string          `json:"field"`
+	Order    string          `json:"order"`
+	Extra    map[string]any  `json:"extra,omitempty"`
+}
+
+// WithCursorSecret signs generated cursors with an HMAC-SHA256 of the secret and returns the metadata
+// for method chaining. Incoming cursors must carry a valid signature, so clients cannot forge or alter them.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("id").WithCursorSecret([]byte(os.Getenv("CURSOR_SECRET")))
+func (m *Metadata) WithCursorSecret(secret []byte) *Metadata {
+	m.CursorSecret = secret
+	return m
+}
+
+// WithCursorState makes generated cursors carry the page size, cursor field and cursor order
+// and returns the metadata for method chaining. Requests resuming from such a cursor don't need
+// to repeat these parameters, and requests changing them mid-traversal are rejected.
+// A page size left at its default adopts the cursor's page size.
+// Combine with WithCursorSecret to protect the state from tampering.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("id").WithPageSize(25).WithCursorState(true)
+//	// next request: NewMetadata().WithCursorState(true).WithCursor(metadata.Cursor) pages by 25 on id
+func (m *Metadata) WithCursorState(enabled bool) *Metadata {
+	m.CursorState = enabled
+	return m
+}
+
+// WithCursorExtra attaches arbitrary data to generated cursors and returns the metadata for method
+// chaining, e.g. a snapshot of the filters or a hash of the query. The data is JSON-encoded into the
+// cursor, signed along with it when a cursor secret is set, and decoded back into CursorExtra when
+// the next request resumes from the cursor. Decoded numbers are float64, as with encoding/json.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("id").WithCursorSecret(secret).
+//	  WithCursorExtra(map[string]any{"filters": filterHash})
+//	// next request: NewMetadata().WithCursorField("id").WithCursorSecret(secret).WithCursor(metadata.Cursor)
+//	// after ValidateAndSetDefaults, m.CursorExtra["filters"] == filterHash
+func (m *Metadata) WithCursorExtra(extra map[string]any) *Metadata {
+	m.CursorExtra = extra
+	return m
+}
+
+// WithHideCursorKeys removes the key columns that cursor pages add to SelectedFields from the rows
+// afterwards and returns the metadata for method chaining. Cursor pages always select the cursor
+// field, the tie-break column and the primary key to build the next cursor; with this option, rows
+// scanned into maps, e.g. by PaginateJSON, hold the requested fields only. Struct rows keep them.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("id").WithFields("name").WithHideCursorKeys(true)
+//	data, err := PaginateJSON(db.Model(&User{}), metadata)
+//	// data == `[{"name":"..."},...]`, metadata.Cursor continues after the last user
+func (m *Metadata) WithHideCursorKeys(enabled bool) *Metadata {
+	m.HideCursorKeys = enabled
+	return m
+}
+
+// WithCursorTieBreak sets a unique column that orders rows sharing a cursor value and returns the
+// metadata for method chaining. Rows are ordered by the cursor field, then the tie-break column,
+// cursors encode both values of the last row, and the keyset condition compares them as a pair.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("created_at").WithCursorTieBreak("id")
+//	// WHERE (created_at, id) > (?, ?) ORDER BY created_at asc, id asc
+func (m *Metadata) WithCursorTieBreak(field string) *Metadata {
+	m.CursorTieBreak = field
+	return m
+}
+
+// WithCursorTieBreakOrder sets the order of the tie-break column and returns the metadata for
+// method chaining. Valid values are "asc" or "desc"; an empty order follows the cursor order.
+// When the orders differ, the keyset condition expands into an OR chain respecting each direction.
+//
+// Example:
+//
+//	metadata := NewMetadata().
+//	  WithCursorField("priority").WithCursorOrder("desc").
+//	  WithCursorTieBreak("created_at").WithCursorTieBreakOrder("asc")
+//	// WHERE priority < ? OR (priority = ? AND created_at > ?) ORDER BY priority desc, created_at asc
+func (m *Metadata) WithCursorTieBreakOrder(order string) *Metadata {
+	m.CursorTieBreakOrder = order
+	return m
+}
+
+// cursorDirections returns the normalized orders of the cursor field and the tie-break column
+func (m *Metadata) cursorDirections() (string, string) {
+	cursorOrder, ok := normalizeDirection(m.CursorOrder)
+	if !ok || cursorOrder == "" {
+		cursorOrder = "asc"
+	}
+	tieBreakOrder, ok := normalizeDirection(m.CursorTieBreakOrder)
+	if !ok || tieBreakOrder == "" {
+		tieBreakOrder = cursorOrder
+	}
+	return cursorOrder, tieBreakOrder
+}
+
+// cursorOrderColumns returns the ORDER BY column list of cursor mode, including the tie-break
+// column, and the direction of its last column. Backward pages flip the direction of every key.
+func (m *Metadata) cursorOrderColumns() (string, string) {
+	return m.orderColumns(m.CursorField, m.CursorTieBreak, m.backward())
+}
+
+// orderColumns returns the ORDER BY column list of the cursor field and tie-break column in the
+// cursor directions, each flipped when reversed, and the direction of the last column
+func (m *Metadata) orderColumns(field, tieBreak string, reversed bool) (string, string) {
+	cursorOrder, tieBreakOrder := m.cursorDirections()
+	if reversed {
+		cursorOrder, tieBreakOrder = reverseDirection(cursorOrder), reverseDirection(tieBreakOrder)
+	}
+	if tieBreak == "" {
+		return field, cursorOrder
+	}
+	return fmt.Sprintf("%s %s, %s", field, cursorOrder, tieBreak), tieBreakOrder
+}
+
+// reverseDirection returns the opposite of a normalized sort direction
+func reverseDirection(direction string) string {
+	if direction == "desc" {
+		return "asc"
+	}
+	return "desc"
+}
+
+// backward reports whether the page is fetched before a Before cursor alone, i.e. a previous page.
+// Its rows are queried in reversed key order, so that the limit keeps the rows closest to the
+// cursor, and reversed back into the order of the forward pages.
+func (m *Metadata) backward() bool {
+	return m.Before != "" && m.Cursor == "" && m.After == ""
+}
+
+// cursorSelection returns the fields to select on a cursor page: SelectedFields with the cursor field,
+// the tie-break column and the primary key column pk added when the selection leaves them out, so that
+// the next cursor can be read from the rows. The added columns are returned as well.
+func (m *Metadata) cursorSelection(pk string) ([]string, []string) {
+	fields := m.SelectedFields
+	if !m.IsCursorBased() || len(fields) == 0 || fields[0] == "*" {
+		return fields, nil
+	}
+
+	fields = slices.Clone(fields)
+	var added []string
+	for _, column := range []string{m.CursorField, m.CursorTieBreak, pk} {
+		if column != "" && !selectsColumn(fields, column) {
+			fields = append(fields, column)
+			added = append(added, column)
+		}
+	}
+	return fields, added
+}
+
+// selectsColumn reports whether the selected fields include the column, directly, by its unqualified
+// name when either side is unqualified, or through a wildcard
+func selectsColumn(fields []string, column string) bool {
+	table, _, qualified := strings.Cut(column, ".")
+	for _, field := range fields {
+		switch {
+		case field == "*" || field == column:
+			return true
+		case strings.HasSuffix(field, ".*"):
+			if !qualified || field == table+".*" {
+				return true
+			}
+		case !qualified || !strings.Contains(field, "."):
+			if unqualifiedColumn(field) == unqualifiedColumn(column) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cursorKey splits a decoded cursor into the cursor field value and, with a tie-break column, its value
+func (m *Metadata) cursorKey(value interface{}) (interface{}, interface{}, error) {
+	if m.CursorTieBreak == "" {
+		value, err := coerceCursorValue(value, m.CursorFieldType)
+		return value, nil, err
+	}
+
+	pair, ok := value.([]interface{})
+	if !ok || len(pair) != 2 {
+		return nil, nil, fmt.Errorf("%w: expected a cursor value and a tie-break value", ErrCursorInvalid)
+	}
+	for i := range pair {
+		number, err := jsonNumberValue(pair[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrCursorInvalid, err)
+		}
+		pair[i] = number
+	}
+	first, err := coerceCursorValue(pair[0], m.CursorFieldType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return first, pair[1], nil
+}
+
+// encodeCursorValue encodes the cursor value, adding the page state, extra data and signature when enabled
+func (m *Metadata) encodeCursorValue(value interface{}) string {
+	var payload interface{} = value
+	if m.CursorState || len(m.CursorExtra) > 0 {
+		data, err := json.Marshal(value)
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprintf("%v", value))
+		}
+		payload = cursorState{Value: data, PageSize: m.PageSize, Field: m.CursorField, Order: m.CursorOrder, Extra: m.CursorExtra}
+	}
+
+	cursor := encodeCursor(payload)
+	if len(m.CursorSecret) > 0 {
+		cursor += "." + signCursor(m.CursorSecret, cursor)
+	}
+	return cursor
+}
+
+// decodeCursorValue verifies and decodes a cursor, returning its value and, for cursors
+// carrying page metadata or extra data, their state. Errors match ErrCursorInvalid.
+func (m *Metadata) decodeCursorValue(cursor string) (interface{}, *cursorState, error) {
+	if len(m.CursorSecret) > 0 {
+		i := strings.LastIndex(cursor, ".")
+		if i < 0 || !hmac.Equal([]byte(cursor[i+1:]), []byte(signCursor(m.CursorSecret, cursor[:i]))) {
+			return nil, nil, fmt.Errorf("%w: signature mismatch", ErrCursorInvalid)
+		}
+		cursor = cursor[:i]
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrCursorInvalid, err)
+	}
+
+	var state cursorState
+	if err := json.Unmarshal(decoded, &state); err == nil && state.Value != nil && (m.CursorState || state.Extra != nil) {
+		value, err := decodeCursorData(state.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrCursorInvalid, err)
+		}
+		return value, &state, nil
+	}
+
+	value, err := decodeCursorData(decoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrCursorInvalid, err)
+	}
+	return value, nil, nil
+}
+
+// restoreCursorState fills the page size, cursor field and cursor order from the incoming cursor's state,
+// and CursorExtra from its extra data. Settings that conflict with the state are reported as
+// CURSOR_STATE_MISMATCH errors and left unchanged.
+func (m *Metadata) restoreCursorState() []ValidationError {
+	cursor := m.Cursor
+	if cursor == "" {
+		cursor = m.After
+	}
+	if cursor == "" {
+		cursor = m.Before
+	}
+	if cursor == "" {
+		return nil
+	}
+
+	_, state, err := m.decodeCursorValue(cursor)
+	if err != nil || state == nil {
+		return nil
+	}
+	if state.Extra != nil {
+		m.CursorExtra = state.Extra
+	}
+	if !m.CursorState {
+		return nil
+	}
+
+	var errors []ValidationError
+	mismatch := func(field string) {
+		errors = append(errors, ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("%s cannot change while paging with a cursor", field),
+			Code:    "CURSOR_STATE_MISMATCH",
+		})
+	}
+
+	switch m.PageSize {
+	case state.PageSize:
+	case 0, defaultPageSize:
+		m.PageSize = state.PageSize
+	default:
+		mismatch("page_size")
+	}
+
+	switch m.CursorField {
+	case state.Field:
+	case "":
+		m.CursorField = state.Field
+	default:
+		mismatch("cursor_field")
+	}
+
+	switch m.CursorOrder {
+	case state.Order:
+	case "":
+		m.CursorOrder = state.Order
+	default:
+		mismatch("cursor_order")
+	}
+	return errors
+}
+
+// signCursor returns the URL-safe HMAC-SHA256 signature of the cursor
+func signCursor(secret []byte, cursor string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(cursor))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
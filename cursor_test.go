@@ -0,0 +1,529 @@
+package metakit
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestCursorFieldType(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		kind     reflect.Kind
+		expected interface{}
+		mismatch bool
+	}{
+		{"int matches", 42, reflect.Int64, int64(42), false},
+		{"numeric string to int", "42", reflect.Int, int64(42), false},
+		{"int to float", 3, reflect.Float64, float64(3), false},
+		{"string matches", "john", reflect.String, "john", false},
+		{"bool matches", true, reflect.Bool, true, false},
+		{"unchecked", "john", reflect.Invalid, "john", false},
+		{"string for int", "john", reflect.Int64, nil, true},
+		{"int for string", 42, reflect.String, nil, true},
+		{"fraction for int", 1.5, reflect.Int, nil, true},
+		{"negative for uint", -1, reflect.Uint, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetadata().
+				WithCursorField("id").
+				WithCursorFieldType(tt.kind).
+				WithCursor(encodeCursor(tt.value))
+
+			_, args, err := m.GetCursorClause(SQLite)
+			if tt.mismatch {
+				assert.True(t, errors.Is(err, ErrCursorTypeMismatch))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []any{tt.expected}, args)
+		})
+	}
+}
+
+func TestCursorFieldTypePaginate(t *testing.T) {
+	db := setupTestDB(t)
+
+	// A name cursor reused against the id column is caught before querying
+	metadata := NewMetadata().
+		WithCursorField("id").
+		WithCursorFieldType(reflect.Uint).
+		WithCursor(encodeCursor("John Doe"))
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.True(t, errors.Is(err, ErrCursorTypeMismatch))
+
+	metadata.WithCursor(encodeCursor(3))
+	err = Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(4), users[0].ID)
+}
+
+func TestCursorStateResumption(t *testing.T) {
+	db := setupTestDB(t)
+	secret := []byte("test-secret")
+
+	metadata := NewMetadata().
+		WithCursorField("id").
+		WithPageSize(2).
+		WithCursorState(true).
+		WithCursorSecret(secret)
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, 2, len(users))
+	assert.NotEmpty(t, metadata.Cursor)
+
+	// Resume without re-specifying the page size or cursor field
+	next := NewMetadata().WithCursorState(true).WithCursorSecret(secret).WithCursor(metadata.Cursor)
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), next, &users))
+	assert.Equal(t, 2, next.PageSize)
+	assert.Equal(t, "id", next.CursorField)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, uint(3), users[0].ID)
+
+	// Changing the page size mid-traversal is rejected
+	changed := NewMetadata().WithCursorState(true).WithCursorSecret(secret).WithCursor(metadata.Cursor).WithPageSize(3)
+	err := Paginate(db.Model(&User{}), changed, &users)
+	var invalid *InvalidMetadataError
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "CURSOR_STATE_MISMATCH", invalid.Errors[0].Code)
+
+	// Tampered cursors fail signature verification
+	tampered := NewMetadata().WithCursorState(true).WithCursorSecret(secret).
+		WithCursorField("id").
+		WithCursor(encodeCursor(cursorState{Value: []byte("100"), PageSize: 2, Field: "id"}) + ".forged")
+	err = Paginate(db.Model(&User{}), tampered, &users)
+	assert.True(t, errors.Is(err, ErrCursorInvalid))
+}
+
+func TestCursorExtra(t *testing.T) {
+	db := setupTestDB(t)
+	secret := []byte("test-secret")
+	extra := map[string]any{"filters": "status=active", "version": 2}
+
+	metadata := NewMetadata().WithCursorField("id").WithPageSize(2).WithCursorSecret(secret).WithCursorExtra(extra)
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.NotEmpty(t, metadata.Cursor)
+
+	// The extra data is decoded from the cursor and carried into the following cursor
+	next := NewMetadata().WithCursorField("id").WithPageSize(2).WithCursorSecret(secret).WithCursor(metadata.Cursor)
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), next, &users))
+	assert.Equal(t, map[string]any{"filters": "status=active", "version": float64(2)}, next.CursorExtra)
+	assert.Equal(t, uint(3), users[0].ID)
+
+	third := NewMetadata().WithCursorField("id").WithPageSize(2).WithCursorSecret(secret).WithCursor(next.Cursor)
+	third.ValidateAndSetDefaults()
+	assert.Equal(t, "status=active", third.CursorExtra["filters"])
+
+	// Cursors without extra data keep their plain encoding
+	plain := NewMetadata().WithCursorField("id").WithPageSize(2)
+	assert.NoError(t, Paginate(db.Model(&User{}), plain, &users))
+	resumed := NewMetadata().WithCursorField("id").WithCursor(plain.Cursor)
+	resumed.ValidateAndSetDefaults()
+	assert.Nil(t, resumed.CursorExtra)
+
+	// Altered extra data fails the signature check
+	tampered := NewMetadata().WithCursorField("id").WithCursorSecret([]byte("other-secret")).WithCursor(metadata.Cursor)
+	assert.ErrorIs(t, Paginate(db.Model(&User{}), tampered, &users), ErrCursorInvalid)
+	assert.Nil(t, tampered.CursorExtra)
+}
+
+func TestCursorPastLastRow(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithPageSize(2).WithCursorField("id").WithCursor(encodeCursor(100))
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+	assert.False(t, metadata.HasNext)
+	assert.Empty(t, metadata.Cursor)
+	assert.Empty(t, metadata.NextPageToken())
+}
+
+func TestCursorPaginate(t *testing.T) {
+	db := setupTestDB(t)
+
+	var users []User
+	page, err := CursorPaginate(db.Model(&User{}), NewMetadata().WithPageSize(2).WithCursorField("id"), &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.True(t, page.HasMore)
+	assert.NotEmpty(t, page.NextCursor)
+	assert.Empty(t, page.PrevCursor)
+	assert.Nil(t, page.Data)
+
+	// Map destinations are returned as Data
+	var rows []map[string]interface{}
+	metadata := NewMetadata().WithPageSize(2).WithCursorField("id").WithCursor(page.NextCursor)
+	page, err = CursorPaginate(db.Table("users"), metadata, &rows)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(page.Data))
+	assert.True(t, page.HasMore)
+	assert.NotEmpty(t, page.PrevCursor)
+
+	// The previous cursor bounds the rows before the first row of the page
+	users = nil
+	metadata = NewMetadata().WithPageSize(2).WithCursorField("id").WithBefore(page.PrevCursor)
+	_, err = CursorPaginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{1, 2}, []uint{users[0].ID, users[1].ID})
+
+	_, err = CursorPaginate(db.Model(&User{}), NewMetadata(), &users)
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+type tieBreakEvent struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt int64
+}
+
+func TestCursorTieBreak(t *testing.T) {
+	db := setupTestDB(t)
+	assert.NoError(t, db.AutoMigrate(&tieBreakEvent{}))
+
+	// Several rows share a created_at value, and ids are not in created_at order
+	events := []tieBreakEvent{
+		{ID: 1, CreatedAt: 200}, {ID: 2, CreatedAt: 100}, {ID: 3, CreatedAt: 100},
+		{ID: 4, CreatedAt: 100}, {ID: 5, CreatedAt: 200}, {ID: 6, CreatedAt: 100},
+		{ID: 7, CreatedAt: 300},
+	}
+	assert.NoError(t, db.Create(&events).Error)
+
+	var seen []uint
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		metadata := NewMetadata().WithPageSize(2).WithCursorField("created_at").WithCursorTieBreak("id").WithCursor(cursor)
+		var page []tieBreakEvent
+		err := Paginate(db.Model(&tieBreakEvent{}), metadata, &page)
+		assert.NoError(t, err)
+		for _, event := range page {
+			seen = append(seen, event.ID)
+		}
+		if !metadata.HasNext {
+			break
+		}
+		cursor = metadata.Cursor
+	}
+	assert.Equal(t, []uint{2, 3, 4, 6, 1, 5, 7}, seen)
+
+	// The keyset condition compares both columns as a pair
+	metadata := NewMetadata().WithCursorField("created_at").WithCursorTieBreak("id").
+		WithCursor(encodeCursor([]interface{}{100, 4}))
+	clause, args, err := metadata.GetCursorClause(PostgreSQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "(created_at, id) > ($1, $2)", clause)
+	assert.Equal(t, []any{int64(100), int64(4)}, args)
+
+	// Cursors without a tie-break value are rejected
+	metadata = NewMetadata().WithCursorField("created_at").WithCursorTieBreak("id").WithCursor(encodeCursor(100))
+	_, _, err = metadata.GetCursorClause(PostgreSQL)
+	assert.True(t, errors.Is(err, ErrCursorInvalid))
+
+	result := NewMetadata().WithCursorField("created_at").WithCursorTieBreak("id; DROP TABLE users").Validate()
+	assert.False(t, result.IsValid)
+}
+
+type mixedOrderTask struct {
+	ID        uint `gorm:"primarykey"`
+	Priority  int
+	CreatedAt int64
+}
+
+func TestCursorMixedDirections(t *testing.T) {
+	metadata := NewMetadata().WithCursorField("priority").WithCursorOrder("desc").
+		WithCursorTieBreak("created_at").WithCursorTieBreakOrder("asc").
+		WithCursor(encodeCursor([]interface{}{2, 150}))
+	clause, args, err := metadata.GetCursorClause(MySQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "priority < ? OR (priority = ? AND created_at > ?)", clause)
+	assert.Equal(t, []any{int64(2), int64(2), int64(150)}, args)
+
+	// Before bounds reverse both comparisons
+	metadata = NewMetadata().WithCursorField("priority").WithCursorOrder("desc").
+		WithCursorTieBreak("created_at").WithCursorTieBreakOrder("asc").
+		WithBefore(encodeCursor([]interface{}{2, 150}))
+	clause, _, err = metadata.GetCursorClause(PostgreSQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "priority > $1 OR (priority = $2 AND created_at < $3)", clause)
+
+	db := setupTestDB(t)
+	assert.NoError(t, db.AutoMigrate(&mixedOrderTask{}))
+	tasks := []mixedOrderTask{
+		{ID: 1, Priority: 1, CreatedAt: 100}, {ID: 2, Priority: 3, CreatedAt: 300},
+		{ID: 3, Priority: 2, CreatedAt: 200}, {ID: 4, Priority: 3, CreatedAt: 100},
+		{ID: 5, Priority: 2, CreatedAt: 100}, {ID: 6, Priority: 1, CreatedAt: 50},
+		{ID: 7, Priority: 3, CreatedAt: 200}, {ID: 8, Priority: 2, CreatedAt: 300},
+	}
+	assert.NoError(t, db.Create(&tasks).Error)
+
+	paginate := func(filtered bool) []uint {
+		var seen []uint
+		cursor := ""
+		for pages := 0; pages < 10; pages++ {
+			metadata := NewMetadata().WithPageSize(3).
+				WithCursorField("priority").WithCursorOrder("desc").
+				WithCursorTieBreak("created_at").WithCursorTieBreakOrder("asc").
+				WithCursor(cursor)
+			if filtered {
+				metadata.WithFilter("id", FilterNe, 7)
+			}
+			var page []mixedOrderTask
+			assert.NoError(t, Paginate(db.Model(&mixedOrderTask{}), metadata, &page))
+			for _, task := range page {
+				seen = append(seen, task.ID)
+			}
+			if !metadata.HasNext {
+				break
+			}
+			cursor = metadata.Cursor
+		}
+		return seen
+	}
+
+	assert.Equal(t, []uint{4, 7, 2, 5, 3, 8, 6, 1}, paginate(false))
+	// The OR chain stays grouped when combined with filters
+	assert.Equal(t, []uint{4, 2, 5, 3, 8, 6, 1}, paginate(true))
+
+	result := NewMetadata().WithCursorField("priority").WithCursorTieBreak("created_at").WithCursorTieBreakOrder("sideways").Validate()
+	assert.False(t, result.IsValid)
+}
+
+func TestCursorDescendingFeed(t *testing.T) {
+	db := setupTestDB(t)
+
+	// The first page orders newest first without a cursor
+	metadata := NewMetadata().WithPageSize(2).WithCursorField("id").WithCursorOrder("desc")
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, []uint{5, 4}, []uint{users[0].ID, users[1].ID})
+	assert.True(t, metadata.HasNext)
+
+	// The cursor holds the smallest id seen, so the next page continues downward
+	value, err := decodeCursor(metadata.Cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), value)
+
+	users = nil
+	metadata = NewMetadata().WithPageSize(2).WithCursorField("id").WithCursorOrder("desc").WithCursor(metadata.Cursor)
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, []uint{3, 2}, []uint{users[0].ID, users[1].ID})
+
+	users = nil
+	metadata = NewMetadata().WithPageSize(2).WithCursorField("id").WithCursorOrder("desc").WithCursor(metadata.Cursor)
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, []uint{1}, []uint{users[0].ID})
+	assert.False(t, metadata.HasNext)
+	assert.Empty(t, metadata.Cursor)
+}
+
+func TestCursorPaginateT(t *testing.T) {
+	db := setupTestDB(t)
+
+	page, err := CursorPaginateT[User](db.Model(&User{}), NewMetadata().WithPageSize(2).WithCursorField("id"))
+	assert.NoError(t, err)
+	assert.IsType(t, []User{}, page.Data)
+	if assert.Equal(t, 2, len(page.Data)) {
+		assert.Equal(t, User{ID: 1, Name: "John Doe", Email: "john@example.com", Age: 30}, page.Data[0])
+		assert.Equal(t, "Jane Smith", page.Data[1].Name)
+	}
+	assert.True(t, page.HasMore)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// The next page continues after the cursor
+	page, err = CursorPaginateT[User](db.Model(&User{}), NewMetadata().WithPageSize(2).WithCursorField("id").WithCursor(page.NextCursor))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{3, 4}, []uint{page.Data[0].ID, page.Data[1].ID})
+	assert.NotEmpty(t, page.PrevCursor)
+
+	data, err := json.Marshal(page)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"Bob Johnson"`)
+
+	_, err = CursorPaginateT[User](db.Model(&User{}), NewMetadata())
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+type joinCustomer struct {
+	ID        uint `gorm:"primarykey"`
+	Name      string
+	CreatedAt int64
+}
+
+type joinOrder struct {
+	ID         uint `gorm:"primarykey"`
+	CustomerID uint
+	CreatedAt  int64
+}
+
+func TestCursorQualifiedField(t *testing.T) {
+	db := setupTestDB(t)
+	assert.NoError(t, db.AutoMigrate(&joinCustomer{}, &joinOrder{}))
+	assert.NoError(t, db.Create(&[]joinCustomer{{ID: 1, Name: "Ann", CreatedAt: 900}, {ID: 2, Name: "Bob", CreatedAt: 50}}).Error)
+	assert.NoError(t, db.Create(&[]joinOrder{
+		{ID: 1, CustomerID: 1, CreatedAt: 300}, {ID: 2, CustomerID: 2, CreatedAt: 100},
+		{ID: 3, CustomerID: 1, CreatedAt: 500}, {ID: 4, CustomerID: 2, CreatedAt: 200},
+		{ID: 5, CustomerID: 1, CreatedAt: 400},
+	}).Error)
+
+	joined := func() *gorm.DB {
+		return db.Model(&joinOrder{}).Joins("JOIN join_customers ON join_customers.id = join_orders.customer_id")
+	}
+
+	// created_at exists on both tables, so the cursor field is qualified
+	var seen []uint
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		metadata := NewMetadata().WithPageSize(2).WithCursorField("join_orders.created_at").WithCursor(cursor)
+		var page []joinOrder
+		assert.NoError(t, Paginate(joined().Select("join_orders.id, join_orders.customer_id, join_orders.created_at"), metadata, &page))
+		for _, order := range page {
+			seen = append(seen, order.ID)
+		}
+		if !metadata.HasNext {
+			break
+		}
+		cursor = metadata.Cursor
+	}
+	assert.Equal(t, []uint{2, 4, 1, 5, 3}, seen)
+
+	// Map rows are read through the column alias
+	metadata := NewMetadata().WithPageSize(2).WithCursorField("join_orders.created_at").WithCursorOrder("desc")
+	var rows []map[string]interface{}
+	query := joined().Select("join_orders.id, join_orders.created_at AS join_orders_created_at, join_customers.name, join_customers.created_at")
+	page, err := CursorPaginate(query, metadata, &rows)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, encodeCursor(400), page.NextCursor)
+
+	metadata = NewMetadata().WithPageSize(2).WithCursorField("join_orders.created_at").WithCursorOrder("desc").WithCursor(page.NextCursor)
+	rows = nil
+	query = joined().Select("join_orders.id, join_orders.created_at AS join_orders_created_at, join_customers.name, join_customers.created_at")
+	_, err = CursorPaginate(query, metadata, &rows)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, uint(1), rows[0]["id"])
+		assert.Equal(t, uint(4), rows[1]["id"])
+	}
+}
+
+func TestCursorBackwardMixedDirections(t *testing.T) {
+	db := setupTestDB(t)
+	assert.NoError(t, db.AutoMigrate(&mixedOrderTask{}))
+	tasks := []mixedOrderTask{
+		{ID: 1, Priority: 1, CreatedAt: 100}, {ID: 2, Priority: 3, CreatedAt: 300},
+		{ID: 3, Priority: 2, CreatedAt: 200}, {ID: 4, Priority: 3, CreatedAt: 100},
+		{ID: 5, Priority: 2, CreatedAt: 100}, {ID: 6, Priority: 1, CreatedAt: 50},
+		{ID: 7, Priority: 3, CreatedAt: 200}, {ID: 8, Priority: 2, CreatedAt: 300},
+	}
+	assert.NoError(t, db.Create(&tasks).Error)
+
+	newMetadata := func() *Metadata {
+		return NewMetadata().WithPageSize(2).
+			WithCursorField("priority").WithCursorOrder("desc").
+			WithCursorTieBreak("created_at").WithCursorTieBreakOrder("asc")
+	}
+	ids := func(page []mixedOrderTask) []uint {
+		var ids []uint
+		for _, task := range page {
+			ids = append(ids, task.ID)
+		}
+		return ids
+	}
+
+	// Walk forward, keeping each page and the cursor leading back to the page before it
+	var pages [][]uint
+	var prevCursors []string
+	cursor := ""
+	for {
+		var page []mixedOrderTask
+		result, err := CursorPaginate(db.Model(&mixedOrderTask{}), newMetadata().WithCursor(cursor), &page)
+		assert.NoError(t, err)
+		pages = append(pages, ids(page))
+		prevCursors = append(prevCursors, result.PrevCursor)
+		if !result.HasMore {
+			break
+		}
+		cursor = result.NextCursor
+	}
+	assert.Equal(t, [][]uint{{4, 7}, {2, 5}, {3, 8}, {6, 1}}, pages)
+
+	// Walking back from each page returns the previous forward page unchanged
+	for i := len(pages) - 1; i > 0; i-- {
+		var page []mixedOrderTask
+		metadata := newMetadata().WithBefore(prevCursors[i])
+		result, err := CursorPaginate(db.Model(&mixedOrderTask{}), metadata, &page)
+		assert.NoError(t, err)
+		assert.Equal(t, pages[i-1], ids(page), "page %d", i)
+		assert.True(t, result.HasMore)
+		assert.Equal(t, i > 1, metadata.HasPrevious, "page %d", i)
+		if i > 1 {
+			assert.Equal(t, prevCursors[i-1], result.PrevCursor)
+		}
+	}
+
+	// The SQL path flips every key and orders the page forward again
+	metadata := newMetadata().WithBefore(prevCursors[2])
+	query, args, err := metadata.BuildSQL(SQLite, "SELECT * FROM mixed_order_tasks")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM mixed_order_tasks WHERE priority > ? OR (priority = ? AND created_at < ?) "+
+		"ORDER BY priority asc, created_at desc LIMIT ?) AS _page ORDER BY priority desc, created_at asc", query)
+
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	rows, err := sqlDB.Query(query, args...)
+	assert.NoError(t, err)
+	defer rows.Close()
+	var sqlIDs []uint
+	for rows.Next() {
+		var task mixedOrderTask
+		assert.NoError(t, rows.Scan(&task.ID, &task.Priority, &task.CreatedAt))
+		sqlIDs = append(sqlIDs, task.ID)
+	}
+	assert.Equal(t, pages[1], sqlIDs)
+}
+
+func TestCursorSelectedFields(t *testing.T) {
+	db := setupTestDB(t)
+
+	// The cursor field is selected even when the requested fields leave it out
+	metadata := NewMetadata().WithCursorField("age").WithPageSize(2).WithFields("name")
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, []string{"Jane Smith", "Alice Brown"}, []string{users[0].Name, users[1].Name})
+	assert.Equal(t, 28, users[1].Age)
+	assert.NotZero(t, users[1].ID)
+	assert.NotEmpty(t, metadata.Cursor)
+
+	next := NewMetadata().WithCursorField("age").WithPageSize(2).WithFields("name").WithCursor(metadata.Cursor)
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), next, &users))
+	assert.Equal(t, []string{"John Doe", "Charlie Wilson"}, []string{users[0].Name, users[1].Name})
+	assert.Equal(t, []string{"name"}, next.SelectedFields)
+
+	// Map rows keep the added key columns unless they are hidden
+	metadata = NewMetadata().WithCursorField("age").WithPageSize(2).WithFields("name")
+	data, err := PaginateJSON(db.Model(&User{}), metadata)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"name":"Jane Smith","age":25,"id":2},{"name":"Alice Brown","age":28,"id":4}]`, string(data))
+
+	metadata = NewMetadata().WithCursorField("age").WithPageSize(2).WithFields("name").WithHideCursorKeys(true)
+	data, err = PaginateJSON(db.Model(&User{}), metadata)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"name":"Jane Smith"},{"name":"Alice Brown"}]`, string(data))
+
+	value, _, err := metadata.decodeCursorValue(metadata.Cursor)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 28, value)
+}
@@ -0,0 +1,68 @@
+package metakit
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// WithDriftColumn enables drift detection on the column tracking row changes, typically updated_at,
+// and returns the metadata for method chaining. Paginate then returns a DriftToken derived from
+// TotalRows and the column's maximum, and sets Stale when the token sent back by the client
+// (see WithDriftToken) no longer matches, i.e. rows were added, removed or updated between pages.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(2).WithDriftColumn("updated_at").WithDriftToken(r.URL.Query().Get("drift_token"))
+//	err := Paginate(db.Model(&User{}), metadata, &users)
+//	if metadata.Stale {
+//	  // ask the client to reload from the first page
+//	}
+func (m *Metadata) WithDriftColumn(column string) *Metadata {
+	m.DriftColumn = column
+	return m
+}
+
+// WithDriftToken sets the drift token the client received with the previous page and returns the
+// metadata for method chaining
+func (m *Metadata) WithDriftToken(token string) *Metadata {
+	m.DriftToken = token
+	return m
+}
+
+// UpdateDrift computes the drift token of the current data from TotalRows and marker, the maximum
+// of the drift column, sets Stale when a token sent by the client differs from it and replaces
+// DriftToken with it. Paginate calls it when a drift column is set; call it after CountContext
+// in the SQL path.
+//
+// Example:
+//
+//	var maxUpdatedAt sql.NullString
+//	db.QueryRowContext(ctx, "SELECT MAX(updated_at) FROM users").Scan(&maxUpdatedAt)
+//	metadata.UpdateDrift(maxUpdatedAt.String)
+func (m *Metadata) UpdateDrift(marker interface{}) {
+	token := driftToken(m.TotalRows, marker)
+	m.Stale = m.DriftToken != "" && m.DriftToken != token
+	m.DriftToken = token
+}
+
+// driftToken hashes the total and the drift marker into a short token
+func driftToken(total int64, marker interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%v", total, marker)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// driftMarker reads the maximum of the drift column over the filtered query
+func driftMarker(db *gorm.DB, m *Metadata) (string, error) {
+	tx := applyFilters(db.Session(&gorm.Session{}), m).Select(fmt.Sprintf("MAX(%s)", m.DriftColumn))
+	delete(tx.Statement.Clauses, "ORDER BY")
+
+	var marker sql.NullString
+	if err := tx.Row().Scan(&marker); err != nil {
+		return "", err
+	}
+	return marker.String, nil
+}
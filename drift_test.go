@@ -0,0 +1,62 @@
+package metakit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type driftItem struct {
+	ID        uint `gorm:"primarykey"`
+	Name      string
+	UpdatedAt time.Time
+}
+
+func TestDriftToken(t *testing.T) {
+	db := setupTestDB(t)
+	assert.NoError(t, db.AutoMigrate(&driftItem{}))
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, db.Create(&driftItem{Name: "item"}).Error)
+	}
+
+	// The first page returns a token
+	metadata := NewMetadata().WithPageSize(2).WithSort("id").WithDriftColumn("updated_at")
+	var items []driftItem
+	assert.NoError(t, Paginate(db.Model(&driftItem{}), metadata, &items))
+	token := metadata.DriftToken
+	assert.NotEmpty(t, token)
+	assert.False(t, metadata.Stale)
+
+	// Unchanged data keeps the token
+	metadata = NewMetadata().WithPage(2).WithPageSize(2).WithSort("id").WithDriftColumn("updated_at").WithDriftToken(token)
+	items = nil
+	assert.NoError(t, Paginate(db.Model(&driftItem{}), metadata, &items))
+	assert.False(t, metadata.Stale)
+	assert.Equal(t, token, metadata.DriftToken)
+
+	// An insert between pages makes the client's token stale
+	assert.NoError(t, db.Create(&driftItem{Name: "inserted"}).Error)
+	r := httptest.NewRequest(http.MethodGet, "/items?page=2&page_size=2&sort=id&drift_token="+token, nil)
+	metadata, err := FromRequest(r)
+	assert.NoError(t, err)
+	metadata.WithDriftColumn("updated_at")
+	items = nil
+	assert.NoError(t, Paginate(db.Model(&driftItem{}), metadata, &items))
+	assert.True(t, metadata.Stale)
+	assert.NotEqual(t, token, metadata.DriftToken)
+
+	// An update changes the maximum of the drift column without changing the total
+	token = metadata.DriftToken
+	assert.NoError(t, db.Model(&driftItem{}).Where("id = ?", 1).Update("updated_at", time.Now().Add(time.Hour)).Error)
+	metadata = NewMetadata().WithPageSize(2).WithDriftColumn("updated_at").WithDriftToken(token)
+	items = nil
+	assert.NoError(t, Paginate(db.Model(&driftItem{}), metadata, &items))
+	assert.True(t, metadata.Stale)
+
+	result := NewMetadata().WithDriftColumn("updated_at; DROP TABLE users").Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_DRIFT_COLUMN", result.Errors[0].Code)
+}
@@ -0,0 +1,78 @@
+//go:build elasticsearch
+
+package metakit
+
+// ESSearchAfter translates the metadata into the parts of an Elasticsearch search_after query:
+// the sort tuple, the search_after values decoded from the cursor and the page size.
+// The cursor field and tie-break column form the sort tuple, falling back to the sort field
+// outside cursor mode. searchAfter is nil on the first page and for cursors that fail to
+// decode, so validate the metadata first to reject tampered cursors.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("created_at").WithCursorOrder("desc").WithCursorTieBreak("id")
+//	sort, searchAfter, size := ESSearchAfter(metadata)
+//	// sort == []map[string]string{{"created_at": "desc"}, {"id": "desc"}}
+//	body := map[string]interface{}{"sort": sort, "size": size}
+//	if searchAfter != nil {
+//	  body["search_after"] = searchAfter
+//	}
+func ESSearchAfter(m *Metadata) (sort []map[string]string, searchAfter []interface{}, size int) {
+	size = m.GetLimit()
+
+	field, order := m.CursorField, ""
+	if field == "" {
+		field, order = m.Sort, m.SortDirection
+		if direction, ok := normalizeDirection(order); ok && direction != "" {
+			order = direction
+		} else {
+			order = "asc"
+		}
+	} else {
+		order, _ = m.cursorDirections()
+	}
+	if field == "" {
+		return nil, nil, size
+	}
+
+	sort = []map[string]string{{field: order}}
+	if m.CursorField != "" && m.CursorTieBreak != "" {
+		_, tieBreakOrder := m.cursorDirections()
+		sort = append(sort, map[string]string{m.CursorTieBreak: tieBreakOrder})
+	}
+
+	if m.Cursor == "" || m.CursorField == "" {
+		return sort, nil, size
+	}
+	value, _, err := m.decodeCursorValue(m.Cursor)
+	if err != nil {
+		return sort, nil, size
+	}
+	value, tieBreakValue, err := m.cursorKey(value)
+	if err != nil {
+		return sort, nil, size
+	}
+
+	searchAfter = []interface{}{value}
+	if m.CursorTieBreak != "" {
+		searchAfter = append(searchAfter, tieBreakValue)
+	}
+	return sort, searchAfter, size
+}
+
+// ESNextCursor encodes the sort values of the last hit of an Elasticsearch page into the cursor
+// of the next page, readable by ESSearchAfter. Cursor signing and state apply as for Paginate.
+//
+// Example:
+//
+//	hits := response.Hits.Hits
+//	metadata.Cursor = ESNextCursor(metadata, hits[len(hits)-1].Sort)
+func ESNextCursor(m *Metadata, hitSort []interface{}) string {
+	if len(hitSort) == 0 {
+		return ""
+	}
+	if m.CursorTieBreak != "" && len(hitSort) > 1 {
+		return m.encodeCursorValue([]interface{}{hitSort[0], hitSort[1]})
+	}
+	return m.encodeCursorValue(hitSort[0])
+}
@@ -0,0 +1,47 @@
+//go:build elasticsearch
+
+package metakit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestESSearchAfter(t *testing.T) {
+	// First page: sort tuple without search_after
+	metadata := NewMetadata().WithPageSize(25).WithCursorField("created_at").WithCursorOrder("desc").WithCursorTieBreak("id")
+	sort, searchAfter, size := ESSearchAfter(metadata)
+	assert.Equal(t, []map[string]string{{"created_at": "desc"}, {"id": "desc"}}, sort)
+	assert.Nil(t, searchAfter)
+	assert.Equal(t, 25, size)
+
+	// The next cursor carries the sort values of the last hit
+	metadata.Cursor = ESNextCursor(metadata, []interface{}{1700000000000, "doc-42"})
+	sort, searchAfter, _ = ESSearchAfter(metadata)
+	assert.Equal(t, []map[string]string{{"created_at": "desc"}, {"id": "desc"}}, sort)
+	assert.Equal(t, []interface{}{int64(1700000000000), "doc-42"}, searchAfter)
+
+	// Mixed tie-break order and signed single-field cursors
+	metadata = NewMetadata().WithCursorField("priority").WithCursorOrder("desc").
+		WithCursorTieBreak("id").WithCursorTieBreakOrder("asc")
+	sort, _, _ = ESSearchAfter(metadata)
+	assert.Equal(t, []map[string]string{{"priority": "desc"}, {"id": "asc"}}, sort)
+
+	metadata = NewMetadata().WithCursorField("score").WithCursorSecret([]byte("secret"))
+	metadata.Cursor = ESNextCursor(metadata, []interface{}{4.5})
+	sort, searchAfter, _ = ESSearchAfter(metadata)
+	assert.Equal(t, []map[string]string{{"score": "asc"}}, sort)
+	assert.Equal(t, []interface{}{4.5}, searchAfter)
+
+	// Tampered cursors are not used
+	metadata.Cursor = encodeCursor(1.5)
+	_, searchAfter, _ = ESSearchAfter(metadata)
+	assert.Nil(t, searchAfter)
+
+	// Offset metadata maps its sort field
+	sort, searchAfter, size = ESSearchAfter(NewMetadata().WithSort("name").WithSortDirection("DESC"))
+	assert.Equal(t, []map[string]string{{"name": "desc"}}, sort)
+	assert.Nil(t, searchAfter)
+	assert.Equal(t, 10, size)
+}
@@ -0,0 +1,104 @@
+package metakit
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrValidation is returned when the metadata fails validation
+	ErrValidation = errors.New("invalid metadata")
+
+	// ErrCursorInvalid is returned when a cursor cannot be decoded
+	ErrCursorInvalid = errors.New("invalid cursor")
+
+	// ErrCursorTypeMismatch is returned when a cursor value doesn't match the declared cursor field type
+	ErrCursorTypeMismatch = errors.New("cursor type mismatch")
+
+	// ErrUnsupportedDialect is returned when a dialect outside the known set is used
+	ErrUnsupportedDialect = errors.New("unsupported dialect")
+
+	// ErrResultNotSlicePointer is returned when the result to paginate into is not a pointer to a slice
+	ErrResultNotSlicePointer = errors.New("result must be a non-nil pointer to a slice")
+
+	// ErrResultNotStructPointer is returned when the destination of First is not a pointer to a struct
+	ErrResultNotStructPointer = errors.New("destination must be a non-nil pointer to a struct")
+)
+
+// InvalidMetadataError carries the validation errors of rejected metadata.
+// It matches ErrValidation with errors.Is.
+//
+// Example:
+//
+//	var invalid *InvalidMetadataError
+//	if errors.As(err, &invalid) {
+//	  for _, e := range invalid.Errors {
+//	    fmt.Println(e.Field, e.Code)
+//	  }
+//	}
+type InvalidMetadataError struct {
+	Errors []ValidationError
+}
+
+// Error implements the error interface
+func (e *InvalidMetadataError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrValidation, e.Errors)
+}
+
+// Unwrap allows errors.Is(err, ErrValidation)
+func (e *InvalidMetadataError) Unwrap() error {
+	return ErrValidation
+}
+
+// Err returns an *InvalidMetadataError for a failed validation, or nil when the result is valid
+func (r ValidationResult) Err() error {
+	if r.IsValid {
+		return nil
+	}
+	return &InvalidMetadataError{Errors: r.Errors}
+}
+
+// NewValidationError returns a validation error for the field, e.g. from a custom validator,
+// with a human-readable message and a machine-readable code
+//
+// Example:
+//
+//	if metadata.PageSize > 20 && !premium {
+//	  result.Errors = append(result.Errors, NewValidationError("page_size", "Upgrade for larger pages", "PAGE_SIZE_PREMIUM"))
+//	}
+func NewValidationError(field, message, code string) ValidationError {
+	return ValidationError{Field: field, Message: message, Code: code}
+}
+
+// Has reports whether the result contains an error with the code
+//
+// Example:
+//
+//	if result := metadata.Validate(); result.Has("PAGE_SIZE_TOO_LARGE") {
+//	  http.Error(w, "page too large", http.StatusRequestEntityTooLarge)
+//	}
+func (r ValidationResult) Has(code string) bool {
+	for _, err := range r.Errors {
+		if err.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldErrors returns the errors of the field in the order they were reported, or nil when it has none
+//
+// Example:
+//
+//	for _, err := range metadata.Validate().FieldErrors("page_size") {
+//	  fmt.Println(err.Code)
+//	}
+func (r ValidationResult) FieldErrors(field string) []ValidationError {
+	var fieldErrors []ValidationError
+	for _, err := range r.Errors {
+		if err.Field == field {
+			fieldErrors = append(fieldErrors, err)
+		}
+	}
+	return fieldErrors
+}
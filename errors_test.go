@@ -0,0 +1,124 @@
+package metakit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidationErrorTypes(t *testing.T) {
+	db := setupTestDB(t)
+
+	var users []User
+	err := Paginate(db.Model(&User{}), NewMetadata().WithPageSize(500), &users)
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	var invalid *InvalidMetadataError
+	if assert.True(t, errors.As(err, &invalid)) {
+		assert.Equal(t, 1, len(invalid.Errors))
+		assert.Equal(t, "PAGE_SIZE_TOO_LARGE", invalid.Errors[0].Code)
+	}
+
+	err = PaginateWithCount(db.Model(&User{}), db.Model(&User{}), NewMetadata().WithPage(-1), &users)
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	_, err = QueryContextPaginate(context.Background(), sqlDB, SQLite, "SELECT 1", NewMetadata().WithPageSize(0))
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.True(t, errors.As(err, &invalid))
+}
+
+func TestCursorErrorTypes(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithCursorField("id").WithCursor("%%%")
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.True(t, errors.Is(err, ErrCursorInvalid))
+	assert.False(t, errors.Is(err, ErrValidation))
+
+	_, _, err = metadata.GetCursorClause(PostgreSQL)
+	assert.True(t, errors.Is(err, ErrCursorInvalid))
+}
+
+func TestResultNotSlicePointer(t *testing.T) {
+	db := setupTestDB(t)
+
+	var user User
+	var users []User
+	var nilUsers *[]User
+	for _, result := range []interface{}{&user, users, nilUsers, nil} {
+		err := Paginate(db.Model(&User{}), NewMetadata().WithCursorField("id"), result)
+		assert.True(t, errors.Is(err, ErrResultNotSlicePointer), "result %T", result)
+	}
+
+	err := Paginate(db.Model(&User{}), NewMetadata(), &user)
+	assert.True(t, errors.Is(err, ErrResultNotSlicePointer))
+	assert.Contains(t, err.Error(), "*metakit.User")
+
+	_, err = CursorPaginate(db.Model(&User{}), NewMetadata().WithCursorField("id"), &user)
+	assert.True(t, errors.Is(err, ErrResultNotSlicePointer))
+}
+
+func TestOffsetOverflow(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithPage(math.MaxInt).WithPageSize(100)
+	assert.Equal(t, int64(math.MaxInt32), metadata.GetOffset64())
+	assert.True(t, metadata.GetOffset() >= 0)
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	var invalid *InvalidMetadataError
+	if assert.True(t, errors.As(err, &invalid)) {
+		assert.Equal(t, "OFFSET_TOO_LARGE", invalid.Errors[0].Code)
+		assert.Equal(t, "page", invalid.Errors[0].Field)
+	}
+
+	// A configured cap applies to explicit offsets too
+	metadata = NewMetadata().WithOffset(2000).WithMaxOffset(1000)
+	assert.Equal(t, int64(1000), metadata.GetOffset64())
+	result := metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "offset", result.Errors[0].Field)
+	assert.True(t, NewMetadata().WithPage(11).WithMaxOffset(100).Validate().IsValid)
+}
+
+func TestValidateFirst(t *testing.T) {
+	assert.Nil(t, NewMetadata().ValidateFirst())
+
+	metadata := NewMetadata().WithPage(0).WithPageSize(500).WithSortDirection("sideways")
+	assert.Len(t, metadata.Validate().Errors, 3)
+	if err := metadata.ValidateFirst(); assert.NotNil(t, err) {
+		assert.Equal(t, "page", err.Field)
+		assert.Equal(t, "PAGE_NEGATIVE", err.Code)
+	}
+}
+
+func TestValidationResultHelpers(t *testing.T) {
+	result := NewMetadata().WithPage(0).WithPageSize(500).WithValidationRule("page_size", "max:50").Validate()
+	assert.True(t, result.Has("PAGE_NEGATIVE"))
+	assert.True(t, result.Has("PAGE_SIZE_EXCEEDS_MAX"))
+	assert.False(t, result.Has("INVALID_SORT_FIELD"))
+
+	pageSizeErrors := result.FieldErrors("page_size")
+	if assert.Len(t, pageSizeErrors, 2) {
+		assert.Equal(t, "PAGE_SIZE_TOO_LARGE", pageSizeErrors[0].Code)
+		assert.Equal(t, "PAGE_SIZE_EXCEEDS_MAX", pageSizeErrors[1].Code)
+	}
+	assert.Nil(t, result.FieldErrors("sort"))
+
+	// Custom validators can add their own errors
+	result.Errors = append(result.Errors, NewValidationError("sort", "Sorting requires a plan", "SORT_PREMIUM"))
+	assert.True(t, result.Has("SORT_PREMIUM"))
+	assert.Equal(t, []ValidationError{{Field: "sort", Message: "Sorting requires a plan", Code: "SORT_PREMIUM"}}, result.FieldErrors("sort"))
+	assert.False(t, ValidationResult{IsValid: true}.Has("PAGE_NEGATIVE"))
+}
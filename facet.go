@@ -0,0 +1,120 @@
+package metakit
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// FacetNull is the key under which Facet counts the rows whose field is NULL. It holds a NUL
+// character, which text columns don't contain, so it never collides with a stored value.
+const FacetNull = "\x00"
+
+// Facet counts the rows of the query per distinct value of field with GROUP BY, e.g. to show
+// how many rows each option of a filter UI matches. Values are keyed in their string form, with
+// NULL under FacetNull. The field must be one of allowedFields or, when none are given, a column
+// of the query's model; other fields fail with an INVALID_FACET_FIELD error.
+//
+// Example:
+//
+//	counts, err := Facet(db.Model(&Order{}), "status", "status", "country")
+//	// counts == map[string]int64{"paid": 42, "pending": 7}
+func Facet(db *gorm.DB, field string, allowedFields ...string) (map[string]int64, error) {
+	if err := checkFacetField(db, field, allowedFields); err != nil {
+		return nil, err
+	}
+	return facetCounts(db, field)
+}
+
+// Facet counts the rows matching the filters and search of the metadata per distinct value of
+// field, like the package-level Facet. The field must be one of AllowedFields when they are set,
+// or a column of the query's model otherwise.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithAllowedFields("status", "age").WithFilter("age", FilterGte, 18)
+//	counts, err := metadata.Facet(db.Model(&User{}), "status")
+func (m *Metadata) Facet(db *gorm.DB, field string) (map[string]int64, error) {
+	if err := checkFacetField(db, field, m.AllowedFields); err != nil {
+		return nil, err
+	}
+
+	tx := applyFilters(db.Session(&gorm.Session{}), m)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return facetCounts(tx, field)
+}
+
+// checkFacetField validates the facet field against the allowed fields or, when there are none,
+// the columns of the query's model
+func checkFacetField(db *gorm.DB, field string, allowedFields []string) error {
+	if !qualifiedIdentifierPattern.MatchString(field) {
+		return invalidFacetField(fmt.Sprintf("Facet field '%s' is not a valid column name", field))
+	}
+	if len(allowedFields) == 0 {
+		allowedFields = modelColumns(db)
+		if len(allowedFields) == 0 {
+			return invalidFacetField(fmt.Sprintf("Facet field '%s' cannot be checked without allowed fields or a model", field))
+		}
+	}
+	if !slices.Contains(allowedFields, field) {
+		return invalidFacetField(fmt.Sprintf("Field '%s' is not allowed. Allowed fields: %s", field, strings.Join(allowedFields, ", ")))
+	}
+	return nil
+}
+
+// modelColumns returns the columns of the query's model, bare and qualified by its table, or nil
+// when the query has no model
+func modelColumns(db *gorm.DB) []string {
+	if db.Statement.Schema == nil && db.Statement.Model != nil {
+		if err := db.Statement.Parse(db.Statement.Model); err != nil {
+			return nil
+		}
+	}
+	if db.Statement.Schema == nil {
+		return nil
+	}
+
+	var columns []string
+	for _, name := range db.Statement.Schema.DBNames {
+		columns = append(columns, name, db.Statement.Schema.Table+"."+name)
+	}
+	return columns
+}
+
+// facetCounts runs the GROUP BY count of a validated facet field
+func facetCounts(db *gorm.DB, field string) (map[string]int64, error) {
+	tx := db.Session(&gorm.Session{}).Select(fmt.Sprintf("%s, COUNT(*)", field)).Group(field)
+	delete(tx.Statement.Clauses, "ORDER BY")
+	delete(tx.Statement.Clauses, "LIMIT")
+
+	rows, err := tx.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var value sql.NullString
+		var count int64
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, err
+		}
+		key := value.String
+		if !value.Valid {
+			key = FacetNull
+		}
+		counts[key] += count
+	}
+	return counts, rows.Err()
+}
+
+// invalidFacetField returns the validation error of a rejected facet field
+func invalidFacetField(message string) error {
+	return &InvalidMetadataError{Errors: []ValidationError{{Field: "facet", Message: message, Code: "INVALID_FACET_FIELD"}}}
+}
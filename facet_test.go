@@ -0,0 +1,66 @@
+package metakit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestFacet(t *testing.T) {
+	db := setupTestDB(t)
+	assert.NoError(t, db.Create(&[]User{{Name: "Twin A", Age: 30}, {Name: "Twin B", Age: 25}}).Error)
+
+	counts, err := Facet(db.Model(&User{}), "age")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"25": 2, "28": 1, "30": 2, "32": 1, "35": 1}, counts)
+
+	// The query's own conditions and ordering are kept and ignored respectively
+	counts, err = Facet(db.Model(&User{}).Where("age < ?", 30).Order("name"), "age")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"25": 2, "28": 1}, counts)
+
+	_, err = Facet(db.Model(&User{}), "age; DROP TABLE users")
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	// Metadata facets apply the filters and the allow-list
+	metadata := NewMetadata().WithAllowedFields("age", "name").WithFilter("age", FilterGte, 30)
+	counts, err = metadata.Facet(db.Model(&User{}), "age")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"30": 2, "32": 1, "35": 1}, counts)
+
+	_, err = metadata.Facet(db.Model(&User{}), "email")
+	var invalid *InvalidMetadataError
+	if assert.True(t, errors.As(err, &invalid)) {
+		assert.Equal(t, "INVALID_FACET_FIELD", invalid.Errors[0].Code)
+	}
+
+	// The package-level function checks the allowed fields, or the model's columns without them
+	_, err = Facet(db.Model(&User{}), "email", "age", "name")
+	if assert.True(t, errors.As(err, &invalid)) {
+		assert.Equal(t, "INVALID_FACET_FIELD", invalid.Errors[0].Code)
+	}
+	counts, err = Facet(db.Model(&User{}), "users.age")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), counts["30"])
+	_, err = Facet(db.Model(&User{}), "password")
+	assert.True(t, errors.As(err, &invalid))
+	_, err = Facet(db.Table("users"), "age")
+	assert.True(t, errors.As(err, &invalid))
+	_, err = Facet(db.Table("users"), "age", "age")
+	assert.NoError(t, err)
+}
+
+func TestFacetNull(t *testing.T) {
+	db := setupTestDB(t)
+	assert.NoError(t, db.Model(&User{}).Where("age > ?", 30).Update("email", gorm.Expr("NULL")).Error)
+	assert.NoError(t, db.Model(&User{}).Where("age = ?", 30).Update("email", "").Error)
+
+	// NULL and empty strings are counted under separate keys
+	counts, err := Facet(db.Model(&User{}), "email")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), counts[FacetNull])
+	assert.Equal(t, int64(1), counts[""])
+	assert.Len(t, counts, 4)
+}
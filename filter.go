@@ -0,0 +1,370 @@
+package metakit
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FilterOperator defines the comparison applied by a Filter
+type FilterOperator string
+
+const (
+	FilterEq      FilterOperator = "eq"      // field = value, or field IS NULL for nil
+	FilterNe      FilterOperator = "ne"      // field <> value, or field IS NOT NULL for nil
+	FilterGt      FilterOperator = "gt"      // field > value
+	FilterGte     FilterOperator = "gte"     // field >= value
+	FilterLt      FilterOperator = "lt"      // field < value
+	FilterLte     FilterOperator = "lte"     // field <= value
+	FilterLike    FilterOperator = "like"    // field LIKE value
+	FilterILike   FilterOperator = "ilike"   // case-insensitive field LIKE value
+	FilterIn      FilterOperator = "in"      // field IN (values...)
+	FilterNotIn   FilterOperator = "not_in"  // field NOT IN (values...)
+	FilterBetween FilterOperator = "between" // field BETWEEN low AND high
+)
+
+// comparisonOperators maps single-value filter operators to their SQL operator
+var comparisonOperators = map[FilterOperator]string{
+	FilterEq:   "=",
+	FilterNe:   "<>",
+	FilterGt:   ">",
+	FilterGte:  ">=",
+	FilterLt:   "<",
+	FilterLte:  "<=",
+	FilterLike: "LIKE",
+}
+
+// Filter represents a single condition applied to the paginated query.
+// In, NotIn and Between expect a slice value; Between expects exactly two elements.
+// Eq and Ne compare nil values with IS NULL and IS NOT NULL, and bool values with the
+// dialect's boolean literal, TRUE/FALSE or 1/0.
+type Filter struct {
+	Field    string         `json:"field"`
+	Operator FilterOperator `json:"operator"`
+	Value    interface{}    `json:"value"`
+
+	// Contains wraps the value of like and ilike filters in % wildcards for substring matching
+	Contains bool `json:"contains,omitempty"`
+}
+
+// WithFilter adds a filter condition and returns the metadata for method chaining.
+// Filters are combined with AND and applied to both the data and the count query.
+//
+// Example:
+//
+//	metadata := NewMetadata().
+//	  WithFilter("age", FilterBetween, []int{18, 30}).
+//	  WithFilter("status", FilterNotIn, []string{"banned", "deleted"}).
+//	  WithFilter("active", FilterEq, true).
+//	  WithFilter("deleted_at", FilterEq, nil)
+//	// MySQL: WHERE age BETWEEN ? AND ? AND status NOT IN (?, ?) AND active = TRUE AND deleted_at IS NULL
+func (m *Metadata) WithFilter(field string, operator FilterOperator, value interface{}) *Metadata {
+	m.Filters = append(m.Filters, Filter{Field: field, Operator: operator, Value: value})
+	return m
+}
+
+// WithFilterFromQuery adds an in filter from a comma-separated query parameter value and returns
+// the metadata for method chaining. Values are trimmed and empty or duplicate values are dropped;
+// integer values are passed as int64 when they read back unchanged (so "007" stays a string),
+// other values as strings. A value without any entries adds no filter.
+//
+// Example:
+//
+//	// ?status=active,pending
+//	metadata := NewMetadata().WithFilterFromQuery("status", r.URL.Query().Get("status"))
+//	// WHERE status IN (?, ?) with "active", "pending"
+func (m *Metadata) WithFilterFromQuery(field, raw string) *Metadata {
+	entries := cleanFields(strings.Split(raw, ","))
+	if len(entries) == 0 {
+		return m
+	}
+
+	values := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		values[i] = queryValue(entry)
+	}
+	return m.WithFilter(field, FilterIn, values)
+}
+
+// queryValue types a query parameter value as int64 when it is a canonical integer, or keeps it as a string
+func queryValue(raw string) interface{} {
+	if i, err := strconv.ParseInt(raw, 10, 64); err == nil && strconv.FormatInt(i, 10) == raw {
+		return i
+	}
+	return raw
+}
+
+// WithContainsFilter adds a like or ilike filter matching the value anywhere in the field
+// and returns the metadata for method chaining. The value is wrapped in % wildcards as-is.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithContainsFilter("name", FilterILike, "john")
+//	// PostgreSQL: WHERE name ILIKE $1 with $1 = "%john%"
+//	// MySQL/SQLite: WHERE LOWER(name) LIKE LOWER(?) with ? = "%john%"
+func (m *Metadata) WithContainsFilter(field string, operator FilterOperator, value string) *Metadata {
+	m.Filters = append(m.Filters, Filter{Field: field, Operator: operator, Value: value, Contains: true})
+	return m
+}
+
+// GetFilterClause returns the combined filter condition and its bound values using the
+// placeholder style of the dialect. The clause does not include the WHERE keyword and is
+// empty when no filters are set.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithFilter("age", FilterBetween, []int{18, 30})
+//	clause, args, err := metadata.GetFilterClause(PostgreSQL)
+//	// clause == "age BETWEEN $1 AND $2"
+//	// args == []any{18, 30}
+func (m *Metadata) GetFilterClause(dialect Dialect) (string, []any, error) {
+	if err := dialect.validate(); err != nil {
+		return "", nil, err
+	}
+
+	var args []any
+	clause, err := m.filterCondition(dialect, m.placeholderFor(dialect), &args)
+	if err != nil {
+		return "", nil, err
+	}
+	return clause, args, nil
+}
+
+// filterCondition builds the AND-combined condition of all filters and the search, binding their values to args
+func (m *Metadata) filterCondition(dialect Dialect, placeholder Placeholder, args *[]any) (string, error) {
+	var conditions []string
+	for _, filter := range m.Filters {
+		if validationErr := filter.validate(); validationErr != nil {
+			return "", &InvalidMetadataError{Errors: []ValidationError{*validationErr}}
+		}
+		conditions = append(conditions, filter.condition(dialect, placeholder, args))
+	}
+	for _, field := range m.SearchFields {
+		if !qualifiedIdentifierPattern.MatchString(field) {
+			return "", &InvalidMetadataError{Errors: []ValidationError{{
+				Field:   "search",
+				Message: fmt.Sprintf("Search field '%s' is not a valid column name", field),
+				Code:    "INVALID_SEARCH_FIELD",
+			}}}
+		}
+	}
+	if search := m.searchCondition(dialect, placeholder, args); search != "" {
+		conditions = append(conditions, search)
+	}
+	if m.fts() {
+		match, err := m.ftsCondition(dialect, placeholder, args)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, match)
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// WithSearch matches the term as a case-insensitive substring of any of the fields
+// and returns the metadata for method chaining. The term is bound once per field.
+// Restrict the searchable fields with WithValidationRule("search", "in:...").
+//
+// Example:
+//
+//	metadata := NewMetadata().WithSearch("john", "name", "email")
+//	// PostgreSQL: WHERE (name ILIKE $1 OR email ILIKE $2) with both = "%john%"
+func (m *Metadata) WithSearch(term string, fields ...string) *Metadata {
+	m.SearchTerm = term
+	m.SearchFields = fields
+	return m
+}
+
+// WithFullTextSearch makes WithSearch use PostgreSQL full-text matching
+// (to_tsvector @@ plainto_tsquery) and returns the metadata for method chaining.
+// Other dialects keep substring matching.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithSearch("fast car", "title", "body").WithFullTextSearch(true)
+//	// WHERE to_tsvector(concat_ws(' ', title, body)) @@ plainto_tsquery($1)
+func (m *Metadata) WithFullTextSearch(enabled bool) *Metadata {
+	m.SearchFullText = enabled
+	return m
+}
+
+// WithFTS matches the term against the SQLite FTS5 table and returns the metadata for method chaining.
+// The condition "table MATCH ?" is added to the filters, and offset pages are ordered by rank, the
+// relevance of each match, instead of the sort fields; cursor pages keep their cursor order. The term uses the FTS5 query syntax.
+// Other dialects reject the match with an UNSUPPORTED_FTS error.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(2).WithPageSize(20).WithFTS("documents", "sqlite OR postgres")
+//	rows, err := QueryContextPaginate(ctx, db, SQLite, "SELECT * FROM documents", metadata)
+//	// SELECT * FROM documents WHERE documents MATCH ? ORDER BY rank asc LIMIT ? OFFSET ?
+func (m *Metadata) WithFTS(table, term string) *Metadata {
+	m.FTSTable = table
+	m.FTSTerm = term
+	return m
+}
+
+// fts reports whether the rows are matched against an FTS5 table
+func (m *Metadata) fts() bool {
+	return m.FTSTable != "" && m.FTSTerm != ""
+}
+
+// ranksMatches reports whether the page is ordered by the rank of its full-text matches. Cursor
+// pages keep their keyset order, since rank is not a column the cursor can resume from.
+func (m *Metadata) ranksMatches() bool {
+	return m.fts() && !m.IsCursorBased()
+}
+
+// searchCondition builds the OR-combined search condition, or an empty string when no search is set
+func (m *Metadata) searchCondition(dialect Dialect, placeholder Placeholder, args *[]any) string {
+	if m.SearchTerm == "" || len(m.SearchFields) == 0 {
+		return ""
+	}
+
+	if m.SearchFullText && dialect.postgresCompatible() {
+		return fmt.Sprintf("to_tsvector(concat_ws(' ', %s)) @@ plainto_tsquery(%s)",
+			strings.Join(m.SearchFields, ", "), bindArg(placeholder, args, m.SearchTerm))
+	}
+
+	conditions := make([]string, len(m.SearchFields))
+	for i, field := range m.SearchFields {
+		filter := Filter{Field: field, Operator: FilterILike, Value: m.SearchTerm, Contains: true}
+		conditions[i] = filter.condition(dialect, placeholder, args)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+// ftsCondition builds the FTS5 MATCH condition of the full-text table, binding the term to args
+func (m *Metadata) ftsCondition(dialect Dialect, placeholder Placeholder, args *[]any) (string, error) {
+	if dialect != SQLite {
+		return "", &InvalidMetadataError{Errors: []ValidationError{{
+			Field:   "fts",
+			Message: fmt.Sprintf("Full-text matching with FTS5 is not supported on %s", dialect),
+			Code:    "UNSUPPORTED_FTS",
+		}}}
+	}
+	if !qualifiedIdentifierPattern.MatchString(m.FTSTable) {
+		return "", &InvalidMetadataError{Errors: []ValidationError{{
+			Field:   "fts",
+			Message: fmt.Sprintf("FTS table '%s' is not a valid table name", m.FTSTable),
+			Code:    "INVALID_FTS_TABLE",
+		}}}
+	}
+	return fmt.Sprintf("%s MATCH %s", m.FTSTable, bindArg(placeholder, args, m.FTSTerm)), nil
+}
+
+// condition builds the SQL condition of a validated filter, binding its values to args
+func (f Filter) condition(dialect Dialect, placeholder Placeholder, args *[]any) string {
+	values := f.boundValues()
+	params := make([]string, len(values))
+	for i, value := range values {
+		params[i] = bindArg(placeholder, args, value)
+	}
+
+	switch f.Operator {
+	case FilterIn, FilterNotIn:
+		operator := "IN"
+		if f.Operator == FilterNotIn {
+			operator = "NOT IN"
+		}
+		return fmt.Sprintf("%s %s (%s)", f.Field, operator, strings.Join(params, ", "))
+	case FilterBetween:
+		return fmt.Sprintf("%s BETWEEN %s AND %s", f.Field, params[0], params[1])
+	case FilterILike:
+		// ILIKE is PostgreSQL-specific; elsewhere compare lowercased values for consistent behavior
+		if dialect.postgresCompatible() {
+			return fmt.Sprintf("%s ILIKE %s", f.Field, params[0])
+		}
+		return fmt.Sprintf("LOWER(%s) LIKE LOWER(%s)", f.Field, params[0])
+	case FilterEq, FilterNe:
+		if isNullValue(f.Value) {
+			if f.Operator == FilterNe {
+				return f.Field + " IS NOT NULL"
+			}
+			return f.Field + " IS NULL"
+		}
+		if b, ok := f.Value.(bool); ok {
+			return fmt.Sprintf("%s %s %s", f.Field, comparisonOperators[f.Operator], dialect.booleanLiteral(b))
+		}
+	}
+	return fmt.Sprintf("%s %s %s", f.Field, comparisonOperators[f.Operator], params[0])
+}
+
+// boundValues returns the values the condition of a validated filter binds, in order. Null and
+// boolean equality filters are rendered as IS [NOT] NULL and literals, and bind no value.
+func (f Filter) boundValues() []any {
+	switch f.Operator {
+	case FilterIn, FilterNotIn:
+		return filterValues(f.Value)
+	case FilterBetween:
+		return filterValues(f.Value)[:2]
+	case FilterEq, FilterNe:
+		if _, ok := f.Value.(bool); ok || isNullValue(f.Value) {
+			return nil
+		}
+	}
+	if f.Contains {
+		return []any{fmt.Sprintf("%%%v%%", f.Value)}
+	}
+	return []any{f.Value}
+}
+
+// validate checks the field name, operator and value cardinality of the filter
+func (f Filter) validate() *ValidationError {
+	invalid := func(message string) *ValidationError {
+		return &ValidationError{Field: "filters", Message: message, Code: "INVALID_FILTER"}
+	}
+
+	if !qualifiedIdentifierPattern.MatchString(f.Field) {
+		return invalid(fmt.Sprintf("Filter field '%s' is not a valid column name", f.Field))
+	}
+
+	if f.Contains && f.Operator != FilterLike && f.Operator != FilterILike {
+		return invalid(fmt.Sprintf("Filter '%s' on '%s' does not support substring matching", f.Operator, f.Field))
+	}
+
+	switch f.Operator {
+	case FilterIn, FilterNotIn:
+		if len(filterValues(f.Value)) == 0 {
+			return invalid(fmt.Sprintf("Filter '%s' on '%s' requires a non-empty list of values", f.Operator, f.Field))
+		}
+	case FilterBetween:
+		if len(filterValues(f.Value)) != 2 {
+			return invalid(fmt.Sprintf("Filter 'between' on '%s' requires exactly 2 values", f.Field))
+		}
+	case FilterEq, FilterNe:
+	default:
+		if _, ok := comparisonOperators[f.Operator]; !ok && f.Operator != FilterILike {
+			return invalid(fmt.Sprintf("Filter operator '%s' is not supported", f.Operator))
+		}
+		if isNullValue(f.Value) {
+			return invalid(fmt.Sprintf("Filter '%s' on '%s' does not support null values", f.Operator, f.Field))
+		}
+	}
+	return nil
+}
+
+// isNullValue reports whether a filter value is nil or a nil pointer, compared with IS NULL
+func isNullValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// filterValues expands a slice or array filter value into its elements.
+// Returns nil for values that are not slices.
+func filterValues(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil
+	}
+
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
@@ -0,0 +1,257 @@
+package metakit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterBetweenAndNotIn(t *testing.T) {
+	metadata := NewMetadata().
+		WithFilter("age", FilterBetween, []int{18, 30}).
+		WithFilter("status", FilterNotIn, []string{"banned", "deleted"})
+
+	clause, args, err := metadata.GetFilterClause(PostgreSQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "age BETWEEN $1 AND $2 AND status NOT IN ($3, $4)", clause)
+	assert.Equal(t, []any{18, 30, "banned", "deleted"}, args)
+
+	clause, args, err = metadata.GetFilterClause(MySQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "age BETWEEN ? AND ? AND status NOT IN (?, ?)", clause)
+	assert.Equal(t, []any{18, 30, "banned", "deleted"}, args)
+}
+
+func TestFilterArgsPrecedePagination(t *testing.T) {
+	metadata := NewMetadata().
+		WithPage(2).
+		WithPageSize(10).
+		WithSort("id").
+		WithFilter("age", FilterBetween, []int{18, 30})
+	metadata.ValidateAndSetDefaults()
+
+	query, args, err := metadata.BuildSQL(PostgreSQL, "SELECT * FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM users WHERE age BETWEEN $1 AND $2 ORDER BY id asc LIMIT $3 OFFSET $4", query)
+	assert.Equal(t, []any{18, 30, 10, 10}, args)
+}
+
+func TestFilterCardinality(t *testing.T) {
+	metadata := NewMetadata().WithFilter("age", FilterBetween, []int{18})
+	result := metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_FILTER", result.Errors[0].Code)
+
+	_, _, err := metadata.GetFilterClause(MySQL)
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	metadata = NewMetadata().WithFilter("status", FilterNotIn, []string{})
+	assert.False(t, metadata.Validate().IsValid)
+
+	metadata = NewMetadata().WithFilter("age; DROP TABLE users", FilterEq, 1)
+	assert.False(t, metadata.Validate().IsValid)
+}
+
+func TestPaginateWithFilters(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().
+		WithSort("age").
+		WithFilter("age", FilterBetween, []int{28, 32}).
+		WithFilter("name", FilterNotIn, []string{"John Doe"})
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), metadata.TotalRows)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, "Alice Brown", users[0].Name)
+	assert.Equal(t, "Charlie Wilson", users[1].Name)
+}
+
+func TestFilterILike(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		clause  string
+	}{
+		{PostgreSQL, "name ILIKE $1"},
+		{CockroachDB, "name ILIKE $1"},
+		{MySQL, "LOWER(name) LIKE LOWER(?)"},
+		{SQLite, "LOWER(name) LIKE LOWER(?)"},
+	}
+
+	for _, test := range tests {
+		metadata := NewMetadata().WithContainsFilter("name", FilterILike, "john")
+		clause, args, err := metadata.GetFilterClause(test.dialect)
+		assert.NoError(t, err)
+		assert.Equal(t, test.clause, clause, test.dialect.String())
+		assert.Equal(t, []any{"%john%"}, args, test.dialect.String())
+	}
+
+	// Values are bound unchanged without the contains flag
+	_, args, err := NewMetadata().WithFilter("name", FilterILike, "j%").GetFilterClause(MySQL)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"j%"}, args)
+
+	// Substring matching only applies to like operators
+	assert.False(t, NewMetadata().WithContainsFilter("age", FilterGt, "1").Validate().IsValid)
+}
+
+func TestPaginateWithILikeFilter(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithSort("id").WithContainsFilter("name", FilterILike, "JOHN")
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), metadata.TotalRows)
+	assert.Equal(t, "John Doe", users[0].Name)
+	assert.Equal(t, "Bob Johnson", users[1].Name)
+}
+
+func TestWithSearch(t *testing.T) {
+	metadata := NewMetadata().
+		WithFilter("age", FilterGt, 18).
+		WithSearch("john", "name", "email", "description")
+
+	clause, args, err := metadata.GetFilterClause(PostgreSQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "age > $1 AND (name ILIKE $2 OR email ILIKE $3 OR description ILIKE $4)", clause)
+	assert.Equal(t, []any{18, "%john%", "%john%", "%john%"}, args)
+
+	clause, args, err = metadata.GetFilterClause(SQLite)
+	assert.NoError(t, err)
+	assert.Equal(t, "age > ? AND (LOWER(name) LIKE LOWER(?) OR LOWER(email) LIKE LOWER(?) OR LOWER(description) LIKE LOWER(?))", clause)
+	assert.Equal(t, 4, len(args))
+
+	// Full-text search binds the term once on PostgreSQL
+	clause, args, err = NewMetadata().WithSearch("fast car", "title", "body").WithFullTextSearch(true).GetFilterClause(PostgreSQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "to_tsvector(concat_ws(' ', title, body)) @@ plainto_tsquery($1)", clause)
+	assert.Equal(t, []any{"fast car"}, args)
+
+	// Search fields are checked against the allow-list
+	metadata = NewMetadata().
+		WithSearch("john", "name", "password").
+		WithValidationRule("search", "in:name,email")
+	result := metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_SEARCH_FIELD", result.Errors[0].Code)
+}
+
+func TestPaginateWithSearch(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithSort("id").WithSearch("ALICE", "name", "email")
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), metadata.TotalRows)
+	assert.Equal(t, "Alice Brown", users[0].Name)
+}
+
+func TestAllowedFields(t *testing.T) {
+	metadata := NewMetadata().
+		WithAllowedFields("id", "name", "age").
+		WithSort("password").
+		WithFilter("email", FilterEq, "john@example.com")
+
+	result := metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, 2, len(result.Errors))
+	assert.Equal(t, "INVALID_SORT_FIELD", result.Errors[0].Code)
+	assert.Equal(t, "sort", result.Errors[0].Field)
+	assert.Equal(t, "INVALID_FILTER_FIELD", result.Errors[1].Code)
+	assert.Equal(t, "filters", result.Errors[1].Field)
+
+	// Cursor and selected fields share the same list
+	metadata = NewMetadata().
+		WithAllowedFields("id", "name").
+		WithCursorField("created_at").
+		WithFields("id", "email")
+	result = metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_CURSOR_FIELD", result.Errors[0].Code)
+	assert.Equal(t, "INVALID_SELECTED_FIELD", result.Errors[1].Code)
+
+	metadata = NewMetadata().
+		WithAllowedFields("id", "name", "age").
+		WithSort("name").
+		WithFields("id", "name").
+		WithFilter("age", FilterGte, 18).
+		WithSearch("jo", "name")
+	assert.True(t, metadata.Validate().IsValid)
+}
+
+func TestFilterBoolAndNull(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		clause  string
+	}{
+		{PostgreSQL, "active = TRUE AND verified <> FALSE AND deleted_at IS NULL AND archived_at IS NOT NULL AND age > $1"},
+		{CockroachDB, "active = TRUE AND verified <> FALSE AND deleted_at IS NULL AND archived_at IS NOT NULL AND age > $1"},
+		{MySQL, "active = TRUE AND verified <> FALSE AND deleted_at IS NULL AND archived_at IS NOT NULL AND age > ?"},
+		{SQLite, "active = 1 AND verified <> 0 AND deleted_at IS NULL AND archived_at IS NOT NULL AND age > ?"},
+		{DB2, "active = 1 AND verified <> 0 AND deleted_at IS NULL AND archived_at IS NOT NULL AND age > ?"},
+	}
+
+	var archivedAt *string
+	for _, test := range tests {
+		metadata := NewMetadata().
+			WithFilter("active", FilterEq, true).
+			WithFilter("verified", FilterNe, false).
+			WithFilter("deleted_at", FilterEq, nil).
+			WithFilter("archived_at", FilterNe, archivedAt).
+			WithFilter("age", FilterGt, 18)
+		clause, args, err := metadata.GetFilterClause(test.dialect)
+		assert.NoError(t, err)
+		assert.Equal(t, test.clause, clause, test.dialect.String())
+		assert.Equal(t, []any{18}, args, test.dialect.String())
+	}
+
+	// Null values only apply to eq and ne
+	result := NewMetadata().WithFilter("deleted_at", FilterGt, nil).Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_FILTER", result.Errors[0].Code)
+
+	db := setupTestDB(t)
+	assert.NoError(t, db.Exec("ALTER TABLE users ADD COLUMN active BOOLEAN").Error)
+	assert.NoError(t, db.Exec("UPDATE users SET active = age > 29 WHERE id <> 4").Error)
+
+	var users []User
+	metadata := NewMetadata().WithSort("id").WithFilter("active", FilterEq, true)
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, int64(3), metadata.TotalRows)
+
+	metadata = NewMetadata().WithSort("id").WithFilter("active", FilterEq, nil)
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "Alice Brown", users[0].Name)
+	}
+}
+
+func TestFTSClause(t *testing.T) {
+	metadata := NewMetadata().WithPage(2).WithPageSize(10).WithSort("title").WithFTS("documents", "sqlite")
+
+	query, args, err := metadata.BuildSQL(SQLite, "SELECT * FROM documents")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM documents WHERE documents MATCH ? ORDER BY rank asc LIMIT ? OFFSET ?", query)
+	assert.Equal(t, []any{"sqlite", 10, 10}, args)
+
+	// Cursor pages keep their keyset order
+	query, _, err = NewMetadata().WithCursorField("rowid").WithFTS("documents", "sqlite").BuildSQL(SQLite, "SELECT rowid, * FROM documents")
+	assert.NoError(t, err)
+	assert.Contains(t, query, "WHERE documents MATCH ? ORDER BY rowid asc")
+
+	_, _, err = metadata.BuildSQL(PostgreSQL, "SELECT * FROM documents")
+	var invalid *InvalidMetadataError
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "UNSUPPORTED_FTS", invalid.Errors[0].Code)
+
+	_, _, err = NewMetadata().WithFTS("documents; --", "x").BuildSQL(SQLite, "SELECT * FROM documents")
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "INVALID_FTS_TABLE", invalid.Errors[0].Code)
+}
@@ -0,0 +1,75 @@
+//go:build sqlite_fts5
+
+package metakit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// ftsDocument is a row of the FTS5 documents table
+type ftsDocument struct {
+	Title string
+	Body  string
+}
+
+// TestFTSPaginate requires the sqlite_fts5 build tag of github.com/mattn/go-sqlite3
+func TestFTSPaginate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE VIRTUAL TABLE documents USING fts5(title, body)").Error; err != nil {
+		t.Fatal(err)
+	}
+	documents := []ftsDocument{
+		{Title: "a", Body: "postgres tuning"},
+		{Title: "b", Body: "sqlite notes on sqlite and sqlite again"},
+		{Title: "c", Body: "mysql replication"},
+		{Title: "d", Body: "sqlite wal mode and sqlite pragmas"},
+		{Title: "e", Body: "using sqlite with go and a few more words to dilute the match"},
+	}
+	for _, document := range documents {
+		if err := db.Table("documents").Create(&document).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Matches are ordered by rank, the best match first, overriding the sort
+	metadata := NewMetadata().WithPageSize(2).WithSort("title").WithSortDirection("desc").WithFTS("documents", "sqlite")
+	var page []ftsDocument
+	assert.NoError(t, Paginate(db.Table("documents"), metadata, &page))
+	assert.Equal(t, int64(3), metadata.TotalRows)
+	assert.Equal(t, int64(2), metadata.TotalPages)
+	assert.Equal(t, []string{"b", "d"}, []string{page[0].Title, page[1].Title})
+
+	page = nil
+	assert.NoError(t, Paginate(db.Table("documents"), metadata.WithPage(2), &page))
+	assert.Equal(t, 1, len(page))
+	assert.Equal(t, "e", page[0].Title)
+
+	// The SQL path builds the same MATCH query
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata = NewMetadata().WithPageSize(2).WithFTS("documents", "sqlite")
+	rows, err := QueryContextPaginate(context.Background(), sqlDB, SQLite, "SELECT title FROM documents", metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var titles []string
+	for rows.Next() {
+		var title string
+		assert.NoError(t, rows.Scan(&title))
+		titles = append(titles, title)
+	}
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, []string{"b", "d"}, titles)
+}
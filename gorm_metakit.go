@@ -1,207 +1,1029 @@
 package metakit
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // GPaginate is a GORM scope function that applies pagination and sorting to a query
 func GPaginate(m *Metadata) func(db *gorm.DB) *gorm.DB {
+	return paginateScope(m, 0)
+}
+
+// Scope returns the GORM scope applying the metadata's filters, sorting and pagination.
+// It is equivalent to GPaginate(m) and composes with conditions added before or after it.
+// Use Paginate to also count the rows matching those conditions.
+//
+// Example:
+//
+//	var users []User
+//	db.Model(&User{}).Where("active = ?", true).Scopes(metadata.Scope()).Find(&users)
+func (m *Metadata) Scope() func(db *gorm.DB) *gorm.DB {
+	return GPaginate(m)
+}
+
+// DialectFromGorm returns the Dialect of the GORM connection, mapped from its dialector name, so that
+// SQL built for the connection can follow its dialect. Dialects registered with RegisterDialect are
+// matched by name. Unknown dialectors return ErrUnsupportedDialect.
+//
+// Example:
+//
+//	dialect, err := DialectFromGorm(db)
+//	clause, args, err := metadata.GetFilterClause(dialect)
+func DialectFromGorm(db *gorm.DB) (Dialect, error) {
+	name := db.Dialector.Name()
+	dialect, ok := dialectFromName(name)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedDialect, name)
+	}
+	return dialect, nil
+}
+
+// paginateScope builds the pagination scope, fetching extra rows beyond the page size
+// when needed to detect whether more results exist
+func paginateScope(m *Metadata, extra int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		// Validate and set defaults
+		// Validate and set defaults, taking empty cursor settings from a preserved order
+		m.cursorFromQueryOrder(db)
 		m.ValidateAndSetDefaults()
 
-		// Apply field selection if specified
-		if len(m.SelectedFields) > 0 && m.SelectedFields[0] != "*" {
-			db = db.Select(m.SelectedFields)
+		// Pages counted from the end can't be located before the rows are counted
+		if m.awaitsTotal() {
+			db.AddError(&InvalidMetadataError{Errors: []ValidationError{pageSizeRequiresTotalError()}})
+			return db
+		}
+
+		// Apply field selection if specified, adding the cursor key columns on cursor pages and
+		// the window count column when counting with it
+		fields, _ := m.cursorSelection(qualifiedPrimaryKey(db))
+		if m.CountMode == CountWindow {
+			selection := "*"
+			if len(fields) > 0 && fields[0] != "*" {
+				selection = strings.Join(fields, ", ")
+			}
+			db = db.Select(fmt.Sprintf("%s, COUNT(*) OVER() AS %s", selection, windowCountColumn))
+		} else if len(fields) > 0 && fields[0] != "*" {
+			db = db.Select(fields)
+		}
+
+		// Apply filters if specified
+		db = applyFilters(db, m)
+
+		// Keep an order set on the query beforehand instead of adding one
+		preserveOrder := m.PreserveOrder && len(queryOrder(db)) > 0
+
+		// Apply sorting if specified, breaking ties by the model's primary key for a stable order,
+		// or order full-text matches by rank
+		if m.StableOrder && m.StableOrderColumn == "" {
+			m.StableOrderColumn = primaryKeyColumn(db)
+		}
+		if (m.Sort != "" || m.ranksMatches()) && !preserveOrder && !m.backward() {
+			if dialect, ok := dialectFromName(db.Dialector.Name()); ok {
+				db = db.Order(m.GetSortClauseFor(dialect))
+			} else {
+				db = db.Order(m.GetSortClause())
+			}
 		}
 
-		// Apply sorting if specified
-		if m.Sort != "" {
-			db = db.Order(m.GetSortClause())
+		// Order cursor pages by the cursor field when no sort is set or the page is read backward,
+		// so the keyset comparison matches the row order, and rows sharing a cursor value by the
+		// tie-break column
+		if m.IsCursorBased() && m.CursorField != "" && !preserveOrder {
+			columns, direction := m.cursorOrderColumns()
+			if m.Sort == "" || m.backward() {
+				db = db.Order(fmt.Sprintf("%s %s", columns, direction))
+			} else if m.CursorTieBreak != "" {
+				db = db.Order(fmt.Sprintf("%s %s", m.CursorTieBreak, direction))
+			}
 		}
 
 		// Apply cursor-based pagination if enabled
 		if m.IsCursorBased() {
-			return applyCursorPagination(db, m)
+			return applyCursorPagination(db, m, m.GetLimit()+extra)
 		}
 
 		// Apply offset-based pagination
-		return db.Offset(m.GetOffset()).Limit(m.GetLimit())
+		return db.Offset(m.GetOffset()).Limit(m.GetLimit() + extra)
 	}
 }
 
 // Paginate is a helper function that handles pagination for a GORM query
-// It returns the paginated results and updates the metadata with total count
+// It returns the paginated results and updates the metadata with total count.
+// Conditions applied to db beforehand, such as Where or Joins, apply to both the count and the data query.
+// In cursor mode m.Cursor holds the cursor of the next page afterwards, or is empty on the last page.
 func Paginate(db *gorm.DB, m *Metadata, result interface{}) error {
+	// Create a clone of the DB for counting (to not affect field selection)
+	tx, err := paginate(db, gormCounter(db.Session(&gorm.Session{}), m), m, result)
+	if err != nil {
+		return err
+	}
+	m.hideCursorKeys(tx, result)
+	return nil
+}
+
+// PaginateWithCount is similar to Paginate but allows you to specify a custom count query
+// Useful when you need to count with specific conditions
+func PaginateWithCount(db *gorm.DB, countQuery *gorm.DB, m *Metadata, result interface{}) error {
+	tx, err := paginate(db, gormCounter(countQuery, m), m, result)
+	if err != nil {
+		return err
+	}
+	m.hideCursorKeys(tx, result)
+	return nil
+}
+
+// PaginateWithCountFunc is similar to Paginate but obtains TotalRows from countFn instead of a
+// COUNT query, decoupling counting from GORM, e.g. to read totals from a cache or another store.
+// countFn is not called when a KnownTotal is set or counting is skipped with CountNone or CountWindow.
+//
+// Example:
+//
+//	err := PaginateWithCountFunc(db.Model(&User{}), metadata, &users, func() (int64, error) {
+//	  return redisClient.Get(ctx, "users:count").Int64()
+//	})
+func PaginateWithCountFunc(db *gorm.DB, m *Metadata, result interface{}, countFn func() (int64, error)) error {
+	tx, err := paginate(db, rowCounter{exact: countFn}, m, result)
+	if err != nil {
+		return err
+	}
+	m.hideCursorKeys(tx, result)
+	return nil
+}
+
+// PaginateCopy paginates like Paginate, but computes the totals, cursors and other results into
+// a copy of m that it returns, leaving m untouched, e.g. to log the request alongside the result.
+// The other functions of the package can be made non-mutating the same way with Clone.
+//
+// Example:
+//
+//	result, err := PaginateCopy(db.Model(&User{}), request, &users)
+//	// request.TotalRows is unchanged; result.TotalRows holds the count
+func PaginateCopy(db *gorm.DB, m *Metadata, result interface{}) (*Metadata, error) {
+	computed := m.Clone()
+	if err := Paginate(db, computed, result); err != nil {
+		return nil, err
+	}
+	return computed, nil
+}
+
+// paginate runs the count and data queries shared by Paginate and PaginateWithCount,
+// returning the executed data query
+func paginate(db *gorm.DB, counter rowCounter, m *Metadata, result interface{}) (*gorm.DB, error) {
 	// Capture start time for debug mode
 	var startTime time.Time
 	if m.Debug {
 		startTime = time.Now()
 	}
 
-	// Validate metadata
-	validation := m.Validate()
-	if !validation.IsValid {
-		return fmt.Errorf("invalid metadata: %v", validation.Errors)
+	// Reject results that rows cannot be scanned into before running any query
+	if err := checkResult(result); err != nil {
+		return nil, err
 	}
 
-	// Create a clone of the DB for counting (to not affect field selection)
-	countDB := db.Session(&gorm.Session{})
+	// Validate metadata
+	m.cursorFromQueryOrder(db)
+	if err := m.Validate().Err(); err != nil {
+		return nil, err
+	}
 
 	// Get total count before applying pagination
-	var total int64
-	if err := countDB.Count(&total).Error; err != nil {
-		return err
+	if err := countRows(counter, m); err != nil {
+		return nil, err
 	}
-	m.TotalRows = total
 
-	// Debug: save the raw SQL
-	var rawSQL string
+	// Read the drift marker before the data query adds its pagination clauses to db
+	var marker string
+	if m.DriftColumn != "" {
+		var err error
+		if marker, err = driftMarker(db, m); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fetch one extra row to detect more results when counting is skipped.
+	// Cursor pages always do so, since the total doesn't tell whether rows follow the cursor.
+	fetchExtra := m.detectsMore() || m.IsCursorBased()
+	extra := 0
+	if fetchExtra {
+		extra = 1
+	}
+
+	// Debug: save the raw SQL and bound vars of the data query, and the count query
+	var rawSQL, countSQL string
+	var rawArgs []any
 	if m.Debug {
-		rawSQL = db.ToSQL(func(tx *gorm.DB) *gorm.DB {
-			return tx.Scopes(GPaginate(m)).Find(result)
-		})
+		stmt := db.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true}).
+			Scopes(paginateScope(m, extra)).Find(result).Statement
+		rawSQL, rawArgs = db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...), stmt.Vars
+		if counter.sql != nil && m.countsExactly() {
+			countSQL = counter.sql()
+		}
 	}
 
 	// Apply pagination and get results
-	if err := db.Scopes(GPaginate(m)).Find(result).Error; err != nil {
-		return err
+	var tx *gorm.DB
+	if m.CountMode == CountWindow && m.KnownTotal == nil {
+		var total int64
+		tx, total = findWithWindowCount(db.Scopes(paginateScope(m, extra)), result)
+		m.TotalRows = total
+	} else {
+		tx = db.Scopes(paginateScope(m, extra)).Find(result)
+	}
+	if tx.Error != nil {
+		return nil, tx.Error
 	}
 
 	// Update metadata with calculated values
 	m.ValidateAndSetDefaults()
+	if fetchExtra {
+		hasMore := trimExtraRow(result, m.GetLimit())
+		setDetectedMetadata(m, reflect.Indirect(reflect.ValueOf(result)).Len(), hasMore)
+	}
+	if m.IsCursorBased() && m.backward() {
+		reverseRows(result)
+	}
 
-	// Encode cursor for next page if using cursor-based pagination
-	if m.IsCursorBased() && m.HasNext {
-		resultValue := reflect.ValueOf(result).Elem()
-		if resultValue.Len() > 0 {
-			lastItem := resultValue.Index(resultValue.Len() - 1).Interface()
-			lastItemValue := reflect.ValueOf(lastItem)
-			cursorData := map[string]interface{}{
-				"id":   lastItemValue.FieldByName("ID").Interface(),
-				"name": lastItemValue.FieldByName("Name").Interface(),
-				"page": m.Page,
-			}
-			m.Cursor = encodeCursor(cursorData)
+	// Detect data drift since the client's previous page
+	if m.DriftColumn != "" {
+		m.UpdateDrift(marker)
+	}
+
+	// Replace the cursor with the one of the next page, clearing it when there is none
+	if m.IsCursorBased() {
+		value, ok := m.cursorKeyAt(tx, result, -1)
+		if !ok {
+			m.HasNext = false
+		}
+
+		m.Cursor = ""
+		if m.HasNext {
+			m.Cursor = m.encodeCursorValue(value)
 		}
 	}
 
 	// Add debug information
 	if m.Debug {
+		m.DebugInfo = &DebugInfo{SQL: rawSQL, Args: rawArgs, CountSQL: countSQL, Duration: time.Since(startTime)}
 		fmt.Printf("Query: %s\n", rawSQL)
-		fmt.Printf("Query time: %v\n", time.Since(startTime))
+		if countSQL != "" {
+			fmt.Printf("Count query: %s\n", countSQL)
+		}
+		fmt.Printf("Query time: %v\n", m.DebugInfo.Duration)
 		fmt.Printf("Total rows: %d\n", m.TotalRows)
 		fmt.Printf("Total pages: %d\n", m.TotalPages)
 	}
 
+	return tx, nil
+}
+
+// PaginateRows counts the rows of db like Paginate, then applies the pagination scope and returns the
+// page as a row stream to scan manually, without loading it into a slice. The caller must close the rows.
+// CountWindow counts with a separate query, since the window column would appear in the rows; with
+// CountNone, HasNext is not detected. In cursor mode the caller builds the next cursor from the last row.
+//
+// Example:
+//
+//	rows, err := PaginateRows(db.Model(&User{}), metadata)
+//	defer rows.Close()
+//	for rows.Next() {
+//	  var user User
+//	  db.ScanRows(rows, &user)
+//	}
+func PaginateRows(db *gorm.DB, m *Metadata) (*sql.Rows, error) {
+	if err := m.Validate().Err(); err != nil {
+		return nil, err
+	}
+
+	if m.CountMode == CountWindow {
+		defer func(mode CountMode) { m.CountMode = mode }(m.CountMode)
+		m.CountMode = CountExact
+	}
+	if err := countRows(gormCounter(db.Session(&gorm.Session{}), m), m); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Scopes(paginateScope(m, 0)).Rows()
+	if err != nil {
+		return nil, err
+	}
+	m.ValidateAndSetDefaults()
+	return rows, nil
+}
+
+// PaginateJSON paginates like Paginate and returns the rows of the page marshaled as a JSON array,
+// e.g. to cache the bytes directly. Rows are scanned as maps of their columns, so the objects hold
+// the SelectedFields only, keyed by column name. An empty page is returned as [].
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(2).WithPageSize(20).WithFields("id", "name")
+//	data, err := PaginateJSON(db.Model(&User{}), metadata)
+//	// data == `[{"id":21,"name":"..."},...]`, metadata holds the totals
+func PaginateJSON(db *gorm.DB, m *Metadata) (json.RawMessage, error) {
+	rows := []map[string]interface{}{}
+	if err := Paginate(db, m, &rows); err != nil {
+		return nil, err
+	}
+	return json.Marshal(rows)
+}
+
+// First scans the first row of the page described by m into dest, a pointer to a struct,
+// applying the sort, filters, cursor and offset of m with a limit of 1. It returns false when
+// no row matched. No COUNT query is executed, so the totals of m are left unchanged.
+// With a page size of 1, Page selects the Nth row in sort order.
+//
+// Example:
+//
+//	var user User
+//	found, err := First(db.Model(&User{}), NewMetadata().WithSort("age").WithPage(3).WithPageSize(1), &user)
+//	// user is the third youngest user
+func First(db *gorm.DB, m *Metadata, dest interface{}) (bool, error) {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return false, fmt.Errorf("%w, got %T", ErrResultNotStructPointer, dest)
+	}
+	if err := m.Validate().Err(); err != nil {
+		return false, err
+	}
+
+	if m.CountMode == CountWindow {
+		defer func(mode CountMode) { m.CountMode = mode }(m.CountMode)
+		m.CountMode = CountExact
+	}
+	tx := db.Scopes(paginateScope(m, 0)).Limit(1).Find(dest)
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	return tx.RowsAffected > 0, nil
+}
+
+// CursorPaginateT paginates db in cursor mode like CursorPaginate and returns the rows as a typed
+// slice in the page's Data, alongside the page's cursors.
+//
+// Example:
+//
+//	page, err := CursorPaginateT[User](db.Model(&User{}), NewMetadata().WithCursorField("id"))
+//	// page.Data is a []User
+func CursorPaginateT[T any](db *gorm.DB, m *Metadata) (CursorPageT[T], error) {
+	data := []T{}
+	page, err := CursorPaginate(db, m, &data)
+	if err != nil {
+		return CursorPageT[T]{}, err
+	}
+	return CursorPageT[T]{
+		Data:       data,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+		HasMore:    page.HasMore,
+	}, nil
+}
+
+// PaginateMap paginates db like Paginate and returns the rows as maps keyed by column name,
+// for generic tooling without a struct per table. db must name its table with Model or Table.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithFields("id", "name").WithSort("id")
+//	rows, err := PaginateMap(db.Table("users"), metadata)
+//	// rows[0] == map[string]interface{}{"id": 1, "name": "John Doe"}
+func PaginateMap(db *gorm.DB, m *Metadata) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	if err := Paginate(db, m, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// CursorPaginate paginates db in cursor mode like Paginate and returns the page's cursors.
+// Rows are scanned into dest; when dest is a *[]map[string]interface{} they are also returned as Data.
+// NextCursor continues after the last row, and PrevCursor, set when the page was reached through
+// a cursor, can be passed to WithBefore to fetch the rows preceding the first row.
+//
+// Example:
+//
+//	var users []User
+//	page, err := CursorPaginate(db.Model(&User{}), NewMetadata().WithCursorField("id"), &users)
+//	// page.NextCursor resumes after the last user when page.HasMore
+func CursorPaginate(db *gorm.DB, m *Metadata, dest interface{}) (CursorPage, error) {
+	if m.PreserveOrder && m.CursorField == "" {
+		m.cursorFromOrder(queryOrder(db))
+	}
+	if !m.IsCursorBased() {
+		return CursorPage{}, &InvalidMetadataError{Errors: []ValidationError{{
+			Field:   "cursor_field",
+			Message: "Cursor field is required for cursor-based pagination",
+			Code:    "MISSING_CURSOR_FIELD",
+		}}}
+	}
+
+	tx, err := paginate(db, gormCounter(db.Session(&gorm.Session{}), m), m, dest)
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	page := CursorPage{NextCursor: m.Cursor, HasMore: m.HasNext}
+	if rows, ok := dest.(*[]map[string]interface{}); ok {
+		page.Data = *rows
+	}
+	if m.HasPrevious {
+		if value, ok := m.cursorKeyAt(tx, dest, 0); ok {
+			page.PrevCursor = m.encodeCursorValue(value)
+		}
+	}
+	m.hideCursorKeys(tx, dest)
+	return page, nil
+}
+
+// primaryKeyColumn returns the primary key column of the query's model, or an empty string when
+// the model has none or cannot be parsed
+func primaryKeyColumn(db *gorm.DB) string {
+	if db.Statement.Schema == nil && db.Statement.Model != nil {
+		if err := db.Statement.Parse(db.Statement.Model); err != nil {
+			return ""
+		}
+	}
+	if db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return ""
+	}
+	return db.Statement.Schema.PrioritizedPrimaryField.DBName
+}
+
+// qualifiedPrimaryKey returns the primary key column of the query's model qualified by its table,
+// so that it stays unambiguous in joins, or an empty string when the model has none
+func qualifiedPrimaryKey(db *gorm.DB) string {
+	pk := primaryKeyColumn(db)
+	if pk == "" || db.Statement.Table == "" {
+		return pk
+	}
+	return db.Statement.Table + "." + pk
+}
+
+// hideCursorKeys removes the key columns added to the selection of a cursor page from its map rows
+// when HideCursorKeys is enabled
+func (m *Metadata) hideCursorKeys(tx *gorm.DB, result interface{}) {
+	if !m.HideCursorKeys {
+		return
+	}
+	_, added := m.cursorSelection(qualifiedPrimaryKey(tx))
+	if len(added) == 0 {
+		return
+	}
+
+	rows, ok := result.(*[]map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, row := range *rows {
+		for _, column := range added {
+			delete(row, unqualifiedColumn(column))
+		}
+	}
+}
+
+// queryOrder returns the columns of the ORDER BY set on db beforehand, e.g. with Order
+func queryOrder(db *gorm.DB) []SortField {
+	if db.Statement == nil {
+		return nil
+	}
+	orderBy, ok := db.Statement.Clauses["ORDER BY"].Expression.(clause.OrderBy)
+	if !ok {
+		return nil
+	}
+
+	var fields []SortField
+	for _, column := range orderBy.Columns {
+		if !column.Column.Raw {
+			direction := Asc
+			if column.Desc {
+				direction = Desc
+			}
+			fields = append(fields, SortField{Field: column.Column.Name, Direction: direction})
+			continue
+		}
+		for _, term := range strings.Split(column.Column.Name, ",") {
+			parts := strings.Fields(term)
+			if len(parts) == 0 {
+				continue
+			}
+			direction := Asc
+			if len(parts) > 1 {
+				if normalized, _ := normalizeDirection(parts[1]); normalized == "desc" {
+					direction = Desc
+				}
+			}
+			fields = append(fields, SortField{Field: parts[0], Direction: direction})
+		}
+	}
+	return fields
+}
+
+// cursorFromQueryOrder fills empty cursor settings from the order preserved on db in cursor mode
+func (m *Metadata) cursorFromQueryOrder(db *gorm.DB) {
+	if m.PreserveOrder && m.IsCursorBased() {
+		m.cursorFromOrder(queryOrder(db))
+	}
+}
+
+// cursorFromOrder makes the first order column the cursor field and the second its tie-break,
+// keeping cursor settings that are already set
+func (m *Metadata) cursorFromOrder(order []SortField) {
+	if len(order) == 0 {
+		return
+	}
+	if m.CursorField == "" {
+		m.CursorField = order[0].Field
+	}
+	if m.CursorField != order[0].Field {
+		return
+	}
+	if m.CursorOrder == "" {
+		m.CursorOrder = string(order[0].Direction)
+	}
+	if m.CursorTieBreak == "" && len(order) > 1 {
+		m.CursorTieBreak = order[1].Field
+		m.CursorTieBreakOrder = string(order[1].Direction)
+	}
+}
+
+// checkResult returns ErrResultNotSlicePointer unless result is a non-nil pointer to a slice
+func checkResult(result interface{}) error {
+	value := reflect.ValueOf(result)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%w, got %T", ErrResultNotSlicePointer, result)
+	}
 	return nil
 }
 
-// PaginateWithCount is similar to Paginate but allows you to specify a custom count query
-// Useful when you need to count with specific conditions
-func PaginateWithCount(db *gorm.DB, countQuery *gorm.DB, m *Metadata, result interface{}) error {
-	// Capture start time for debug mode
-	var startTime time.Time
-	if m.Debug {
-		startTime = time.Now()
+// windowCountColumn is the column holding the COUNT(*) OVER() total in CountWindow mode
+const windowCountColumn = "metakit_total_count"
+
+// findWithWindowCount runs the query and scans its rows into result like Find,
+// returning the total read from the window count column
+func findWithWindowCount(query *gorm.DB, result interface{}) (*gorm.DB, int64) {
+	tx := query.Session(&gorm.Session{})
+	rows, err := query.Rows()
+	if err != nil {
+		_ = tx.AddError(err)
+		return tx, 0
 	}
+	defer rows.Close()
 
-	// Validate metadata
-	validation := m.Validate()
-	if !validation.IsValid {
-		return fmt.Errorf("invalid metadata: %v", validation.Errors)
+	tx.Statement.Dest = result
+	tx.Statement.ReflectValue = reflect.Indirect(reflect.ValueOf(result))
+	if tx.Statement.Model != nil {
+		if err := tx.Statement.Parse(tx.Statement.Model); err != nil {
+			_ = tx.AddError(err)
+			return tx, 0
+		}
 	}
 
-	// Get total count using the custom count query
-	var total int64
-	if err := countQuery.Count(&total).Error; err != nil {
-		return err
+	windowRows := &windowCountRows{Rows: rows, index: -1}
+	gorm.Scan(windowRows, tx, 0)
+	if err := rows.Err(); err != nil {
+		_ = tx.AddError(err)
 	}
-	m.TotalRows = total
+	return tx, windowRows.total
+}
 
-	// Debug: save the raw SQL
-	var rawSQL string
-	if m.Debug {
-		rawSQL = db.ToSQL(func(tx *gorm.DB) *gorm.DB {
-			return tx.Scopes(GPaginate(m)).Find(result)
-		})
+// windowCountRows hides the window count column from GORM's scanner and captures its value
+type windowCountRows struct {
+	*sql.Rows
+	index int
+	total int64
+}
+
+// Columns returns the result columns without the window count column
+func (r *windowCountRows) Columns() ([]string, error) {
+	columns, err := r.Rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range columns {
+		if column == windowCountColumn {
+			r.index = i
+			return append(columns[:i:i], columns[i+1:]...), nil
+		}
 	}
+	return columns, nil
+}
 
-	// Apply pagination and get results
-	if err := db.Scopes(GPaginate(m)).Find(result).Error; err != nil {
+// ColumnTypes returns the column types without the window count column
+func (r *windowCountRows) ColumnTypes() ([]*sql.ColumnType, error) {
+	types, err := r.Rows.ColumnTypes()
+	if err != nil || r.index < 0 || r.index >= len(types) {
+		return types, err
+	}
+	return append(types[:r.index:r.index], types[r.index+1:]...), nil
+}
+
+// Scan scans the row, storing the window count column in total
+func (r *windowCountRows) Scan(dest ...interface{}) error {
+	if r.index < 0 {
+		return r.Rows.Scan(dest...)
+	}
+
+	values := make([]interface{}, 0, len(dest)+1)
+	values = append(values, dest[:r.index]...)
+	values = append(values, &r.total)
+	values = append(values, dest[r.index:]...)
+	return r.Rows.Scan(values...)
+}
+
+// DryRunPaginate returns the SQL statement Paginate would run for the data query, without executing it.
+// Bound values are inlined using the dialector's formatting, which makes the result suitable for logging.
+// An empty string is returned when the statement cannot be built.
+//
+// Example:
+//
+//	sql := DryRunPaginate(db.Model(&User{}), metadata)
+//	// SELECT * FROM `users` ORDER BY name asc LIMIT 10 OFFSET 10
+func DryRunPaginate(db *gorm.DB, m *Metadata) string {
+	var rows []map[string]interface{}
+	stmt := db.Session(&gorm.Session{DryRun: true}).Scopes(GPaginate(m)).Find(&rows)
+	if stmt.Error != nil {
+		return ""
+	}
+	return db.Dialector.Explain(stmt.Statement.SQL.String(), stmt.Statement.Vars...)
+}
+
+// applyFilters adds the metadata's filter and search conditions to the query
+func applyFilters(db *gorm.DB, m *Metadata) *gorm.DB {
+	if len(m.Filters) == 0 && m.SearchTerm == "" && !m.fts() {
+		return db
+	}
+
+	var args []any
+	dialect, ok := dialectFromName(db.Dialector.Name())
+	if !ok {
+		dialect = MySQL
+	}
+	condition, err := m.filterCondition(dialect, QuestionPlaceholder, &args)
+	if err != nil {
+		db.AddError(err)
+		return db
+	}
+	return db.Where(condition, args...)
+}
+
+// countRows fills m.TotalRows according to the metadata's count strategy
+func countRows(counter rowCounter, m *Metadata) error {
+	if m.KnownTotal != nil {
+		m.TotalRows = *m.KnownTotal
+		m.resolveFromEnd()
+		return nil
+	}
+
+	total, counted, err := countWith(m.CountMode, counter)
+	if err != nil {
 		return err
 	}
+	if counted {
+		m.TotalRows = total
+		m.resolveFromEnd()
+	}
+	return nil
+}
 
-	// Update metadata with calculated values
+// gormCounter counts the rows of the query exactly, within the count timeout, or from table statistics
+func gormCounter(countDB *gorm.DB, m *Metadata) rowCounter {
+	return rowCounter{
+		exact: func() (int64, error) {
+			count := func() (int64, error) {
+				return withCountTimeout(countDB.Statement.Context, m, func(ctx context.Context) (int64, error) {
+					return countTotal(countDB.WithContext(ctx), m)
+				})
+			}
+			if !m.CountCache.enabled() {
+				return count()
+			}
+
+			signature, err := CountSignature(countDB, m)
+			if err != nil {
+				return count()
+			}
+			return m.CountCache.count(signature, count)
+		},
+		approx: func() (int64, bool) {
+			return approximateCount(countDB)
+		},
+		sql: func() string {
+			return countDB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				var total int64
+				return countQuery(tx, m).Count(&total)
+			})
+		},
+	}
+}
+
+// countTotal counts the rows of the query, using a subquery wrapper for grouped queries
+func countTotal(countDB *gorm.DB, m *Metadata) (int64, error) {
+	var total int64
+	if err := countQuery(countDB, m).Count(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// countQuery applies the filters to the query, wrapping grouped queries in a subquery to count groups
+func countQuery(countDB *gorm.DB, m *Metadata) *gorm.DB {
+	countDB = applyFilters(countDB, m)
+
+	// Count groups instead of rows by wrapping grouped queries in a subquery
+	if _, grouped := countDB.Statement.Clauses["GROUP BY"]; grouped || m.GroupedCount {
+		countDB = countDB.Session(&gorm.Session{NewDB: true}).Table("(?) AS grouped_rows", countDB)
+	}
+
+	// Count selects kept as is by GORM replace COUNT(*)
+	if m.CountExpression != "" {
+		countDB = countDB.Select(m.countExpression())
+	}
+	return countDB
+}
+
+// CountSignature returns the key under which the count of db with the metadata's filters is
+// cached by a CountCache. Write paths pass it to CountCache.InvalidateCount.
+//
+// Example:
+//
+//	signature, err := CountSignature(db.Model(&User{}).Where("active = ?", true), metadata)
+//	countCache.InvalidateCount(signature)
+func CountSignature(db *gorm.DB, m *Metadata) (string, error) {
+	var total int64
+	tx := countQuery(db.Session(&gorm.Session{DryRun: true}), m).Count(&total)
+	if tx.Error != nil {
+		return "", tx.Error
+	}
+	return countSignature(tx.Statement.SQL.String(), tx.Statement.Vars), nil
+}
+
+// CountOnly runs only the count query for db, following the same rules as Paginate
+// (grouped queries, distinct selections, soft deletes and approximate counting),
+// and updates m.TotalRows and the derived fields. No rows are fetched.
+// CountNone and CountWindow are treated as an exact count, since counting is the whole point.
+//
+// Example:
+//
+//	total, err := CountOnly(ctx, db.Model(&User{}).Where("active = ?", true), metadata)
+//	// metadata.TotalPages reflects total
+func CountOnly(ctx context.Context, db *gorm.DB, m *Metadata) (int64, error) {
+	if err := m.Validate().Err(); err != nil {
+		return 0, err
+	}
+
+	// Counting is the whole point, so strategies that skip the COUNT query count exactly
+	strategy := m.CountMode
+	if strategy == CountNone || strategy == CountWindow {
+		strategy = CountExact
+	}
+
+	total, _, err := countWith(strategy, gormCounter(db.WithContext(ctx), m))
+	if err != nil {
+		return 0, err
+	}
+
+	m.TotalRows = total
 	m.ValidateAndSetDefaults()
+	return total, nil
+}
+
+// approximateCount reads the estimated row count of the query's table from the database statistics.
+// Filters are not taken into account. Returns false when no estimate is available.
+func approximateCount(db *gorm.DB) (int64, bool) {
+	stmt := db.Session(&gorm.Session{}).Statement
+	if stmt.Table == "" && stmt.Model != nil {
+		if err := stmt.Parse(stmt.Model); err != nil {
+			return 0, false
+		}
+	}
+	if stmt.Table == "" {
+		return 0, false
+	}
+
+	var estimate int64
+	raw := db.Session(&gorm.Session{NewDB: true})
+	switch db.Dialector.Name() {
+	case "postgres":
+		raw = raw.Raw("SELECT reltuples::bigint FROM pg_class WHERE relname = ?", stmt.Table).Scan(&estimate)
+	case "mysql":
+		raw = raw.Raw("SELECT table_rows FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", stmt.Table).Scan(&estimate)
+	default:
+		return 0, false
+	}
 
-	// Encode cursor for next page if using cursor-based pagination
-	if m.IsCursorBased() && m.HasNext {
-		resultValue := reflect.ValueOf(result).Elem()
-		if resultValue.Len() > 0 {
-			lastItem := resultValue.Index(resultValue.Len() - 1).Interface()
-			lastItemValue := reflect.ValueOf(lastItem)
-			cursorData := map[string]interface{}{
-				"id":   lastItemValue.FieldByName("ID").Interface(),
-				"name": lastItemValue.FieldByName("Name").Interface(),
-				"page": m.Page,
+	// PostgreSQL reports -1 for tables that were never analyzed
+	if raw.Error != nil || estimate < 0 {
+		return 0, false
+	}
+	return estimate, true
+}
+
+// trimExtraRow removes the extra row fetched beyond the limit and reports whether it existed
+func trimExtraRow(result interface{}, limit int) bool {
+	resultValue := reflect.Indirect(reflect.ValueOf(result))
+	if resultValue.Kind() != reflect.Slice || resultValue.Len() <= limit {
+		return false
+	}
+	resultValue.Set(resultValue.Slice(0, limit))
+	return true
+}
+
+// reverseRows reverses the rows of a slice result in place
+func reverseRows(result interface{}) {
+	resultValue := reflect.Indirect(reflect.ValueOf(result))
+	if resultValue.Kind() != reflect.Slice {
+		return
+	}
+	swap := reflect.Swapper(resultValue.Interface())
+	for i, j := 0, resultValue.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
+
+// setDetectedMetadata fills the navigation fields from the extra-row detection
+func setDetectedMetadata(m *Metadata, rows int, hasMore bool) {
+	m.HasNext = hasMore
+	if m.IsCursorBased() && m.backward() {
+		// Backward pages end at the Before cursor's row, and the extra row precedes them
+		m.HasNext, m.HasPrevious = true, hasMore
+		return
+	}
+	if m.IsCursorBased() {
+		m.HasPrevious = m.Cursor != "" || m.After != ""
+		return
+	}
+
+	m.HasPrevious = m.GetOffset() > 0
+	if rows > 0 {
+		m.FromRow = int64(m.GetOffset() + 1)
+		m.ToRow = int64(m.GetOffset() + rows)
+	}
+}
+
+// Cursorable is implemented by result types that provide their own cursor values.
+// When the last row of a page implements it, the next cursor is built from
+// CursorValue instead of reading the field through reflection.
+//
+// Example:
+//
+//	func (u User) CursorValue(field string) any {
+//	  if field == "created_at" {
+//	    return u.CreatedAt.UnixNano()
+//	  }
+//	  return u.ID
+//	}
+type Cursorable interface {
+	CursorValue(field string) any
+}
+
+// cursorValueAt extracts the cursor field value from the element of result at index,
+// where negative indexes count from the end
+func cursorValueAt(tx *gorm.DB, result interface{}, index int, field string) (interface{}, bool) {
+	resultValue := reflect.Indirect(reflect.ValueOf(result))
+	if resultValue.Kind() != reflect.Slice || resultValue.Len() == 0 {
+		return nil, false
+	}
+	if index < 0 {
+		index += resultValue.Len()
+	}
+	if index < 0 || index >= resultValue.Len() {
+		return nil, false
+	}
+
+	item := resultValue.Index(index)
+	if cursorable, ok := item.Interface().(Cursorable); ok {
+		return cursorable.CursorValue(field), true
+	}
+	if item.CanAddr() {
+		if cursorable, ok := item.Addr().Interface().(Cursorable); ok {
+			return cursorable.CursorValue(field), true
+		}
+	}
+
+	// Map rows hold the column directly
+	if row, ok := item.Interface().(map[string]interface{}); ok {
+		for _, name := range cursorColumnNames(field) {
+			if value, found := row[name]; found {
+				return value, true
 			}
-			m.Cursor = encodeCursor(cursorData)
 		}
+		return nil, false
 	}
 
-	// Add debug information
-	if m.Debug {
-		fmt.Printf("Query: %s\n", rawSQL)
-		fmt.Printf("Query time: %v\n", time.Since(startTime))
-		fmt.Printf("Total rows: %d\n", m.TotalRows)
-		fmt.Printf("Total pages: %d\n", m.TotalPages)
+	// Fall back to reading the column through the model schema
+	if tx.Statement.Schema == nil {
+		return nil, false
 	}
+	for _, name := range cursorColumnNames(field) {
+		if schemaField := tx.Statement.Schema.LookUpField(name); schemaField != nil {
+			value, _ := schemaField.ValueOf(tx.Statement.Context, reflect.Indirect(item))
+			return value, true
+		}
+	}
+	return nil, false
+}
 
-	return nil
+// cursorColumnNames returns the names a cursor field is scanned under: the field itself and,
+// for a field qualified by its table such as orders.created_at, the alias orders_created_at
+// and the bare column created_at
+func cursorColumnNames(field string) []string {
+	table, column, ok := strings.Cut(field, ".")
+	if !ok {
+		return []string{field}
+	}
+	return []string{field, table + "_" + column, column}
 }
 
-// applyCursorPagination applies cursor-based pagination to the query
-func applyCursorPagination(db *gorm.DB, m *Metadata) *gorm.DB {
-	if m.Cursor == "" {
-		// First page
-		return db.Limit(m.GetLimit())
+// cursorKeyAt extracts the cursor value of the element of result at index, paired with
+// its tie-break value when a tie-break column is set
+func (m *Metadata) cursorKeyAt(tx *gorm.DB, result interface{}, index int) (interface{}, bool) {
+	value, ok := cursorValueAt(tx, result, index, m.CursorField)
+	if !ok || m.CursorTieBreak == "" {
+		return value, ok
+	}
+
+	tieBreak, ok := cursorValueAt(tx, result, index, m.CursorTieBreak)
+	if !ok {
+		return nil, false
 	}
+	return []interface{}{value, tieBreak}, true
+}
 
-	// Decode cursor
-	cursorValue, err := decodeCursor(m.Cursor)
+// applyCursorPagination applies cursor-based pagination to the query
+func applyCursorPagination(db *gorm.DB, m *Metadata, limit int) *gorm.DB {
+	var args []any
+	condition, err := m.cursorCondition(QuestionPlaceholder, &args)
 	if err != nil {
+		_ = db.AddError(err)
 		return db
 	}
 
-	// Apply cursor condition
-	operator := ">"
-	if m.CursorOrder == "desc" {
-		operator = "<"
+	// First page has no cursor condition
+	if condition != "" {
+		db = db.Where(condition, args...)
 	}
-
-	condition := fmt.Sprintf("%s %s ?", m.CursorField, operator)
-	return db.Where(condition, cursorValue).Limit(m.GetLimit())
+	return db.Limit(limit)
 }
 
 // encodeCursor encodes a value into a cursor string
 func encodeCursor(value interface{}) string {
-	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%v", value)))
+	data, err := json.Marshal(value)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%v", value))
+	}
+	return base64.StdEncoding.EncodeToString(data)
 }
 
-// decodeCursor decodes a cursor string back to its original value
-func decodeCursor(cursor string) (string, error) {
+// decodeCursor decodes a cursor string back to its original value.
+// Cursors that don't contain JSON are returned as plain strings.
+func decodeCursor(cursor string) (interface{}, error) {
 	decoded, err := base64.StdEncoding.DecodeString(cursor)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return string(decoded), nil
+	return decodeCursorData(decoded)
+}
+
+// decodeCursorData decodes the JSON payload of a cursor, returning non-JSON data as a plain string
+func decodeCursorData(decoded []byte) (interface{}, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(decoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return string(decoded), nil
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return string(decoded), nil
+	}
+
+	return jsonNumberValue(value)
+}
+
+// jsonNumberValue converts a decoded json.Number to int64, keeping integers exact, or float64.
+// Other values are returned unchanged.
+func jsonNumberValue(value interface{}) (interface{}, error) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value, nil
+	}
+	if i, err := number.Int64(); err == nil {
+		return i, nil
+	}
+	f, err := number.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 // ApplyOptimizationsToGorm applies query optimizations to a GORM query
@@ -214,10 +1036,10 @@ func (q *QueryOptimizer) ApplyOptimizationsToGorm(db *gorm.DB) *gorm.DB {
 		// instead of manually adding SQL fragments that might break syntax
 		switch db.Dialector.Name() {
 		case "mysql":
-			optimizedDB = optimizedDB.Clauses(gorm.Expr("USE INDEX (idx_created_at)"))
+			optimizedDB = optimizedDB.Clauses(gorm.Expr("USE INDEX (" + hintedIndex + ")"))
 		case "postgres":
 			// PostgreSQL uses a different syntax for index hints
-			optimizedDB = optimizedDB.Clauses(gorm.Expr("/*+ IndexScan(table_name idx_created_at) */"))
+			optimizedDB = optimizedDB.Clauses(gorm.Expr("/*+ IndexScan(table_name " + hintedIndex + ") */"))
 		}
 	}
 
@@ -242,14 +1064,88 @@ func (q *QueryOptimizer) ApplyOptimizationsToGorm(db *gorm.DB) *gorm.DB {
 		optimizedDB = optimizedDB.Limit(q.MaxRows)
 	}
 
+	// Prepend the query tag comment to the SELECT statement
+	if comment := queryComment(q.QueryTag); comment != "" {
+		optimizedDB = optimizedDB.Clauses(selectComment(comment))
+	}
+
 	return optimizedDB
 }
 
-// OptimizedPaginate applies query optimization and pagination to a GORM query
+// selectComment is a SQL comment written before the SELECT clause of a statement
+type selectComment string
+
+// ModifyStatement places the comment before the SELECT clause
+func (c selectComment) ModifyStatement(stmt *gorm.Statement) {
+	selectClause := stmt.Clauses["SELECT"]
+	selectClause.BeforeExpression = c
+	stmt.Clauses["SELECT"] = selectClause
+}
+
+// Build writes the comment
+func (c selectComment) Build(builder clause.Builder) {
+	builder.WriteString(string(c))
+}
+
+// OptimizedPaginate applies query optimization and pagination to a GORM query.
+// The optimizer's MaxRows caps the page like WithMaxRows, unless the metadata sets a lower cap,
+// and metadata.Truncated reports a capped page size.
+// In debug mode a mismatch between the index hint and the order is printed (see IndexHintWarning).
 func OptimizedPaginate(db *gorm.DB, metadata *Metadata, optimizer *QueryOptimizer, dest interface{}) error {
+	// Debug: warn about an index hint that doesn't match the order
+	if metadata.Debug {
+		if warning := optimizer.IndexHintWarning(metadata); warning != "" {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+	}
+
+	// Cap the page at the optimizer's row budget, which the page limit would otherwise replace
+	if optimizer.MaxRows > 0 && (metadata.MaxRows <= 0 || optimizer.MaxRows < metadata.MaxRows) {
+		metadata.MaxRows = optimizer.MaxRows
+	}
+
 	// Apply query optimizations
 	optimizedDB := optimizer.ApplyOptimizationsToGorm(db)
 
 	// Apply pagination
 	return Paginate(optimizedDB, metadata, dest)
 }
+
+// OptimizedPaginateInBatches applies query optimizations and processes every matching row in
+// batches of the optimizer's BatchSize, calling fn once per batch with dest holding its rows.
+// Rows are walked in primary key order, so the metadata's sort is not applied; its filters, search
+// and field selection are, so batches hold the rows the paginated endpoint would list. The optimizer's
+// MaxRows cap is not applied, since every matching row is processed.
+// It returns the number of rows processed and leaves the metadata's pagination fields unchanged.
+//
+// Example:
+//
+//	var users []User
+//	processed, err := OptimizedPaginateInBatches(db.Model(&User{}), metadata, optimizer, &users, func(tx *gorm.DB, batch int) error {
+//	  return sendNewsletter(users)
+//	})
+func OptimizedPaginateInBatches(db *gorm.DB, m *Metadata, optimizer *QueryOptimizer, dest interface{}, fn func(tx *gorm.DB, batch int) error) (int64, error) {
+	if err := m.Validate().Err(); err != nil {
+		return 0, err
+	}
+
+	// Fall back to the page size when no batch size is configured
+	batchSize := optimizer.BatchSize
+	if batchSize <= 0 {
+		batchSize = m.GetLimit()
+	}
+
+	batchOptimizer := *optimizer
+	batchOptimizer.MaxRows = 0
+	optimizedDB := batchOptimizer.ApplyOptimizationsToGorm(db)
+	if len(m.SelectedFields) > 0 && m.SelectedFields[0] != "*" {
+		optimizedDB = optimizedDB.Select(m.SelectedFields)
+	}
+	optimizedDB = applyFilters(optimizedDB, m)
+	if optimizedDB.Error != nil {
+		return 0, optimizedDB.Error
+	}
+
+	result := optimizedDB.FindInBatches(dest, batchSize, fn)
+	return result.RowsAffected, result.Error
+}
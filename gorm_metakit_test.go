@@ -1,7 +1,12 @@
 package metakit
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -26,6 +31,63 @@ func TestSortDirectionParams(t *testing.T) {
 	}
 }
 
+func TestSortDirectionAliases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"asc", "asc"},
+		{"ASC", "asc"},
+		{"ascending", "asc"},
+		{"Ascending", "asc"},
+		{"+", "asc"},
+		{"1", "asc"},
+		{"desc", "desc"},
+		{"DESC", "desc"},
+		{"descending", "desc"},
+		{"-", "desc"},
+		{"-1", "desc"},
+		{" desc ", "desc"},
+	}
+
+	for _, test := range tests {
+		metadata := NewMetadata().WithSort("id").WithSortDirection(test.input)
+		result := metadata.Validate()
+		assert.True(t, result.IsValid, "sort direction %q", test.input)
+		assert.Equal(t, test.expected, metadata.SortDirection, "sort direction %q", test.input)
+
+		metadata = NewMetadata().WithSortDirection(test.input)
+		metadata.ValidateAndSetDefaults()
+		assert.Equal(t, test.expected, metadata.SortDirection, "sort direction %q", test.input)
+
+		metadata = NewMetadata().WithCursorField("id").WithCursorOrder(test.input)
+		assert.True(t, metadata.Validate().IsValid, "cursor order %q", test.input)
+		assert.Equal(t, test.expected, metadata.CursorOrder, "cursor order %q", test.input)
+	}
+
+	metadata := NewMetadata().WithSortDirection("sideways")
+	assert.False(t, metadata.Validate().IsValid)
+	metadata.ValidateAndSetDefaults()
+	assert.Equal(t, "asc", metadata.SortDirection)
+}
+
+func TestAppliedSort(t *testing.T) {
+	metadata := NewMetadata().WithSort("name").WithSortDirection("sideways")
+	metadata.ValidateAndSetDefaults()
+	assert.Equal(t, "name", metadata.AppliedSort)
+	assert.Equal(t, "asc", metadata.AppliedDirection)
+
+	metadata = NewMetadata().WithSort("name").WithSortDirection("DESC")
+	metadata.ValidateAndSetDefaults()
+	assert.Equal(t, "desc", metadata.AppliedDirection)
+
+	// Cursor pages are ordered by the cursor field
+	metadata = NewMetadata().WithSort("name").WithCursorField("id")
+	metadata.ValidateAndSetDefaults()
+	assert.Equal(t, "id", metadata.AppliedSort)
+	assert.Equal(t, "asc", metadata.AppliedDirection)
+}
+
 func TestSortParams(t *testing.T) {
 	m := Metadata{}
 	sort := "name"
@@ -257,6 +319,38 @@ func TestCustomCountQuery(t *testing.T) {
 	assert.Equal(t, int64(2), metadata.TotalRows)
 }
 
+func TestPaginateWithCountFunc(t *testing.T) {
+	db := setupTestDB(t)
+
+	calls := 0
+	countFn := func() (int64, error) {
+		calls++
+		return 42, nil
+	}
+
+	metadata := NewMetadata().WithPage(2).WithPageSize(10)
+	var users []User
+	err := PaginateWithCountFunc(db.Model(&User{}), metadata, &users, countFn)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(42), metadata.TotalRows)
+	assert.Equal(t, int64(5), metadata.TotalPages)
+	assert.True(t, metadata.HasNext)
+	assert.True(t, metadata.HasPrevious)
+
+	// Count errors abort the pagination
+	countErr := errors.New("count unavailable")
+	err = PaginateWithCountFunc(db.Model(&User{}), NewMetadata(), &users, func() (int64, error) {
+		return 0, countErr
+	})
+	assert.True(t, errors.Is(err, countErr))
+
+	// Skipped counts don't call the function
+	err = PaginateWithCountFunc(db.Model(&User{}), NewMetadata().WithCountMode(CountNone), &users, countFn)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
 func TestFieldSelection(t *testing.T) {
 	db := setupTestDB(t)
 
@@ -341,3 +435,1241 @@ func TestDebugMode(t *testing.T) {
 	// Check that we still get results with debug enabled
 	assert.Equal(t, 2, len(users))
 }
+
+// recordQueries registers a callback that collects every SQL statement executed by db
+func recordQueries(t *testing.T, db *gorm.DB) *[]string {
+	var queries []string
+	err := db.Callback().Query().After("gorm:query").Register("test:record_queries", func(tx *gorm.DB) {
+		queries = append(queries, tx.Statement.SQL.String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &queries
+}
+
+func TestCountModeNone(t *testing.T) {
+	db := setupTestDB(t)
+	queries := recordQueries(t, db)
+
+	metadata := NewMetadata().
+		WithPageSize(2).
+		WithSort("id").
+		WithCursorField("id").
+		WithCountMode(CountNone)
+
+	// First page: 5 users, so more rows exist
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.True(t, metadata.HasNext)
+	assert.Equal(t, int64(0), metadata.TotalRows)
+	assert.NotEmpty(t, metadata.Cursor)
+
+	// Second page continues after the last id of the first page
+	users = nil
+	err = Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, uint(3), users[0].ID)
+	assert.True(t, metadata.HasNext)
+
+	// Last page holds the remaining row only
+	users = nil
+	err = Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(users))
+	assert.False(t, metadata.HasNext)
+
+	// No count query should have been executed
+	for _, query := range *queries {
+		assert.NotContains(t, strings.ToLower(query), "count(")
+	}
+	assert.Equal(t, 3, len(*queries))
+}
+
+func TestCountModeNoneOffset(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().
+		WithPage(2).
+		WithPageSize(2).
+		WithSort("id").
+		WithCountMode(CountNone)
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.True(t, metadata.HasNext)
+	assert.True(t, metadata.HasPrevious)
+	assert.Equal(t, int64(3), metadata.FromRow)
+	assert.Equal(t, int64(4), metadata.ToRow)
+}
+
+func TestGroupedCount(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Add users sharing ages with existing ones: 5 distinct ages across 8 users
+	for _, user := range []User{
+		{Name: "Dave Miller", Email: "dave@example.com", Age: 30},
+		{Name: "Eve Davis", Email: "eve@example.com", Age: 25},
+		{Name: "Frank White", Email: "frank@example.com", Age: 30},
+	} {
+		assert.NoError(t, db.Create(&user).Error)
+	}
+
+	type ageGroup struct {
+		Age   int
+		Total int
+	}
+
+	metadata := NewMetadata().
+		WithPage(1).
+		WithPageSize(2).
+		WithSort("age")
+
+	var groups []ageGroup
+	query := db.Model(&User{}).Select("age, count(*) AS total").Group("age")
+	err := Paginate(query, metadata, &groups)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), metadata.TotalRows)
+	assert.Equal(t, int64(3), metadata.TotalPages)
+	assert.Equal(t, 2, len(groups))
+	assert.Equal(t, ageGroup{Age: 25, Total: 2}, groups[0])
+
+	// Explicit subquery counting yields the same result
+	metadata = NewMetadata().WithPageSize(2).WithSort("age").WithGroupedCount(true)
+	groups = nil
+	err = PaginateWithCount(query, db.Model(&User{}).Select("age").Distinct("age"), metadata, &groups)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), metadata.TotalRows)
+}
+
+func TestMixedPaginationMode(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Cursor with a page number is a client bug
+	metadata := NewMetadata().
+		WithPage(3).
+		WithCursorField("id").
+		WithCursor(encodeCursor(2))
+
+	validation := metadata.Validate()
+	assert.False(t, validation.IsValid)
+	assert.Equal(t, 1, len(validation.Errors))
+	assert.Equal(t, "page", validation.Errors[0].Field)
+	assert.Equal(t, "MIXED_PAGINATION_MODE", validation.Errors[0].Code)
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.Error(t, err)
+
+	// Default page with a cursor is accepted
+	metadata = NewMetadata().WithCursorField("id").WithCursor(encodeCursor(2))
+	assert.True(t, metadata.Validate().IsValid)
+
+	// Page without cursor fields is plain offset pagination
+	metadata = NewMetadata().WithPage(3)
+	assert.True(t, metadata.Validate().IsValid)
+}
+
+func TestWithOffset(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().
+		WithPage(1).
+		WithPageSize(2).
+		WithSort("id").
+		WithOffset(3)
+
+	// Explicit offset overrides the page-derived one
+	assert.Equal(t, 3, metadata.GetOffset())
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, uint(4), users[0].ID)
+	assert.Equal(t, int64(4), metadata.FromRow)
+	assert.Equal(t, int64(5), metadata.ToRow)
+	assert.True(t, metadata.HasPrevious)
+	assert.False(t, metadata.HasNext)
+
+	// Negative offsets are rejected
+	validation := NewMetadata().WithOffset(-1).Validate()
+	assert.False(t, validation.IsValid)
+	assert.Equal(t, "OFFSET_NEGATIVE", validation.Errors[0].Code)
+}
+
+func TestCursorWindow(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().
+		WithPageSize(10).
+		WithSort("id").
+		WithCursorField("id").
+		WithCursorOrder("asc").
+		WithAfter(encodeCursor(1)).
+		WithBefore(encodeCursor(5))
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(users))
+	assert.Equal(t, uint(2), users[0].ID)
+	assert.Equal(t, uint(4), users[2].ID)
+
+	// SQL path applies both bounds as well
+	query, args, err := buildCursorQuery("SELECT * FROM users", metadata, SQLite, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM users WHERE id > ? AND id < ? ORDER BY id asc LIMIT ?", query)
+	assert.Equal(t, []any{int64(1), int64(5), 10}, args)
+
+	// Bounds of different types are rejected
+	metadata.WithBefore(encodeCursor("John Doe"))
+	validation := metadata.Validate()
+	assert.False(t, validation.IsValid)
+	assert.Equal(t, "CURSOR_TYPE_MISMATCH", validation.Errors[0].Code)
+}
+
+// cursorUser provides its own cursor value instead of relying on reflection
+type cursorUser struct {
+	ID   uint
+	Name string
+	Age  int
+}
+
+func (cursorUser) TableName() string {
+	return "users"
+}
+
+func (u cursorUser) CursorValue(field string) any {
+	// Encode age as the cursor regardless of the requested field
+	return u.Age
+}
+
+func TestCursorableInterface(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().
+		WithPageSize(2).
+		WithSort("age").
+		WithCursorField("age")
+
+	var users []cursorUser
+	err := Paginate(db.Model(&cursorUser{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.True(t, metadata.HasNext)
+
+	value, err := decodeCursor(metadata.Cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(users[1].Age), value)
+
+	// The next page continues after the provided cursor value
+	users = nil
+	err = Paginate(db.Model(&cursorUser{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, users[0].Age)
+}
+
+func TestDryRunPaginate(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().
+		WithPage(2).
+		WithPageSize(2).
+		WithSort("name")
+	assert.Equal(t, "SELECT * FROM `users` ORDER BY name asc LIMIT 2 OFFSET 2", DryRunPaginate(db.Model(&User{}), metadata))
+
+	metadata = NewMetadata().
+		WithPageSize(3).
+		WithCursorField("id").
+		WithCursor(encodeCursor(2))
+	assert.Equal(t, "SELECT * FROM `users` WHERE id > 2 ORDER BY id asc LIMIT 3", DryRunPaginate(db.Model(&User{}), metadata))
+}
+
+func TestOptimizedPaginateInBatches(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&User{}))
+
+	users := make([]User, 1000)
+	for i := range users {
+		users[i] = User{Name: "Batch User", Email: "batch@example.com", Age: i % 50}
+	}
+	assert.NoError(t, db.CreateInBatches(users, 250).Error)
+
+	optimizer := NewQueryOptimizer().WithBatchSize(200)
+	optimizer.UseIndexHint = false
+
+	var batch []User
+	batches, processed := 0, 0
+	total, err := OptimizedPaginateInBatches(db.Model(&User{}), NewMetadata(), optimizer, &batch, func(tx *gorm.DB, n int) error {
+		batches++
+		processed += len(batch)
+		assert.Equal(t, 200, len(batch))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, batches)
+	assert.Equal(t, 1000, processed)
+	assert.Equal(t, int64(1000), total)
+
+	// Filters exclude rows, and the optimizer's row cap doesn't cut the run short
+	optimizer.MaxRows = 300
+	metadata := NewMetadata().WithFilter("age", FilterLt, 10)
+	batches, processed = 0, 0
+	total, err = OptimizedPaginateInBatches(db.Model(&User{}), metadata, optimizer, &batch, func(tx *gorm.DB, n int) error {
+		batches++
+		processed += len(batch)
+		for _, user := range batch {
+			assert.Less(t, user.Age, 10)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, batches)
+	assert.Equal(t, 200, processed)
+	assert.Equal(t, int64(200), total)
+
+	// The pagination fields keep their meaning
+	assert.Equal(t, int64(0), metadata.TotalRows)
+	assert.Equal(t, int64(0), metadata.TotalPages)
+	assert.False(t, metadata.HasNext)
+
+	batches, processed = 0, 0
+	_, err = OptimizedPaginateInBatches(db.Model(&User{}), NewMetadata(), optimizer, &batch, func(tx *gorm.DB, n int) error {
+		batches++
+		processed += len(batch)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, processed)
+}
+
+func TestCountOnly(t *testing.T) {
+	db := setupTestDB(t)
+	queries := recordQueries(t, db)
+
+	metadata := NewMetadata().WithPageSize(2).WithCountMode(CountNone)
+	total, err := CountOnly(context.Background(), db.Model(&User{}).Where("age >= ?", 28), metadata)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Equal(t, int64(4), metadata.TotalRows)
+	assert.Equal(t, int64(2), metadata.TotalPages)
+	assert.True(t, metadata.HasNext)
+
+	// Only the count query ran
+	assert.Equal(t, 1, len(*queries))
+	assert.Contains(t, strings.ToLower((*queries)[0]), "count(")
+
+	// Soft-deleted rows are excluded like in Paginate
+	assert.NoError(t, db.AutoMigrate(&softUser{}))
+	assert.NoError(t, db.Create(&[]softUser{{Name: "a"}, {Name: "b"}, {Name: "c"}}).Error)
+	assert.NoError(t, db.Delete(&softUser{}, 1).Error)
+	total, err = CountOnly(context.Background(), db.Model(&softUser{}), NewMetadata())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+}
+
+// softUser is a model with soft delete support
+type softUser struct {
+	ID        uint
+	Name      string
+	DeletedAt gorm.DeletedAt
+}
+
+func TestKnownTotal(t *testing.T) {
+	db := setupTestDB(t)
+	queries := recordQueries(t, db)
+
+	metadata := NewMetadata().
+		WithPage(2).
+		WithPageSize(2).
+		WithSort("id").
+		WithKnownTotal(42)
+
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), metadata.TotalRows)
+	assert.Equal(t, int64(21), metadata.TotalPages)
+	assert.True(t, metadata.HasNext)
+	assert.Equal(t, int64(3), metadata.FromRow)
+
+	// A known total of zero is respected as well
+	metadata = NewMetadata().WithKnownTotal(0)
+	users = nil
+	err = PaginateWithCount(db.Model(&User{}), db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), metadata.TotalRows)
+	assert.False(t, metadata.HasNext)
+
+	// No count query was executed
+	for _, query := range *queries {
+		assert.NotContains(t, strings.ToLower(query), "count(")
+	}
+	assert.Equal(t, 2, len(*queries))
+}
+
+func TestCursorHasNextAtBoundary(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&User{}))
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, db.Create(&User{Name: "Boundary User", Age: i}).Error)
+	}
+
+	metadata := NewMetadata().
+		WithPageSize(10).
+		WithSort("id").
+		WithCursorField("id")
+
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, 10, len(users))
+	assert.True(t, metadata.HasNext)
+	assert.False(t, metadata.HasPrevious)
+
+	// Second page ends exactly at the last row
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, 10, len(users))
+	assert.Equal(t, uint(20), users[9].ID)
+	assert.False(t, metadata.HasNext)
+	assert.True(t, metadata.HasPrevious)
+	assert.Equal(t, int64(20), metadata.TotalRows)
+}
+
+func TestItemsOnPage(t *testing.T) {
+	db := setupTestDB(t)
+
+	// The last page holds only one of the five users
+	metadata := NewMetadata().WithPage(3).WithPageSize(2).WithSort("id")
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), metadata.ItemsOnPage())
+	assert.Equal(t, int64(len(users)), metadata.ItemsOnPage())
+
+	// Full pages hold PageSize items
+	metadata = NewMetadata().WithPage(1).WithPageSize(2).WithSort("id")
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, int64(2), metadata.ItemsOnPage())
+
+	// Pages past the end are empty
+	metadata = NewMetadata().WithPage(4).WithPageSize(2).WithSort("id")
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, int64(0), metadata.ItemsOnPage())
+
+	assert.Equal(t, int64(0), NewMetadata().ItemsOnPage())
+}
+
+func TestPaginateMap(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithPageSize(2).WithFields("id", "name").WithSort("id")
+	rows, err := PaginateMap(db.Model(&User{}), metadata)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, int64(5), metadata.TotalRows)
+	for _, row := range rows {
+		assert.Equal(t, 2, len(row))
+		assert.Contains(t, row, "id")
+		assert.Contains(t, row, "name")
+	}
+	assert.Equal(t, "John Doe", rows[0]["name"])
+
+	// Cursor pages read the next cursor from the map rows
+	metadata = NewMetadata().WithPageSize(2).WithCursorField("id")
+	rows, err = PaginateMap(db.Table("users"), metadata)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rows))
+	assert.True(t, metadata.HasNext)
+	assert.NotEmpty(t, metadata.Cursor)
+}
+
+func TestLimitWithoutDefaults(t *testing.T) {
+	metadata := &Metadata{}
+	assert.Equal(t, 10, metadata.GetLimit())
+	assert.Equal(t, 0, metadata.GetOffset())
+
+	metadata = &Metadata{Page: 3, PageSize: 500}
+	assert.Equal(t, 100, metadata.GetLimit())
+	assert.Equal(t, 200, metadata.GetOffset())
+
+	metadata = &Metadata{PageSize: -5}
+	metadata.WithOffset(-10)
+	assert.Equal(t, 10, metadata.GetLimit())
+	assert.Equal(t, 0, metadata.GetOffset())
+}
+
+func TestCursorSettingsInference(t *testing.T) {
+	metadata := NewMetadata().WithSort("created_at").WithSortDirection("desc").WithCursor(encodeCursor(10))
+	metadata.ValidateAndSetDefaults()
+	assert.Equal(t, "created_at", metadata.CursorField)
+	assert.Equal(t, "desc", metadata.CursorOrder)
+
+	metadata = NewMetadata().WithSort("created_at").WithCursorOrder("desc")
+	assert.True(t, metadata.IsCursorBased())
+	assert.True(t, metadata.Validate().IsValid)
+	assert.Equal(t, "created_at", metadata.CursorField)
+
+	// Explicit cursor settings take precedence
+	metadata = NewMetadata().WithSort("name").WithSortDirection("desc").WithCursorField("id")
+	metadata.ValidateAndSetDefaults()
+	assert.Equal(t, "id", metadata.CursorField)
+	assert.Equal(t, "", metadata.CursorOrder)
+
+	// Offset pagination is unaffected
+	metadata = NewMetadata().WithSort("name")
+	metadata.ValidateAndSetDefaults()
+	assert.False(t, metadata.IsCursorBased())
+	assert.Equal(t, "", metadata.CursorField)
+}
+
+func TestRowRangeBeyondData(t *testing.T) {
+	metadata := NewMetadata().WithPage(5).WithPageSize(10)
+	metadata.TotalRows = 25
+	metadata.ValidateAndSetDefaults()
+	assert.Equal(t, int64(25), metadata.FromRow)
+	assert.Equal(t, int64(25), metadata.ToRow)
+	assert.False(t, metadata.HasNext)
+	assert.Equal(t, int64(0), metadata.ItemsOnPage())
+
+	// The last page keeps its regular range
+	metadata = NewMetadata().WithPage(3).WithPageSize(10)
+	metadata.TotalRows = 25
+	metadata.ValidateAndSetDefaults()
+	assert.Equal(t, int64(21), metadata.FromRow)
+	assert.Equal(t, int64(25), metadata.ToRow)
+}
+
+func TestCountTimeout(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Simulate a slow count that only returns once its context is canceled
+	err := db.Callback().Query().Before("gorm:query").Register("test:slow_count", func(tx *gorm.DB) {
+		if _, isCount := tx.Statement.Dest.(*int64); isCount {
+			<-tx.Statement.Context.Done()
+			_ = tx.AddError(tx.Statement.Context.Err())
+		}
+	})
+	assert.NoError(t, err)
+
+	metadata := NewMetadata().WithPageSize(2).WithSort("id").WithCountTimeout(10 * time.Millisecond)
+	var users []User
+	err = Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), metadata.TotalRows)
+	assert.Equal(t, 2, len(users))
+	assert.True(t, metadata.HasNext)
+
+	// The last page is detected without a total
+	metadata = NewMetadata().WithPage(3).WithPageSize(2).WithSort("id").WithCountTimeout(10 * time.Millisecond)
+	users = nil
+	err = Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(users))
+	assert.False(t, metadata.HasNext)
+	assert.True(t, metadata.HasPrevious)
+}
+
+func TestScopeWithPriorConditions(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithPageSize(2).WithSort("age")
+	var users []User
+	err := Paginate(db.Model(&User{}).Where("age > ?", 28), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), metadata.TotalRows)
+	assert.Equal(t, int64(2), metadata.TotalPages)
+	assert.Equal(t, []int{30, 32}, []int{users[0].Age, users[1].Age})
+
+	// The scope composes with conditions on its own
+	users = nil
+	metadata = NewMetadata().WithPage(2).WithPageSize(2).WithSort("age")
+	err = db.Model(&User{}).Where("age > ?", 28).Scopes(metadata.Scope()).Find(&users).Error
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, 35, users[0].Age)
+}
+
+func TestCountStrategies(t *testing.T) {
+	db := setupTestDB(t)
+
+	tests := []struct {
+		strategy      CountStrategy
+		expectedTotal int64
+		countQuery    bool
+	}{
+		{CountExact, 5, true},
+		{CountApprox, 5, true},
+		{CountNone, 0, false},
+		{CountWindow, 5, false},
+	}
+
+	queries := recordQueries(t, db)
+	for _, test := range tests {
+		*queries = nil
+		metadata := NewMetadata().WithPageSize(2).WithSort("id").WithCountStrategy(test.strategy)
+		var users []User
+		err := Paginate(db.Model(&User{}), metadata, &users)
+		assert.NoError(t, err, "strategy %d", test.strategy)
+		assert.Equal(t, 2, len(users), "strategy %d", test.strategy)
+		assert.Equal(t, "John Doe", users[0].Name, "strategy %d", test.strategy)
+		assert.Equal(t, test.expectedTotal, metadata.TotalRows, "strategy %d", test.strategy)
+		assert.True(t, metadata.HasNext, "strategy %d", test.strategy)
+
+		counted := false
+		for _, query := range *queries {
+			if strings.Contains(query, "SELECT count(*)") {
+				counted = true
+			}
+		}
+		assert.Equal(t, test.countQuery, counted, "strategy %d", test.strategy)
+	}
+
+	// The window count honors filters and field selection
+	metadata := NewMetadata().WithPageSize(2).WithSort("id").WithFields("id", "name").
+		WithFilter("age", FilterGte, 30).WithCountStrategy(CountWindow)
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), metadata.TotalRows)
+	assert.Equal(t, int64(2), metadata.TotalPages)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, 0, users[0].Age)
+	assert.NotEmpty(t, users[0].Name)
+}
+
+func TestMaxRows(t *testing.T) {
+	db := setupTestDB(t)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, db.Create(&User{Name: "Extra", Age: 40 + i}).Error)
+	}
+
+	metadata := NewMetadata().WithPageSize(50).WithSort("id").WithMaxRows(5)
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(users))
+	assert.True(t, metadata.Truncated)
+	assert.Equal(t, 50, metadata.PageSize)
+	assert.Equal(t, int64(10), metadata.TotalRows)
+	assert.Equal(t, int64(2), metadata.TotalPages)
+	assert.True(t, metadata.HasNext)
+	assert.Equal(t, int64(5), metadata.ToRow)
+
+	// Page sizes within the budget are not truncated
+	metadata = NewMetadata().WithPageSize(3).WithSort("id").WithMaxRows(5)
+	users = nil
+	err = Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(users))
+	assert.False(t, metadata.Truncated)
+
+	// OptimizedPaginate caps the page at the optimizer's MaxRows
+	optimizer := NewQueryOptimizer().WithIndexHint(false).WithTimeout(0).WithMaxRows(2)
+	metadata = NewMetadata().WithPageSize(4).WithSort("id")
+	users = nil
+	err = OptimizedPaginate(db.Model(&User{}), metadata, optimizer, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.True(t, metadata.Truncated)
+	assert.Equal(t, int64(10), metadata.TotalRows)
+	assert.Equal(t, int64(5), metadata.TotalPages)
+
+	// A lower cap on the metadata wins
+	metadata = NewMetadata().WithPageSize(4).WithSort("id").WithMaxRows(1)
+	users = nil
+	err = OptimizedPaginate(db.Model(&User{}), metadata, optimizer, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(users))
+}
+
+func TestPageFromOffset(t *testing.T) {
+	tests := []struct {
+		offset   int
+		pageSize int
+		page     int
+	}{
+		{0, 10, 1},
+		{9, 10, 1},
+		{10, 10, 2},
+		{11, 10, 2},
+		{25, 10, 3},
+		{99, 100, 1},
+		{100, 100, 2},
+		{-5, 10, 1},
+		{20, 0, 3},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.page, PageFromOffset(test.offset, test.pageSize), "offset %d, page size %d", test.offset, test.pageSize)
+	}
+
+	assert.Equal(t, 0, OffsetFromPage(1, 10))
+	assert.Equal(t, 20, OffsetFromPage(3, 10))
+	assert.Equal(t, 0, OffsetFromPage(0, 10))
+	assert.Equal(t, 0, OffsetFromPage(-1, 10))
+	assert.Equal(t, 10, OffsetFromPage(2, 0))
+
+	// Round trips agree with Metadata.GetOffset
+	for page := 1; page <= 5; page++ {
+		offset := OffsetFromPage(page, 7)
+		assert.Equal(t, page, PageFromOffset(offset, 7))
+		assert.Equal(t, NewMetadata().WithPage(page).WithPageSize(7).GetOffset(), offset)
+	}
+}
+
+func TestReset(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithPage(2).WithPageSize(2).WithSort("name").WithSortDirection("desc").
+		WithFields("id", "name").WithFilter("age", FilterGt, 20).WithCursorSecret([]byte("secret")).
+		WithCountMode(CountNone).WithKnownTotal(5).WithDebug(false)
+	metadata.Cursor = "cursor"
+	metadata.CursorField = "id"
+	metadata.TotalRows, metadata.TotalPages, metadata.HasNext = 5, 3, true
+	metadata.Reset()
+	assert.Equal(t, NewMetadata(), metadata)
+
+	// A reset instance paginates like a fresh one
+	metadata = NewMetadata().WithPage(3).WithPageSize(2)
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	metadata.Reset()
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, 5, len(users))
+	assert.Equal(t, 1, metadata.Page)
+}
+
+func TestSortFields(t *testing.T) {
+	fields := []SortField{
+		{Field: "age", Direction: "DESC"},
+		{Field: "name", Direction: "asc"},
+		{Field: "id"},
+	}
+	metadata := NewMetadata().WithSortFields(fields)
+	assert.Equal(t, "age", metadata.Sort)
+	assert.Equal(t, SortDirection("DESC"), fields[0].Direction, "the caller's slice is not modified")
+
+	result := metadata.Validate()
+	assert.True(t, result.IsValid)
+	assert.Equal(t, "age desc, name asc, id asc", metadata.GetSortClause())
+
+	// Columns keep the order given, whatever their names
+	reversed := NewMetadata().WithSortFields([]SortField{{Field: "id"}, {Field: "name"}, {Field: "age", Direction: "desc"}})
+	assert.Equal(t, "id asc, name asc, age desc", reversed.GetSortClause())
+
+	query, _, err := metadata.BuildSQL(PostgreSQL, "SELECT * FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM users ORDER BY age desc, name asc, id asc LIMIT $1 OFFSET $2", query)
+
+	db := setupTestDB(t)
+	assert.NoError(t, db.Create(&User{Name: "Aaron", Age: 35}).Error)
+	var users []User
+	err = Paginate(db.Model(&User{}), NewMetadata().WithPageSize(3).WithSortFields(fields), &users)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Aaron", "Bob Johnson", "Charlie Wilson"}, []string{users[0].Name, users[1].Name, users[2].Name})
+
+	// Each field is checked against the allow-list and each direction is validated
+	result = NewMetadata().WithAllowedFields("age", "name").WithSortFields(fields).Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_SORT_FIELD", result.Errors[0].Code)
+
+	result = NewMetadata().WithSortFields([]SortField{{Field: "age"}, {Field: "name", Direction: "sideways"}}).Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_SORT_DIRECTION", result.Errors[0].Code)
+
+	result = NewMetadata().WithValidationRule("sort", "in:age,name").WithSortFields(fields).Validate()
+	assert.False(t, result.IsValid)
+
+	// WithSort replaces a multi-column sort
+	metadata.WithSort("name").WithSortDirection("asc")
+	assert.Equal(t, "name asc", metadata.GetSortClause())
+}
+
+func TestCountExpression(t *testing.T) {
+	db := setupTestDB(t)
+	queries := recordQueries(t, db)
+
+	for _, expr := range []string{"COUNT(1)", "COUNT(id)", "count(DISTINCT age)", "COUNT(users.id)"} {
+		*queries = nil
+		metadata := NewMetadata().WithPageSize(2).WithCountExpression(expr)
+		var users []User
+		assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+		assert.Equal(t, int64(5), metadata.TotalRows, expr)
+		assert.Equal(t, "SELECT "+expr+" FROM `users`", (*queries)[0])
+	}
+
+	// Filters keep working with a custom expression
+	*queries = nil
+	metadata := NewMetadata().WithCountExpression("COUNT(1)").WithFilter("age", FilterGte, 30)
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, int64(3), metadata.TotalRows)
+	assert.Equal(t, "SELECT COUNT(1) FROM `users` WHERE age >= ?", (*queries)[0])
+
+	for _, expr := range []string{"COUNT(*) FROM users; --", "SUM(age)", "COUNT(id) + 1"} {
+		result := NewMetadata().WithCountExpression(expr).Validate()
+		assert.False(t, result.IsValid, expr)
+		assert.Equal(t, "INVALID_COUNT_EXPRESSION", result.Errors[0].Code)
+	}
+}
+
+func TestPaginateRows(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithPageSize(2).WithSort("age").WithSortDir(Desc)
+	rows, err := PaginateRows(db.Model(&User{}), metadata)
+	assert.NoError(t, err)
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var user User
+		assert.NoError(t, db.ScanRows(rows, &user))
+		names = append(names, user.Name)
+	}
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, metadata.PageSize, len(names))
+	assert.Equal(t, []string{"Bob Johnson", "Charlie Wilson"}, names)
+	assert.Equal(t, int64(5), metadata.TotalRows)
+	assert.Equal(t, int64(3), metadata.TotalPages)
+	assert.True(t, metadata.HasNext)
+
+	// Window counts run separately and leave the count mode unchanged
+	metadata = NewMetadata().WithPage(3).WithPageSize(2).WithCountStrategy(CountWindow)
+	rows, err = PaginateRows(db.Model(&User{}), metadata)
+	assert.NoError(t, err)
+	defer rows.Close()
+	columns, err := rows.Columns()
+	assert.NoError(t, err)
+	assert.NotContains(t, columns, windowCountColumn)
+	assert.Equal(t, int64(5), metadata.TotalRows)
+	assert.Equal(t, CountWindow, metadata.CountMode)
+}
+
+func TestNegativePageSize(t *testing.T) {
+	db := setupTestDB(t)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, db.Create(&User{Name: "Extra", Age: 40 + i}).Error)
+	}
+
+	metadata := NewMetadata().WithPageSize(-10).WithSort("id").WithAllowNegativePageSize(true)
+	var users []User
+	err := Paginate(db.Model(&User{}), metadata, &users)
+	assert.NoError(t, err)
+	if assert.Equal(t, 10, len(users)) {
+		assert.Equal(t, uint(16), users[0].ID)
+		assert.Equal(t, uint(25), users[9].ID)
+	}
+	assert.Equal(t, 15, metadata.GetOffset())
+	assert.Equal(t, 10, metadata.PageSize)
+	assert.Equal(t, 3, metadata.Page)
+	assert.Equal(t, int64(3), metadata.TotalPages)
+	assert.Equal(t, int64(16), metadata.FromRow)
+	assert.Equal(t, int64(25), metadata.ToRow)
+	assert.False(t, metadata.HasNext)
+	assert.True(t, metadata.HasPrevious)
+
+	// More rows than exist returns them all
+	metadata = NewMetadata().WithPageSize(-50).WithAllowNegativePageSize(true)
+	metadata.TotalRows = 25
+	assert.Equal(t, 0, metadata.GetOffset())
+	assert.Equal(t, 50, metadata.GetLimit())
+
+	// Negative page sizes stay invalid unless allowed
+	result := NewMetadata().WithPageSize(-10).Validate()
+	assert.Equal(t, "PAGE_SIZE_NEGATIVE", result.Errors[0].Code)
+
+	// The total must be available
+	result = NewMetadata().WithPageSize(-10).WithAllowNegativePageSize(true).WithCountMode(CountNone).Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "PAGE_SIZE_REQUIRES_TOTAL", result.Errors[0].Code)
+
+	result = NewMetadata().WithPageSize(-10).WithAllowNegativePageSize(true).WithCursorField("id").Validate()
+	assert.Equal(t, "MIXED_PAGINATION_MODE", result.Errors[0].Code)
+
+	// Defaults applied before counting, e.g. right after binding the request, keep the page
+	// counted from the end until Paginate counts the rows
+	metadata = NewMetadata().WithPageSize(-10).WithSort("id").WithAllowNegativePageSize(true)
+	metadata.ValidateAndSetDefaults()
+	assert.Equal(t, -10, metadata.PageSize)
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	if assert.Equal(t, 10, len(users)) {
+		assert.Equal(t, uint(16), users[0].ID)
+		assert.Equal(t, uint(25), users[9].ID)
+	}
+	assert.Equal(t, 15, metadata.GetOffset())
+
+	// The offset follows the filtered count
+	metadata = NewMetadata().WithPageSize(-3).WithSort("id").WithAllowNegativePageSize(true).WithFilter("age", FilterLt, 40)
+	metadata.ValidateAndSetDefaults()
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	if assert.Equal(t, 3, len(users)) {
+		assert.Equal(t, uint(3), users[0].ID)
+		assert.Equal(t, uint(5), users[2].ID)
+	}
+
+	// The page is reported as the last one, although rows 3-5 don't start a page of 3 rows
+	assert.Equal(t, 2, metadata.Page)
+	assert.Equal(t, int64(2), metadata.TotalPages)
+	assert.True(t, metadata.HasPrevious)
+	assert.False(t, metadata.HasNext)
+	assert.Equal(t, int64(3), metadata.FromRow)
+	assert.Equal(t, int64(5), metadata.ToRow)
+
+	// An empty result resolves to the first page
+	metadata = NewMetadata().WithPageSize(-10).WithAllowNegativePageSize(true)
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}).Where("age > ?", 1000), metadata, &users))
+	assert.Empty(t, users)
+	assert.Equal(t, 10, metadata.PageSize)
+	assert.Equal(t, 0, metadata.GetOffset())
+
+	// Building the page without a total fails instead of returning the first rows
+	var invalid *InvalidMetadataError
+	metadata = NewMetadata().WithPageSize(-10).WithAllowNegativePageSize(true)
+	err = db.Model(&User{}).Scopes(metadata.Scope()).Find(&users).Error
+	if assert.True(t, errors.As(err, &invalid)) {
+		assert.Equal(t, "PAGE_SIZE_REQUIRES_TOTAL", invalid.Errors[0].Code)
+	}
+	_, _, err = metadata.BuildSQL(SQLite, "SELECT * FROM users")
+	if assert.True(t, errors.As(err, &invalid)) {
+		assert.Equal(t, "PAGE_SIZE_REQUIRES_TOTAL", invalid.Errors[0].Code)
+	}
+}
+
+func TestQueryTagGorm(t *testing.T) {
+	db := setupTestDB(t)
+
+	optimizer := NewQueryOptimizer().WithIndexHint(false).WithTimeout(0).WithMaxRows(0).WithQueryTag("service:orders */ DROP TABLE users; /*")
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var users []User
+		return optimizer.ApplyOptimizationsToGorm(tx.Model(&User{})).Find(&users)
+	})
+	assert.Equal(t, "/* service:orders  DROP TABLE users; */ SELECT * FROM `users`", sql)
+
+	// Tagged queries still run
+	var users []User
+	err := OptimizedPaginate(db.Model(&User{}), NewMetadata().WithPageSize(2), optimizer, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(users))
+}
+
+func TestFirst(t *testing.T) {
+	db := setupTestDB(t)
+
+	// The 3rd user by age: Jane (25), Alice (28), John (30)
+	var user User
+	found, err := First(db.Model(&User{}), NewMetadata().WithSort("age").WithPage(3).WithPageSize(1), &user)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "John Doe", user.Name)
+
+	// Filters and the page offset apply
+	user = User{}
+	metadata := NewMetadata().WithSort("age").WithSortDirection("desc").WithPage(2).WithPageSize(2).WithFilter("age", FilterGte, 28)
+	found, err = First(db.Model(&User{}), metadata, &user)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "John Doe", user.Name)
+
+	// No row past the end
+	user = User{}
+	found, err = First(db.Model(&User{}), NewMetadata().WithSort("age").WithPage(6).WithPageSize(1), &user)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, User{}, user)
+
+	var users []User
+	_, err = First(db.Model(&User{}), NewMetadata(), &users)
+	assert.True(t, errors.Is(err, ErrResultNotStructPointer))
+}
+
+func TestInRuleParsing(t *testing.T) {
+	metadata := NewMetadata().WithSort("name").WithValidationRule("sort", "in:id, name, created_at")
+	assert.True(t, metadata.Validate().IsValid)
+
+	metadata = NewMetadata().WithFields("id", "name").WithValidationRule("fields", "in: id ,, name,")
+	assert.True(t, metadata.Validate().IsValid)
+
+	metadata = NewMetadata().WithSort("price,currency").WithValidationRule("sort", `in:id, "price,currency"`)
+	assert.True(t, metadata.Validate().IsValid)
+
+	metadata = NewMetadata().WithSort("price").WithValidationRule("sort", `in:id, "price,currency"`)
+	result := metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_SORT_FIELD", result.Errors[0].Code)
+
+	tests := []struct {
+		rule     string
+		expected []string
+	}{
+		{"id,name", []string{"id", "name"}},
+		{" id , name ", []string{"id", "name"}},
+		{"id,,name,", []string{"id", "name"}},
+		{"", nil},
+		{`"a,b", c`, []string{"a,b", "c"}},
+		{`" spaced ",x`, []string{" spaced ", "x"}},
+		{`"say ""hi""",x`, []string{`say "hi"`, "x"}},
+		{`a"b,c`, []string{`a"b`, "c"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, parseInRule(tt.rule), "rule %q", tt.rule)
+	}
+}
+
+func TestRegexRule(t *testing.T) {
+	metadata := NewMetadata().WithSort("created_at").WithValidationRule("sort", "regex:^[a-z_]+$")
+	assert.True(t, metadata.Validate().IsValid)
+
+	metadata = NewMetadata().WithSort("name; DROP TABLE users").WithValidationRule("sort", "regex:^[a-z_]+$")
+	result := metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "sort", result.Errors[0].Field)
+	assert.Equal(t, "REGEX_MISMATCH", result.Errors[0].Code)
+
+	// Every sort field is checked
+	metadata = NewMetadata().
+		WithSortFields([]SortField{{Field: "name"}, {Field: "Age"}}).
+		WithValidationRule("sort", "regex:^[a-z_]+$")
+	assert.Equal(t, "REGEX_MISMATCH", metadata.Validate().Errors[0].Code)
+
+	metadata = NewMetadata().
+		WithFilter("status", FilterEq, "active").
+		WithFilter("Status", FilterEq, "x").
+		WithValidationRule("filter", "regex:^[a-z_]+$")
+	result = metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "filter", result.Errors[0].Field)
+
+	metadata = NewMetadata().WithSort("name").WithValidationRule("sort", "regex:[")
+	assert.Equal(t, "INVALID_VALIDATION_RULE", metadata.Validate().Errors[0].Code)
+}
+
+func TestPreserveOrder(t *testing.T) {
+	db := setupTestDB(t)
+
+	// The query's order is kept and the sort is not added
+	metadata := NewMetadata().WithPageSize(2).WithSort("name").WithPreserveOrder(true)
+	sql := DryRunPaginate(db.Model(&User{}).Order("age desc"), metadata)
+	assert.Equal(t, "SELECT * FROM `users` ORDER BY age desc LIMIT 2", sql)
+	assert.Equal(t, 1, strings.Count(sql, "ORDER BY"))
+
+	var users []User
+	err := Paginate(db.Model(&User{}).Order("age desc"), NewMetadata().WithPageSize(2).WithSort("name").WithPreserveOrder(true), &users)
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(users)) {
+		assert.Equal(t, "Bob Johnson", users[0].Name)
+		assert.Equal(t, "Charlie Wilson", users[1].Name)
+	}
+
+	// Without it the sort is appended to the query's order
+	sql = DryRunPaginate(db.Model(&User{}).Order("age desc"), NewMetadata().WithPageSize(2).WithSort("name"))
+	assert.Equal(t, "SELECT * FROM `users` ORDER BY age desc,name asc LIMIT 2", sql)
+
+	// Keyset pages follow the preserved order
+	assert.NoError(t, db.AutoMigrate(&tieBreakEvent{}))
+	events := []tieBreakEvent{
+		{ID: 1, CreatedAt: 200}, {ID: 2, CreatedAt: 100}, {ID: 3, CreatedAt: 100},
+		{ID: 4, CreatedAt: 100}, {ID: 5, CreatedAt: 200}, {ID: 6, CreatedAt: 100},
+		{ID: 7, CreatedAt: 300},
+	}
+	assert.NoError(t, db.Create(&events).Error)
+
+	var seen []uint
+	metadata = NewMetadata().WithPageSize(3).WithPreserveOrder(true)
+	for i := 0; i < 5; i++ {
+		var page []tieBreakEvent
+		cursorPage, err := CursorPaginate(db.Model(&tieBreakEvent{}).Order("created_at desc, id desc"), metadata, &page)
+		assert.NoError(t, err)
+		for _, event := range page {
+			seen = append(seen, event.ID)
+		}
+		if !cursorPage.HasMore {
+			break
+		}
+	}
+	assert.Equal(t, []uint{7, 5, 1, 6, 4, 3, 2}, seen)
+	assert.Equal(t, "created_at", metadata.CursorField)
+	assert.Equal(t, "desc", metadata.CursorOrder)
+	assert.Equal(t, "id", metadata.CursorTieBreak)
+}
+
+func TestDebugInfoCountSQL(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithPageSize(2).WithSort("name").WithDebug(true).WithFilter("age", FilterGte, 28)
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	if assert.NotNil(t, metadata.DebugInfo) {
+		assert.Equal(t, "SELECT * FROM `users` WHERE age >= 28 ORDER BY name asc LIMIT 2", metadata.DebugInfo.SQL)
+		assert.Equal(t, []any{28}, metadata.DebugInfo.Args)
+		assert.Equal(t, "SELECT count(*) FROM `users` WHERE age >= 28", metadata.DebugInfo.CountSQL)
+		assert.Contains(t, strings.ToUpper(metadata.DebugInfo.CountSQL), "COUNT")
+	}
+
+	// Grouped queries show the subquery wrapper
+	metadata = NewMetadata().WithPageSize(2).WithSort("age").WithDebug(true)
+	var ages []struct{ Age int }
+	assert.NoError(t, Paginate(db.Model(&User{}).Select("age").Group("age"), metadata, &ages))
+	assert.Contains(t, metadata.DebugInfo.CountSQL, "AS grouped_rows")
+
+	// No count query runs with CountNone
+	metadata = NewMetadata().WithPageSize(2).WithDebug(true).WithCountMode(CountNone)
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Empty(t, metadata.DebugInfo.CountSQL)
+	assert.NotEmpty(t, metadata.DebugInfo.SQL)
+
+	// Without debug mode nothing is captured
+	metadata = NewMetadata().WithPageSize(2)
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Nil(t, metadata.DebugInfo)
+}
+
+func TestWithTotalRows(t *testing.T) {
+	metadata := NewMetadata().WithPage(2).WithPageSize(10).WithTotalRows(35)
+	assert.Equal(t, int64(35), metadata.TotalRows)
+	assert.Equal(t, int64(4), metadata.TotalPages)
+	assert.True(t, metadata.HasNext)
+	assert.True(t, metadata.HasPrevious)
+	assert.Equal(t, int64(11), metadata.FromRow)
+	assert.Equal(t, int64(20), metadata.ToRow)
+
+	// The last page is partial
+	metadata.WithPage(4).WithTotalRows(35)
+	assert.False(t, metadata.HasNext)
+	assert.Equal(t, int64(31), metadata.FromRow)
+	assert.Equal(t, int64(35), metadata.ToRow)
+
+	// A total of 0 clears the derived fields
+	metadata.WithTotalRows(0)
+	assert.Equal(t, int64(0), metadata.TotalPages)
+	assert.False(t, metadata.HasNext)
+	assert.False(t, metadata.HasPrevious)
+	assert.Equal(t, int64(0), metadata.FromRow)
+	assert.Equal(t, int64(0), metadata.ToRow)
+}
+
+func TestStableOrder(t *testing.T) {
+	db := setupTestDB(t)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, db.Create(&User{Name: "Twin", Age: 40 + i%2}).Error)
+	}
+
+	// The model's primary key breaks ties between equal ages
+	metadata := NewMetadata().WithPageSize(3).WithSort("age").WithSortDirection("desc").WithStableOrder("")
+	assert.Equal(t, "SELECT * FROM `users` ORDER BY age desc, id desc LIMIT 3", DryRunPaginate(db.Model(&User{}), metadata))
+
+	seen := make(map[uint]bool)
+	for page := 1; ; page++ {
+		metadata := NewMetadata().WithPage(page).WithPageSize(3).WithSort("age").WithStableOrder("")
+		var users []User
+		assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+		for _, user := range users {
+			assert.False(t, seen[user.ID], "user %d repeated on page %d", user.ID, page)
+			seen[user.ID] = true
+		}
+		if !metadata.HasNext {
+			break
+		}
+	}
+	assert.Len(t, seen, 25)
+
+	// Sorts including the column are left as they are
+	metadata = NewMetadata().WithSort("id").WithStableOrder("id")
+	assert.Equal(t, "id asc", metadata.GetSortClause())
+	query, _, err := NewMetadata().WithSort("age").WithStableOrder("users.id").BuildSQL(PostgreSQL, "SELECT * FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM users ORDER BY age asc, users.id asc LIMIT $1 OFFSET $2", query)
+	assert.False(t, NewMetadata().WithSort("age").WithStableOrder("id; DROP TABLE users").Validate().IsValid)
+}
+
+func TestPaginateJSON(t *testing.T) {
+	db := setupTestDB(t)
+
+	metadata := NewMetadata().WithPageSize(2).WithSort("id").WithFields("id", "name")
+	data, err := PaginateJSON(db.Model(&User{}), metadata)
+	assert.NoError(t, err)
+	var rows []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &rows))
+	assert.Len(t, rows, metadata.PageSize)
+	assert.Equal(t, map[string]interface{}{"id": float64(1), "name": "John Doe"}, rows[0])
+	assert.NotContains(t, string(data), "email")
+	assert.Equal(t, int64(5), metadata.TotalRows)
+	assert.True(t, metadata.HasNext)
+
+	// Pages past the end are empty arrays
+	data, err = PaginateJSON(db.Model(&User{}), NewMetadata().WithPage(10))
+	assert.NoError(t, err)
+	assert.JSONEq(t, "[]", string(data))
+
+	_, err = PaginateJSON(db.Model(&User{}), NewMetadata().WithPageSize(500))
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+// unknownDialector reports a dialector name outside the known dialects
+type unknownDialector struct {
+	gorm.Dialector
+}
+
+func (unknownDialector) Name() string { return "oracle" }
+
+func TestDialectFromGorm(t *testing.T) {
+	db := setupTestDB(t)
+
+	dialect, err := DialectFromGorm(db)
+	assert.NoError(t, err)
+	assert.Equal(t, SQLite, dialect)
+
+	unknown := &gorm.DB{Config: &gorm.Config{Dialector: unknownDialector{db.Dialector}}}
+	_, err = DialectFromGorm(unknown)
+	assert.ErrorIs(t, err, ErrUnsupportedDialect)
+	assert.Contains(t, err.Error(), "oracle")
+}
+
+func TestPaginateCopy(t *testing.T) {
+	db := setupTestDB(t)
+
+	request := NewMetadata().WithPage(2).WithPageSize(2).WithSort("age").WithSortDir("desc").
+		WithFilter("age", FilterGte, 20).WithDebug(true)
+	original := request.Clone()
+
+	var users []User
+	result, err := PaginateCopy(db.Model(&User{}), request, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, original, request)
+	assert.NotSame(t, request, result)
+	assert.Equal(t, 2, len(users))
+	assert.NotZero(t, result.TotalRows)
+	assert.NotEmpty(t, result.DebugInfo.SQL)
+
+	// Cursor results go to the copy too
+	request = NewMetadata().WithPageSize(2).WithCursorField("id").WithCursorExtra(map[string]any{"q": "x"})
+	original = request.Clone()
+	result, err = PaginateCopy(db.Model(&User{}), request, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, original, request)
+	assert.Empty(t, request.Cursor)
+	assert.NotEmpty(t, result.Cursor)
+
+	// Invalid requests return the validation error and no copy
+	request = NewMetadata().WithPage(-1)
+	result, err = PaginateCopy(db.Model(&User{}), request, &users)
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	assert.Equal(t, -1, request.Page)
+}
@@ -0,0 +1,443 @@
+package metakit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// contextKey is the key under which Metadata is stored in a request context
+type contextKey struct{}
+
+// FromRequest parses pagination metadata from the request's query parameters.
+// Parameters that are not present keep the defaults of NewMetadata.
+// Supported parameters: page, page_size, offset, sort (comma-separated, "-" prefix for
+// descending, see WithSortString), sort_direction, cursor,
+// cursor_field, cursor_order, after, before, fields (comma-separated), debug, drift_token
+// and JSON:API sparse fieldsets (fields[<type>]).
+// Parameters named after one of filterFields become in filters of their comma-separated
+// values, as added by WithFilterFromQuery.
+// Use BindRequest on metadata configured with WithParamNames to read other parameter names.
+//
+// Example:
+//
+//	// GET /users?page=2&page_size=20&sort=name&fields=id,name&status=active,pending
+//	metadata, err := FromRequest(r, "status")
+//	// metadata.Page == 2
+//	// metadata.SelectedFields == []string{"id", "name"}
+//	// metadata.Filters == []Filter{{Field: "status", Operator: FilterIn, Value: []interface{}{"active", "pending"}}}
+func FromRequest(r *http.Request, filterFields ...string) (*Metadata, error) {
+	m := NewMetadata()
+	if err := m.BindRequest(r, filterFields...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BindRequest parses the request's query parameters into the metadata like FromRequest,
+// reading the parameter names configured with WithParamNames. Parameters that are not
+// present keep their current values. An offset without a page also sets Page to the page
+// containing the offset, so limit/offset APIs report page numbers.
+//
+// Example:
+//
+//	// GET /users?limit=20&offset=40&order_by=name
+//	metadata := NewMetadata().WithParamNames(map[string]string{
+//	  "page_size": "limit",
+//	  "sort":      "order_by",
+//	})
+//	err := metadata.BindRequest(r)
+//	// metadata.Page == 3
+//	// metadata.PageSize == 20
+//	// metadata.Sort == "name"
+func (m *Metadata) BindRequest(r *http.Request, filterFields ...string) error {
+	query := r.URL.Query()
+	param := func(name string) string {
+		return query.Get(m.paramName(name))
+	}
+	atoi := func(name string) (int, bool, error) {
+		value := param(name)
+		if value == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s: %v", m.paramName(name), err)
+		}
+		return n, true, nil
+	}
+
+	page, hasPage, err := atoi("page")
+	if err != nil {
+		return err
+	}
+	if hasPage {
+		m.Page = page
+	}
+
+	pageSize, ok, err := atoi("page_size")
+	if err != nil {
+		return err
+	}
+	if ok {
+		m.PageSize = pageSize
+	}
+
+	offset, ok, err := atoi("offset")
+	if err != nil {
+		return err
+	}
+	if ok {
+		m.WithOffset(offset)
+		if !hasPage {
+			m.Page = PageFromOffset(offset, m.PageSize)
+		}
+	}
+
+	if value := param("sort"); value != "" {
+		m.WithSortString(value)
+	}
+	if value := param("sort_direction"); value != "" {
+		m.SortDirection = value
+	}
+
+	for name, target := range map[string]*string{
+		"cursor":       &m.Cursor,
+		"cursor_field": &m.CursorField,
+		"cursor_order": &m.CursorOrder,
+		"after":        &m.After,
+		"before":       &m.Before,
+		"drift_token":  &m.DriftToken,
+	} {
+		if value := param(name); value != "" {
+			*target = value
+		}
+	}
+
+	if value := param("fields"); value != "" {
+		m.WithFields(strings.Split(value, ",")...)
+	}
+	if fieldsets := ParseSparseFieldsets(query); len(fieldsets) > 0 {
+		m.Fieldsets = fieldsets
+	}
+
+	for _, field := range filterFields {
+		if value := query.Get(field); value != "" {
+			m.WithFilterFromQuery(field, value)
+		}
+	}
+
+	if value := param("debug"); value != "" {
+		debug, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", m.paramName("debug"), err)
+		}
+		m.Debug = debug
+	}
+
+	return nil
+}
+
+// WithParamNames maps standard query parameter names to the names read by BindRequest
+// and returns the metadata for method chaining. Unmapped parameters keep their standard names.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithParamNames(map[string]string{"page_size": "limit", "sort": "order_by"})
+func (m *Metadata) WithParamNames(names map[string]string) *Metadata {
+	m.ParamNames = make(map[string]string, len(names))
+	for name, param := range names {
+		m.ParamNames[name] = param
+	}
+	return m
+}
+
+// paramName returns the query parameter name configured for the standard parameter name
+func (m *Metadata) paramName(name string) string {
+	if param, ok := m.ParamNames[name]; ok && param != "" {
+		return param
+	}
+	return name
+}
+
+// ParseSparseFieldsets reads JSON:API sparse fieldset parameters ("fields[<type>]=a,b")
+// into a map from resource type to selected fields. Returns nil when none are present.
+//
+// Example:
+//
+//	// ?fields[users]=name,email&fields[posts]=title
+//	fieldsets := ParseSparseFieldsets(r.URL.Query())
+//	// fieldsets["users"] == []string{"name", "email"}
+//	// fieldsets["posts"] == []string{"title"}
+func ParseSparseFieldsets(values url.Values) map[string][]string {
+	var fieldsets map[string][]string
+	for key, list := range values {
+		if !strings.HasPrefix(key, "fields[") || !strings.HasSuffix(key, "]") || len(list) == 0 {
+			continue
+		}
+
+		resourceType := key[len("fields[") : len(key)-1]
+		if resourceType == "" {
+			continue
+		}
+
+		if fieldsets == nil {
+			fieldsets = make(map[string][]string)
+		}
+		fieldsets[resourceType] = cleanFields(strings.Split(list[0], ","))
+	}
+	return fieldsets
+}
+
+// NewContext returns a copy of ctx carrying the metadata.
+func NewContext(ctx context.Context, m *Metadata) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext returns the metadata stored in ctx by Middleware or NewContext.
+//
+// Example:
+//
+//	func listUsers(w http.ResponseWriter, r *http.Request) {
+//	  metadata, ok := FromContext(r.Context())
+//	  ...
+//	}
+func FromContext(ctx context.Context) (*Metadata, bool) {
+	m, ok := ctx.Value(contextKey{}).(*Metadata)
+	return m, ok
+}
+
+// Middleware parses and validates pagination metadata for every request and stores it
+// in the request context, where handlers retrieve it with FromContext.
+// Invalid requests are answered with 400 Bad Request and a JSON body listing the errors.
+// It is compatible with chi and any other net/http router.
+//
+// Example:
+//
+//	r := chi.NewRouter()
+//	r.Use(Middleware)
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, err := FromRequest(r)
+		if err != nil {
+			writeValidationErrors(w, []ValidationError{{
+				Field:   "query",
+				Message: err.Error(),
+				Code:    "INVALID_PARAMETER",
+			}})
+			return
+		}
+
+		if validation := m.Validate(); !validation.IsValid {
+			writeValidationErrors(w, validation.Errors)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), m)))
+	})
+}
+
+// writeValidationErrors writes a 400 Bad Request response with the errors as JSON
+func writeValidationErrors(w http.ResponseWriter, errors []ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": errors})
+}
+
+// HALLinks returns HAL-style navigation links (self, first, prev, next, last) for the current page.
+// Each link points to baseURL with the page and page_size query parameters set; existing query
+// parameters of baseURL are kept. prev and next are omitted at the boundaries and last is omitted
+// when the total is unknown.
+//
+// Example:
+//
+//	metadata.TotalRows = 50
+//	metadata.WithPage(2).WithPageSize(10).ValidateAndSetDefaults()
+//	links := metadata.HALLinks("https://api.example.com/users")
+//	// links["next"]["href"] == "https://api.example.com/users?page=3&page_size=10"
+func (m *Metadata) HALLinks(baseURL string) map[string]map[string]string {
+	link := func(page int) map[string]string {
+		return map[string]string{"href": m.pageURL(baseURL, page)}
+	}
+
+	links := map[string]map[string]string{
+		"self":  link(m.Page),
+		"first": link(1),
+	}
+	if m.Page > 1 {
+		links["prev"] = link(m.Page - 1)
+	}
+	if m.TotalPages > 0 {
+		if int64(m.Page) < m.TotalPages {
+			links["next"] = link(m.Page + 1)
+		}
+		links["last"] = link(int(m.TotalPages))
+	} else if m.HasNext {
+		links["next"] = link(m.Page + 1)
+	}
+	return links
+}
+
+// pageURL returns baseURL with the page and page_size query parameters set
+func (m *Metadata) pageURL(baseURL string, page int) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Sprintf("%s?page=%d&page_size=%d", baseURL, page, m.PageSize)
+	}
+
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(m.PageSize))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// ResponseHeader selects pagination headers written by WriteHeaders. Values combine with |.
+type ResponseHeader int
+
+const (
+	// HeaderTotalCount writes X-Total-Count with TotalRows
+	HeaderTotalCount ResponseHeader = 1 << iota
+
+	// HeaderTotalPages writes X-Total-Pages with TotalPages
+	HeaderTotalPages
+
+	// HeaderLink writes an RFC 5988 Link header with the first, prev, next and last pages
+	HeaderLink
+
+	// HeaderContentRange writes Content-Range with the zero-based row range of the page, e.g. "users 10-19/50"
+	HeaderContentRange
+
+	// HeaderAll writes every pagination header
+	HeaderAll = HeaderTotalCount | HeaderTotalPages | HeaderLink | HeaderContentRange
+)
+
+// WithResponseHeaders selects the headers written by WriteHeaders and returns the metadata
+// for method chaining. All headers are written when none are selected.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithResponseHeaders(HeaderTotalCount | HeaderLink)
+func (m *Metadata) WithResponseHeaders(headers ResponseHeader) *Metadata {
+	m.ResponseHeaders = headers
+	return m
+}
+
+// WriteHeaders sets the pagination headers selected with WithResponseHeaders on w in one call:
+// X-Total-Count, X-Total-Pages, Link with page URLs built from baseURL as in HALLinks, and
+// Content-Range naming resourceName. Totals are omitted when they are unknown (TotalRows of -1).
+// Call it after paginating and before writing the response body.
+//
+// Example:
+//
+//	err := Paginate(db.Model(&User{}), metadata, &users)
+//	metadata.WriteHeaders(w, "https://api.example.com/users", "users")
+//	// X-Total-Count: 50
+//	// X-Total-Pages: 5
+//	// Link: <https://api.example.com/users?page=1&page_size=10>; rel="first", ...
+//	// Content-Range: users 10-19/50
+func (m *Metadata) WriteHeaders(w http.ResponseWriter, baseURL, resourceName string) {
+	headers := m.ResponseHeaders
+	if headers == 0 {
+		headers = HeaderAll
+	}
+	known := m.TotalRows >= 0
+
+	if headers&HeaderTotalCount != 0 && known {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(m.TotalRows, 10))
+	}
+	if headers&HeaderTotalPages != 0 && known {
+		w.Header().Set("X-Total-Pages", strconv.FormatInt(m.TotalPages, 10))
+	}
+	if headers&HeaderLink != 0 {
+		if link := m.linkHeader(baseURL); link != "" {
+			w.Header().Set("Link", link)
+		}
+	}
+	if headers&HeaderContentRange != 0 {
+		w.Header().Set("Content-Range", m.contentRange(resourceName))
+	}
+}
+
+// linkHeader formats the navigation links of HALLinks as an RFC 5988 Link header value
+func (m *Metadata) linkHeader(baseURL string) string {
+	links := m.HALLinks(baseURL)
+	var parts []string
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		if link, ok := links[rel]; ok {
+			parts = append(parts, fmt.Sprintf("<%s>; rel=%q", link["href"], rel))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// contentRange formats the zero-based, inclusive row range of the page as a Content-Range
+// header value. Empty pages have the unsatisfied range "*" and unknown totals are written as "*".
+func (m *Metadata) contentRange(resourceName string) string {
+	total := "*"
+	if m.TotalRows >= 0 {
+		total = strconv.FormatInt(m.TotalRows, 10)
+	}
+	if m.ItemsOnPage() == 0 {
+		return fmt.Sprintf("%s */%s", resourceName, total)
+	}
+	return fmt.Sprintf("%s %d-%d/%s", resourceName, m.FromRow-1, m.ToRow-1, total)
+}
+
+// PageTokenResponse is a list response envelope following Google AIP-158
+type PageTokenResponse struct {
+	Items         interface{} `json:"items"`
+	NextPageToken string      `json:"next_page_token"`
+}
+
+// FromPageTokenRequest parses AIP-158 page_token and page_size query parameters into cursor-based
+// metadata ordered by cursorField. An empty or missing page_token requests the first page, and
+// a page_size of 0 or above the maximum is coerced to the default or maximum. Negative sizes are rejected.
+//
+// Example:
+//
+//	// GET /users?page_size=20&page_token=...
+//	metadata, err := FromPageTokenRequest(r, "id")
+//	err = Paginate(db.Model(&User{}), metadata, &users)
+//	json.NewEncoder(w).Encode(metadata.PageTokenResponse(users))
+func FromPageTokenRequest(r *http.Request, cursorField string) (*Metadata, error) {
+	m := NewMetadata().WithCursorField(cursorField)
+	query := r.URL.Query()
+
+	if value := query.Get("page_size"); value != "" {
+		pageSize, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page_size: %v", err)
+		}
+		if pageSize < 0 {
+			return nil, fmt.Errorf("invalid page_size: must not be negative")
+		}
+		m.PageSize = pageSize
+	}
+	m.Cursor = query.Get("page_token")
+
+	m.ValidateAndSetDefaults()
+	return m, nil
+}
+
+// NextPageToken returns the token of the next page, or an empty string on the last page
+func (m *Metadata) NextPageToken() string {
+	if !m.HasNext {
+		return ""
+	}
+	return m.Cursor
+}
+
+// PageTokenResponse wraps the items of the current page in an AIP-158 response envelope
+//
+// Example:
+//
+//	response := metadata.PageTokenResponse(users)
+//	// {"items": [...], "next_page_token": "..."}
+func (m *Metadata) PageTokenResponse(items interface{}) PageTokenResponse {
+	return PageTokenResponse{Items: items, NextPageToken: m.NextPageToken()}
+}
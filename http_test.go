@@ -0,0 +1,327 @@
+package metakit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users?page=2&page_size=20&sort=name&sort_direction=desc&fields=id,name", nil)
+
+	metadata, err := FromRequest(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, metadata.Page)
+	assert.Equal(t, 20, metadata.PageSize)
+	assert.Equal(t, "name", metadata.Sort)
+	assert.Equal(t, "desc", metadata.SortDirection)
+	assert.Equal(t, []string{"id", "name"}, metadata.SelectedFields)
+
+	r = httptest.NewRequest(http.MethodGet, "/users?page=abc", nil)
+	_, err = FromRequest(r)
+	assert.Error(t, err)
+}
+
+func TestFromRequestCleansFields(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users?fields=name,%20,email,name", nil)
+
+	metadata, err := FromRequest(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"name", "email"}, metadata.SelectedFields)
+
+	// Remaining fields are still checked against the allowed list
+	metadata.WithValidationRule("fields", "in:name")
+	result := metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_SELECTED_FIELD", result.Errors[0].Code)
+}
+
+func TestFromRequestInFilter(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users?status=active,pending&age=30,%2032,,007&role=admin", nil)
+
+	metadata, err := FromRequest(r, "status", "age")
+	assert.NoError(t, err)
+	assert.Equal(t, []Filter{
+		{Field: "status", Operator: FilterIn, Value: []interface{}{"active", "pending"}},
+		{Field: "age", Operator: FilterIn, Value: []interface{}{int64(30), int64(32), "007"}},
+	}, metadata.Filters)
+
+	clause, args, err := NewMetadata().WithFilterFromQuery("status", "active,pending").GetFilterClause(PostgreSQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "status IN ($1, $2)", clause)
+	assert.Equal(t, []interface{}{"active", "pending"}, args)
+
+	// Empty values add no filter
+	metadata = NewMetadata().WithFilterFromQuery("status", " , ")
+	assert.Empty(t, metadata.Filters)
+}
+
+func TestMiddleware(t *testing.T) {
+	var captured *Metadata
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured, _ = FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Invalid page size is rejected before reaching the handler
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?page_size=1000", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, captured)
+
+	var body struct {
+		Errors []ValidationError `json:"errors"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, 1, len(body.Errors))
+	assert.Equal(t, "page_size", body.Errors[0].Field)
+	assert.Equal(t, "PAGE_SIZE_TOO_LARGE", body.Errors[0].Code)
+
+	// Valid request stores the metadata in the context
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?page=3&page_size=25", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.NotNil(t, captured) {
+		assert.Equal(t, 3, captured.Page)
+		assert.Equal(t, 25, captured.PageSize)
+	}
+}
+
+func TestSparseFieldsets(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users?fields[users]=name,email&fields[posts]=title", nil)
+
+	metadata, err := FromRequest(r)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"users": {"name", "email"},
+		"posts": {"title"},
+	}, metadata.Fieldsets)
+
+	metadata.WithFieldset("users")
+	assert.Equal(t, []string{"name", "email"}, metadata.SelectedFields)
+
+	// Unknown resource types leave the selection untouched
+	metadata.WithFieldset("comments")
+	assert.Equal(t, []string{"name", "email"}, metadata.SelectedFields)
+}
+
+func TestHALLinks(t *testing.T) {
+	base := "https://api.example.com/users"
+	href := func(page int) map[string]string {
+		return map[string]string{"href": fmt.Sprintf("%s?page=%d&page_size=10", base, page)}
+	}
+
+	tests := []struct {
+		name     string
+		page     int
+		expected map[string]map[string]string
+	}{
+		{"first page", 1, map[string]map[string]string{
+			"self": href(1), "first": href(1), "next": href(2), "last": href(5),
+		}},
+		{"middle page", 3, map[string]map[string]string{
+			"self": href(3), "first": href(1), "prev": href(2), "next": href(4), "last": href(5),
+		}},
+		{"last page", 5, map[string]map[string]string{
+			"self": href(5), "first": href(1), "prev": href(4), "last": href(5),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := NewMetadata().WithPage(tt.page).WithPageSize(10)
+			metadata.TotalRows = 50
+			metadata.ValidateAndSetDefaults()
+			assert.Equal(t, tt.expected, metadata.HALLinks(base))
+		})
+	}
+
+	// Existing query parameters are preserved
+	metadata := NewMetadata()
+	links := metadata.HALLinks(base + "?status=active")
+	assert.Equal(t, base+"?page=1&page_size=10&status=active", links["self"]["href"])
+}
+
+func TestPageToken(t *testing.T) {
+	db := setupTestDB(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/users?page_size=3", nil)
+	metadata, err := FromPageTokenRequest(r, "id")
+	assert.NoError(t, err)
+
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	first := metadata.PageTokenResponse(users)
+	assert.Equal(t, 3, len(users))
+	assert.NotEmpty(t, first.NextPageToken)
+
+	// The token resumes after the last row of the first page
+	r = httptest.NewRequest(http.MethodGet, "/users?page_size=3&page_token="+url.QueryEscape(first.NextPageToken), nil)
+	metadata, err = FromPageTokenRequest(r, "id")
+	assert.NoError(t, err)
+
+	users = nil
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	second := metadata.PageTokenResponse(users)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, uint(4), users[0].ID)
+	assert.Empty(t, second.NextPageToken)
+
+	r = httptest.NewRequest(http.MethodGet, "/users?page_size=-1", nil)
+	_, err = FromPageTokenRequest(r, "id")
+	assert.Error(t, err)
+}
+
+func TestBindRequestParamNames(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users?limit=20&offset=40&order_by=name&page_size=5", nil)
+
+	metadata := NewMetadata().WithParamNames(map[string]string{
+		"page_size": "limit",
+		"sort":      "order_by",
+	})
+	assert.NoError(t, metadata.BindRequest(r))
+	assert.Equal(t, 3, metadata.Page)
+	assert.Equal(t, 20, metadata.PageSize)
+	assert.Equal(t, 40, metadata.GetOffset())
+	assert.Equal(t, "name", metadata.Sort)
+
+	// Errors name the mapped parameter
+	r = httptest.NewRequest(http.MethodGet, "/users?limit=abc", nil)
+	err := NewMetadata().WithParamNames(map[string]string{"page_size": "limit"}).BindRequest(r)
+	assert.ErrorContains(t, err, "invalid limit")
+
+	// An explicit page is kept alongside the offset
+	r = httptest.NewRequest(http.MethodGet, "/users?page=2&offset=40", nil)
+	metadata, err = FromRequest(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, metadata.Page)
+	assert.Equal(t, 40, metadata.GetOffset())
+}
+
+func TestBindRequestKeepsCursorSettings(t *testing.T) {
+	// Absent parameters keep the server's cursor configuration
+	r := httptest.NewRequest(http.MethodGet, "/users?cursor=abc&page_size=5", nil)
+	metadata := NewMetadata().WithCursorField("id").WithCursorOrder("desc").WithDriftToken("token")
+	assert.NoError(t, metadata.BindRequest(r))
+	assert.Equal(t, "abc", metadata.Cursor)
+	assert.Equal(t, "id", metadata.CursorField)
+	assert.Equal(t, "desc", metadata.CursorOrder)
+	assert.Equal(t, "token", metadata.DriftToken)
+	assert.Equal(t, 5, metadata.PageSize)
+
+	// Present parameters replace it
+	r = httptest.NewRequest(http.MethodGet, "/users?cursor_field=created_at&cursor_order=asc&after=xyz", nil)
+	assert.NoError(t, metadata.BindRequest(r))
+	assert.Equal(t, "created_at", metadata.CursorField)
+	assert.Equal(t, "asc", metadata.CursorOrder)
+	assert.Equal(t, "xyz", metadata.After)
+	assert.Equal(t, "abc", metadata.Cursor)
+}
+
+func TestWriteHeaders(t *testing.T) {
+	base := "https://api.example.com/users"
+	metadata := NewMetadata().WithPage(2).WithPageSize(10)
+	metadata.TotalRows = 50
+	metadata.ValidateAndSetDefaults()
+
+	w := httptest.NewRecorder()
+	metadata.WriteHeaders(w, base, "users")
+	assert.Equal(t, "50", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, "5", w.Header().Get("X-Total-Pages"))
+	assert.Equal(t, "users 10-19/50", w.Header().Get("Content-Range"))
+	assert.Equal(t, `<`+base+`?page=1&page_size=10>; rel="first", `+
+		`<`+base+`?page=1&page_size=10>; rel="prev", `+
+		`<`+base+`?page=3&page_size=10>; rel="next", `+
+		`<`+base+`?page=5&page_size=10>; rel="last"`, w.Header().Get("Link"))
+
+	// Only the selected headers are written
+	w = httptest.NewRecorder()
+	metadata.WithResponseHeaders(HeaderTotalCount|HeaderContentRange).WriteHeaders(w, base, "users")
+	assert.Equal(t, "50", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, "users 10-19/50", w.Header().Get("Content-Range"))
+	assert.Empty(t, w.Header().Get("X-Total-Pages"))
+	assert.Empty(t, w.Header().Get("Link"))
+
+	// Pages past the end and unknown totals
+	metadata = NewMetadata().WithPage(9).WithPageSize(10)
+	metadata.TotalRows = 50
+	metadata.ValidateAndSetDefaults()
+	w = httptest.NewRecorder()
+	metadata.WriteHeaders(w, base, "users")
+	assert.Equal(t, "users */50", w.Header().Get("Content-Range"))
+
+	metadata = NewMetadata()
+	metadata.TotalRows = -1
+	w = httptest.NewRecorder()
+	metadata.WriteHeaders(w, base, "users")
+	assert.Empty(t, w.Header().Get("X-Total-Count"))
+	assert.Equal(t, "users */*", w.Header().Get("Content-Range"))
+}
+
+func TestFromRequestFieldsWildcard(t *testing.T) {
+	db := setupTestDB(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/users?fields=*,name", nil)
+	metadata, err := FromRequest(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*"}, metadata.SelectedFields)
+	assert.Equal(t, "SELECT * FROM `users` LIMIT 10", DryRunPaginate(db.Model(&User{}), metadata))
+
+	// Empty values select nothing explicitly
+	for _, query := range []string{"fields=", "fields=%20", "fields=,,"} {
+		r = httptest.NewRequest(http.MethodGet, "/users?"+query, nil)
+		metadata, err = FromRequest(r)
+		assert.NoError(t, err)
+		assert.Empty(t, metadata.SelectedFields, query)
+		assert.Equal(t, []string{"*"}, metadata.GetSelectedFields(), query)
+	}
+
+	// Fields set directly are normalized too
+	metadata = NewMetadata()
+	metadata.SelectedFields = []string{"name", "*"}
+	assert.Equal(t, []string{"*"}, metadata.GetSelectedFields())
+	var users []User
+	assert.NoError(t, Paginate(db.Model(&User{}), metadata, &users))
+	assert.Equal(t, []string{"*"}, metadata.SelectedFields)
+	assert.Equal(t, 5, len(users))
+
+	metadata = NewMetadata()
+	metadata.SelectedFields = []string{""}
+	metadata.ValidateAndSetDefaults()
+	assert.Empty(t, metadata.SelectedFields)
+}
+
+func TestFromRequestSortString(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users?sort=priority,-created_at", nil)
+	metadata, err := FromRequest(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []SortField{
+		{Field: "priority", Direction: Asc},
+		{Field: "created_at", Direction: Desc},
+	}, metadata.SortFields)
+
+	// Each field is checked against the allowed list
+	metadata.WithValidationRule("sort", "in:priority,created_at")
+	assert.True(t, metadata.Validate().IsValid)
+	metadata.WithValidationRule("sort", "in:priority")
+	result := metadata.Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_SORT_FIELD", result.Errors[0].Code)
+
+	// A single field without prefix keeps sort_direction
+	r = httptest.NewRequest(http.MethodGet, "/users?sort=name&sort_direction=desc", nil)
+	metadata, err = FromRequest(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "name", metadata.Sort)
+	assert.Equal(t, "desc", metadata.SortDirection)
+	assert.Empty(t, metadata.SortFields)
+
+	metadata = NewMetadata().WithSortString("-name")
+	assert.Equal(t, "name", metadata.Sort)
+	assert.Equal(t, "desc", metadata.SortDirection)
+}
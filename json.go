@@ -0,0 +1,28 @@
+package metakit
+
+// metadataFields has the fields of Metadata without its methods
+type metadataFields Metadata
+
+// PublicMetadata is the JSON view of Metadata returned by PublicView. It encodes like
+// Metadata, without cursor internals (cursor_field, cursor_order) and debug settings.
+type PublicMetadata struct {
+	metadataFields
+
+	// The outer fields shadow the embedded ones and are omitted while empty
+	CursorField string     `json:"cursor_field,omitempty"`
+	CursorOrder string     `json:"cursor_order,omitempty"`
+	Debug       bool       `json:"debug,omitempty"`
+	DebugInfo   *DebugInfo `json:"debug_info,omitempty"`
+}
+
+// PublicView returns a view of the metadata for API responses that omits cursor internals
+// and debug settings. Encoding the metadata itself still includes every field.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("id")
+//	data, _ := json.Marshal(metadata.PublicView())
+//	// data has no "cursor_field", "cursor_order" or "debug" keys
+func (m *Metadata) PublicView() PublicMetadata {
+	return PublicMetadata{metadataFields: metadataFields(*m)}
+}
@@ -0,0 +1,70 @@
+package metakit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataPublicView(t *testing.T) {
+	metadata := NewMetadata().WithCursorField("id").WithCursorOrder("desc").WithDebug(true)
+
+	data, err := json.Marshal(metadata.PublicView())
+	assert.NoError(t, err)
+	var public map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &public))
+	assert.NotContains(t, public, "cursor_field")
+	assert.NotContains(t, public, "cursor_order")
+	assert.NotContains(t, public, "debug")
+	assert.Contains(t, public, "page_size")
+	assert.Contains(t, public, "cursor")
+
+	// The view leaves the metadata unchanged
+	assert.Equal(t, "id", metadata.CursorField)
+	assert.True(t, metadata.Debug)
+}
+
+func TestMetadataDefaultEncoding(t *testing.T) {
+	metadata := NewMetadata().WithPage(2).WithCursorField("id").WithCursorOrder("desc").WithDebug(true)
+	metadata.PublicView()
+
+	// Values and pointers encode every field the same way
+	byPointer, err := json.Marshal(metadata)
+	assert.NoError(t, err)
+	byValue, err := json.Marshal(*metadata)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(byPointer), string(byValue))
+
+	assert.JSONEq(t, `{"page":2,"page_size":10,"sort":"","sort_direction":"asc","total_rows":0,"total_pages":0,`+
+		`"has_next":false,"has_previous":false,"from_row":0,"to_row":0,"cursor":"","cursor_field":"id",`+
+		`"cursor_order":"desc","fields":null,"debug":true}`, string(byPointer))
+
+	// Metadata embedded in a response keeps its own keys
+	data, err := json.Marshal(struct {
+		Metadata *Metadata `json:"metadata"`
+		Total    int       `json:"total"`
+	}{metadata, 3})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"total":3`)
+	assert.Contains(t, string(data), `"cursor_field":"id"`)
+}
+
+func TestTypedSortDirection(t *testing.T) {
+	metadata := NewMetadata().WithSort("created_at").WithSortDir(Desc)
+	assert.Equal(t, "desc", metadata.SortDirection)
+	assert.True(t, metadata.Validate().IsValid)
+	assert.Equal(t, "created_at desc", metadata.GetSortClause())
+
+	// Directions are encoded as lowercase strings
+	data, err := json.Marshal(metadata.WithSortFields([]SortField{{Field: "created_at", Direction: Desc}, {Field: "id", Direction: Asc}}))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"sort_direction":"desc"`)
+	assert.Contains(t, string(data), `"sort_fields":[{"field":"created_at","direction":"desc"},{"field":"id","direction":"asc"}]`)
+
+	var decoded Metadata
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, Desc, SortDirection(decoded.SortDirection))
+	assert.Equal(t, []SortField{{Field: "created_at", Direction: Desc}, {Field: "id", Direction: Asc}}, decoded.SortFields)
+	assert.Equal(t, "created_at desc, id asc", decoded.GetSortClause())
+}
@@ -0,0 +1,145 @@
+package metakit
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MergeRequest merges the client-supplied request metadata over base, the server's policy, and
+// returns the result as new metadata, leaving both unchanged. The client's page, page size, offset,
+// sort, cursors, selected fields, search term and drift token replace the server's defaults and its
+// filters are added to the server's, while validation rules, allowed fields, caps and every other
+// setting come from base. Zero values in req keep base's value, so bind requests into a zero
+// Metadata, e.g. with BindRequest on new(Metadata), to keep the server's defaults for absent parameters.
+// The page size is clamped to base's "page_size" max: and min: rules, so clients cannot exceed them.
+//
+// Example:
+//
+//	policy := NewMetadata().WithPageSize(20).WithSort("created_at").
+//	  WithValidationRule("page_size", "max:50").
+//	  WithAllowedFields("id", "name", "created_at")
+//	metadata := policy.MergeRequest(NewMetadata().WithPageSize(1000))
+//	// metadata.PageSize == 50, metadata.Sort == "created_at"
+func (base *Metadata) MergeRequest(req *Metadata) *Metadata {
+	merged := *base
+	merged.cloneSettings()
+	merged.DebugInfo = nil
+
+	if req.Page != 0 {
+		merged.Page = req.Page
+	}
+	if req.PageSize != 0 {
+		merged.PageSize = req.PageSize
+	}
+	if req.Offset != nil {
+		merged.WithOffset(*req.Offset)
+	}
+	if len(req.SortFields) > 0 {
+		merged.WithSortFields(slices.Clone(req.SortFields))
+	} else if req.Sort != "" {
+		merged.Sort, merged.SortFields = req.Sort, nil
+		if req.SortDirection != "" {
+			merged.SortDirection = req.SortDirection
+		}
+	}
+	if req.Cursor != "" {
+		merged.Cursor = req.Cursor
+	}
+	if req.After != "" {
+		merged.After = req.After
+	}
+	if req.Before != "" {
+		merged.Before = req.Before
+	}
+	if merged.CursorField == "" {
+		merged.CursorField = req.CursorField
+	}
+	if req.CursorOrder != "" {
+		merged.CursorOrder = req.CursorOrder
+	}
+	if len(req.SelectedFields) > 0 {
+		merged.SelectedFields = slices.Clone(req.SelectedFields)
+	}
+	for resource, fields := range req.Fieldsets {
+		if merged.Fieldsets == nil {
+			merged.Fieldsets = make(map[string][]string)
+		}
+		merged.Fieldsets[resource] = slices.Clone(fields)
+	}
+	merged.Filters = append(merged.Filters, req.Filters...)
+	if req.SearchTerm != "" {
+		merged.SearchTerm = req.SearchTerm
+	}
+	if req.DriftToken != "" {
+		merged.DriftToken = req.DriftToken
+	}
+
+	if merged.fromEnd() {
+		merged.PageSize = -merged.clampToPageSizeRule(merged.pageSize())
+	} else {
+		merged.PageSize = merged.clampToPageSizeRule(merged.PageSize)
+	}
+	return &merged
+}
+
+// Clone returns a copy of the metadata that shares no slices, maps or pointers with it, except
+// the CountCache, so that paginating with the copy leaves the original unchanged.
+//
+// Example:
+//
+//	result := request.Clone()
+//	err := Paginate(db.Model(&User{}), result, &users)
+//	log.Printf("request %+v, result %+v", request, result)
+func (m *Metadata) Clone() *Metadata {
+	clone := *m
+	clone.cloneSettings()
+	if m.DebugInfo != nil {
+		debugInfo := *m.DebugInfo
+		debugInfo.Args = slices.Clone(debugInfo.Args)
+		clone.DebugInfo = &debugInfo
+	}
+	return &clone
+}
+
+// cloneSettings copies the slices and maps of the metadata, so that changes to a copy made
+// with a struct assignment don't reach the original
+func (m *Metadata) cloneSettings() {
+	m.SortFields = slices.Clone(m.SortFields)
+	m.SelectedFields = slices.Clone(m.SelectedFields)
+	m.Filters = slices.Clone(m.Filters)
+	m.SearchFields = slices.Clone(m.SearchFields)
+	m.AllowedFields = slices.Clone(m.AllowedFields)
+	m.Fieldsets = maps.Clone(m.Fieldsets)
+	m.ValidationRules = maps.Clone(m.ValidationRules)
+	m.ParamNames = maps.Clone(m.ParamNames)
+	m.JSONSortFields = maps.Clone(m.JSONSortFields)
+	m.SortCollations = maps.Clone(m.SortCollations)
+	m.SortCoalesce = maps.Clone(m.SortCoalesce)
+	m.CursorExtra = maps.Clone(m.CursorExtra)
+	m.CursorSecret = slices.Clone(m.CursorSecret)
+	if m.Offset != nil {
+		offset := *m.Offset
+		m.Offset = &offset
+	}
+	if m.KnownTotal != nil {
+		total := *m.KnownTotal
+		m.KnownTotal = &total
+	}
+}
+
+// clampToPageSizeRule limits size to the bound of the "page_size" max: or min: validation rule
+func (m *Metadata) clampToPageSizeRule(size int) int {
+	rule := m.ValidationRules["page_size"]
+	if value, ok := strings.CutPrefix(rule, "max:"); ok {
+		if max, err := strconv.Atoi(value); err == nil && size > max {
+			return max
+		}
+	} else if value, ok := strings.CutPrefix(rule, "min:"); ok {
+		if min, err := strconv.Atoi(value); err == nil && size < min {
+			return min
+		}
+	}
+	return size
+}
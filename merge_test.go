@@ -0,0 +1,44 @@
+package metakit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeRequest(t *testing.T) {
+	policy := NewMetadata().WithPageSize(20).WithSort("created_at").WithSortDirection("desc").
+		WithValidationRule("page_size", "max:50").
+		WithAllowedFields("id", "name", "created_at")
+
+	// Client page sizes beyond the server max are clamped
+	metadata := policy.MergeRequest(NewMetadata().WithPage(3).WithPageSize(1000))
+	assert.Equal(t, 3, metadata.Page)
+	assert.Equal(t, 50, metadata.PageSize)
+	assert.Equal(t, "created_at", metadata.Sort)
+	assert.Equal(t, "desc", metadata.SortDirection)
+	assert.True(t, metadata.Validate().IsValid)
+
+	// Absent parameters keep the server defaults
+	r := httptest.NewRequest(http.MethodGet, "/users?sort=name&page=2", nil)
+	req := new(Metadata)
+	assert.NoError(t, req.BindRequest(r))
+	metadata = policy.MergeRequest(req)
+	assert.Equal(t, 2, metadata.Page)
+	assert.Equal(t, 20, metadata.PageSize)
+	assert.Equal(t, "name", metadata.Sort)
+	assert.Equal(t, "desc", metadata.SortDirection)
+
+	// The server's allow-list still applies to the client's choices
+	metadata = policy.MergeRequest(NewMetadata().WithSort("password"))
+	result := metadata.Validate()
+	assert.False(t, result.IsValid)
+
+	// The policy is left unchanged
+	metadata.WithValidationRule("page_size", "max:500").WithFilter("name", FilterEq, "john")
+	assert.Equal(t, "max:50", policy.ValidationRules["page_size"])
+	assert.Empty(t, policy.Filters)
+	assert.Equal(t, 20, policy.PageSize)
+}
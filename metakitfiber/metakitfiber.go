@@ -0,0 +1,80 @@
+// Package metakitfiber binds metakit pagination metadata from fiber requests. It lives in its own
+// module so that applications not using fiber don't pull it in through metakit.
+package metakitfiber
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	metakit "github.com/nccapo/paginate-metakit"
+)
+
+// fiberQuery holds the pagination query parameters parsed by fiber's QueryParser
+type fiberQuery struct {
+	Page          int    `query:"page"`
+	PageSize      int    `query:"page_size"`
+	Offset        *int   `query:"offset"`
+	Sort          string `query:"sort"`
+	SortDirection string `query:"sort_direction"`
+	Cursor        string `query:"cursor"`
+	CursorField   string `query:"cursor_field"`
+	CursorOrder   string `query:"cursor_order"`
+	After         string `query:"after"`
+	Before        string `query:"before"`
+	Fields        string `query:"fields"`
+	Debug         bool   `query:"debug"`
+}
+
+// BindMetadata parses and validates pagination metadata from the query parameters of a fiber request.
+// It accepts the same parameters as metakit.FromRequest. Malformed parameters return a plain error; invalid
+// metadata returns a *metakit.InvalidMetadataError (errors.Is metakit.ErrValidation), both suitable for a
+// 400 response. Defaults are applied to the returned metadata.
+//
+// Example:
+//
+//	app.Get("/users", func(c *fiber.Ctx) error {
+//	  metadata, err := metakitfiber.BindMetadata(c)
+//	  if err != nil {
+//	    return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+//	  }
+//	  ...
+//	})
+func BindMetadata(c *fiber.Ctx) (*metakit.Metadata, error) {
+	var query fiberQuery
+	if err := c.QueryParser(&query); err != nil {
+		return nil, fmt.Errorf("invalid query parameters: %v", err)
+	}
+
+	m := metakit.NewMetadata()
+	if query.Page != 0 {
+		m.Page = query.Page
+	}
+	if query.PageSize != 0 {
+		m.PageSize = query.PageSize
+	}
+	if query.Offset != nil {
+		m.WithOffset(*query.Offset)
+	}
+	if query.Sort != "" {
+		m.Sort = query.Sort
+	}
+	if query.SortDirection != "" {
+		m.SortDirection = query.SortDirection
+	}
+	m.Cursor = query.Cursor
+	m.CursorField = query.CursorField
+	m.CursorOrder = query.CursorOrder
+	m.After = query.After
+	m.Before = query.Before
+	if query.Fields != "" {
+		m.WithFields(strings.Split(query.Fields, ",")...)
+	}
+	m.Debug = query.Debug
+
+	if err := m.Validate().Err(); err != nil {
+		return nil, err
+	}
+	m.ValidateAndSetDefaults()
+	return m, nil
+}
@@ -0,0 +1,47 @@
+package metakitfiber
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	metakit "github.com/nccapo/paginate-metakit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindMetadata(t *testing.T) {
+	app := fiber.New()
+	app.Get("/users", func(c *fiber.Ctx) error {
+		metadata, err := BindMetadata(c)
+		var invalid *metakit.InvalidMetadataError
+		if errors.As(err, &invalid) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": invalid.Errors})
+		}
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		return c.JSON(metadata)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/users?page=2&page_size=20&sort=name&sort_direction=desc&fields=id,name", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var metadata metakit.Metadata
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&metadata))
+	assert.Equal(t, 2, metadata.Page)
+	assert.Equal(t, 20, metadata.PageSize)
+	assert.Equal(t, "name", metadata.Sort)
+	assert.Equal(t, "desc", metadata.SortDirection)
+	assert.Equal(t, []string{"id", "name"}, metadata.SelectedFields)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/users?page_size=500", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/users?page=abc", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
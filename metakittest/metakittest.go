@@ -0,0 +1,85 @@
+// Package metakittest provides test utilities for code paginating with metakit, such as checking
+// that offset and cursor pagination agree while migrating from one to the other.
+package metakittest
+
+import (
+	"fmt"
+	"reflect"
+
+	metakit "github.com/nccapo/paginate-metakit"
+	"gorm.io/gorm"
+)
+
+// TestingT is the subset of *testing.T used to report failures
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// AssertConsistent checks that offset and cursor pagination return the same rows for the page
+// of offsetMeta. The cursor pages are walked from the start with cursorMeta's cursor settings
+// and offsetMeta's page size until they reach that page, and the rows of both modes are compared.
+// dest is a pointer to a slice of the row type; it receives the rows of the offset page.
+// Both metadata are left unchanged, and the orderings must match for the check to be meaningful.
+// Failures are reported on t, and false is returned.
+//
+// Example:
+//
+//	func TestMigration(t *testing.T) {
+//	  offset := metakit.NewMetadata().WithPage(3).WithPageSize(10).WithSort("id")
+//	  cursor := metakit.NewMetadata().WithCursorField("id")
+//	  metakittest.AssertConsistent(t, db.Model(&User{}), offset, cursor, &[]User{})
+//	}
+func AssertConsistent(t TestingT, db *gorm.DB, offsetMeta, cursorMeta *metakit.Metadata, dest any) bool {
+	t.Helper()
+
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Pointer || destValue.IsNil() || destValue.Elem().Kind() != reflect.Slice {
+		t.Errorf("metakittest: dest must be a non-nil pointer to a slice, got %T", dest)
+		return false
+	}
+
+	offsetPage := *offsetMeta
+	if err := metakit.Paginate(db.Session(&gorm.Session{}), &offsetPage, dest); err != nil {
+		t.Errorf("metakittest: offset page %d failed: %v", offsetMeta.Page, err)
+		return false
+	}
+
+	cursorRows, err := cursorPage(db, offsetMeta, cursorMeta, destValue.Type().Elem())
+	if err != nil {
+		t.Errorf("metakittest: %v", err)
+		return false
+	}
+
+	offsetRows := destValue.Elem().Interface()
+	if !reflect.DeepEqual(offsetRows, cursorRows) {
+		t.Errorf("metakittest: page %d differs between offset and cursor pagination:\noffset: %+v\ncursor: %+v",
+			offsetPage.Page, offsetRows, cursorRows)
+		return false
+	}
+	return true
+}
+
+// cursorPage walks the cursor pages of cursorMeta with the page size of offsetMeta and returns
+// the rows of the page numbered like offsetMeta's, as a slice of sliceType
+func cursorPage(db *gorm.DB, offsetMeta, cursorMeta *metakit.Metadata, sliceType reflect.Type) (any, error) {
+	page := max(offsetMeta.Page, 1)
+	cursor := cursorMeta.Cursor
+	for i := 1; ; i++ {
+		m := *cursorMeta
+		m.Page, m.PageSize, m.Cursor = 1, offsetMeta.PageSize, cursor
+
+		rows := reflect.New(sliceType)
+		rows.Elem().Set(reflect.MakeSlice(sliceType, 0, 0))
+		if err := metakit.Paginate(db.Session(&gorm.Session{}), &m, rows.Interface()); err != nil {
+			return nil, fmt.Errorf("cursor page %d failed: %w", i, err)
+		}
+		if i == page || !m.HasNext {
+			if i < page {
+				rows.Elem().SetLen(0)
+			}
+			return rows.Elem().Interface(), nil
+		}
+		cursor = m.Cursor
+	}
+}
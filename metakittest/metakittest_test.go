@@ -0,0 +1,78 @@
+package metakittest
+
+import (
+	"fmt"
+	"testing"
+
+	metakit "github.com/nccapo/paginate-metakit"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type item struct {
+	ID       uint `gorm:"primarykey"`
+	Name     string
+	Priority int
+}
+
+// recorder records the failures reported by AssertConsistent
+type recorder struct {
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 11; i++ {
+		if err := db.Create(&item{Name: fmt.Sprintf("item %02d", 12-i), Priority: i % 3}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestAssertConsistent(t *testing.T) {
+	db := setupDB(t)
+
+	// Both modes agree on every page when ordered the same way, including pages past the end
+	for page := 1; page <= 5; page++ {
+		offset := metakit.NewMetadata().WithPage(page).WithPageSize(3).WithSort("id")
+		cursor := metakit.NewMetadata().WithCursorField("id")
+		var items []item
+		assert.True(t, AssertConsistent(t, db.Model(&item{}), offset, cursor, &items), "page %d", page)
+		assert.Zero(t, offset.TotalRows)
+		assert.Empty(t, cursor.Cursor)
+	}
+
+	// Ties are broken the same way with a tie-break column
+	offset := metakit.NewMetadata().WithPage(2).WithPageSize(4).
+		WithSortFields([]metakit.SortField{{Field: "priority", Direction: metakit.Desc}, {Field: "id", Direction: metakit.Desc}})
+	cursor := metakit.NewMetadata().WithCursorField("priority").WithCursorOrder("desc").WithCursorTieBreak("id")
+	var items []item
+	assert.True(t, AssertConsistent(t, db.Model(&item{}), offset, cursor, &items))
+	assert.Len(t, items, 4)
+
+	// Different orderings are reported
+	r := &recorder{}
+	offset = metakit.NewMetadata().WithPage(2).WithPageSize(3).WithSort("name")
+	assert.False(t, AssertConsistent(r, db.Model(&item{}), offset, metakit.NewMetadata().WithCursorField("id"), &items))
+	if assert.Len(t, r.failures, 1) {
+		assert.Contains(t, r.failures[0], "page 2 differs")
+	}
+
+	r = &recorder{}
+	assert.False(t, AssertConsistent(r, db.Model(&item{}), offset, metakit.NewMetadata().WithCursorField("id"), items))
+	assert.Len(t, r.failures, 1)
+}
@@ -1,17 +1,44 @@
 package metakit
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// collationPattern restricts collation names to characters that cannot break out of the ORDER BY clause
+	collationPattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+
+	// identifierPattern matches plain, unquoted SQL identifiers
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// qualifiedIdentifierPattern matches identifiers optionally qualified by a table name
+	qualifiedIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+	// jsonPathPattern matches dot-separated JSON object keys
+	jsonPathPattern = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*$`)
+
+	// countExpressionPattern matches COUNT(*), COUNT(1) and COUNT of an optionally distinct, qualified column
+	countExpressionPattern = regexp.MustCompile(`(?i)^COUNT\(\s*(\*|1|(DISTINCT\s+)?[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?)\s*\)$`)
+
+	// regexRules caches the compiled patterns of "regex:" validation rules
+	regexRules sync.Map
 )
 
 // ValidationError represents a single validation error with field-specific information.
 // It provides both human-readable messages and machine-readable error codes.
 type ValidationError struct {
-	Field   string // The field that failed validation
-	Message string // Human-readable error message
-	Code    string // Machine-readable error code
+	Field   string `json:"field"`   // The field that failed validation
+	Message string `json:"message"` // Human-readable error message
+	Code    string `json:"code"`    // Machine-readable error code
 }
 
 // ValidationResult represents the result of metadata validation.
@@ -21,6 +48,95 @@ type ValidationResult struct {
 	Errors  []ValidationError // List of validation errors if any
 }
 
+// CountMode defines how the total number of rows is obtained during pagination.
+type CountMode int
+
+const (
+	// CountExact runs a COUNT query to compute TotalRows (default)
+	CountExact CountMode = iota
+
+	// CountNone skips the COUNT query entirely. One extra row is fetched to
+	// detect whether more rows exist, which is ideal for infinite-scroll feeds.
+	CountNone
+
+	// CountApprox uses the database's table statistics to estimate TotalRows.
+	// Falls back to CountExact when the dialect provides no estimate.
+	CountApprox
+
+	// CountWindow reads TotalRows from a COUNT(*) OVER() column added to the data query,
+	// saving the separate COUNT query. Pages past the end report a total of 0.
+	// Only the GORM path supports it; CountContext rejects it with UNSUPPORTED_COUNT_MODE.
+	CountWindow
+)
+
+// CountStrategy is the name WithCountStrategy uses for CountMode
+type CountStrategy = CountMode
+
+// rowCounter provides the ways a query path can count its rows
+type rowCounter struct {
+	exact  func() (int64, error)
+	approx func() (int64, bool) // nil when no estimate is available
+	sql    func() string        // renders the exact count query for debugging; nil when it is not a query
+}
+
+// DebugInfo holds the queries of the last page, filled in debug mode (see WithDebug)
+type DebugInfo struct {
+	// SQL is the data query
+	SQL string `json:"sql"`
+
+	// Args are the values bound to the data query, in order, to replay it exactly. GORM inlines
+	// values into SQL and reports the statement's bound vars here, without LIMIT and OFFSET.
+	Args []any `json:"args,omitempty"`
+
+	// CountSQL is the COUNT query with the grouped, distinct and subquery rewrites applied;
+	// empty when no count query was built
+	CountSQL string `json:"count_sql,omitempty"`
+
+	// Duration is the time taken by the count and data queries
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// countWith counts rows following the strategy. It is the single place deciding how the
+// GORM and SQL paths count; false is returned when the strategy leaves the total uncounted.
+func countWith(strategy CountStrategy, counter rowCounter) (int64, bool, error) {
+	switch strategy {
+	case CountNone, CountWindow:
+		return 0, false, nil
+	case CountApprox:
+		if counter.approx != nil {
+			if total, ok := counter.approx(); ok {
+				return total, true, nil
+			}
+		}
+	}
+
+	total, err := counter.exact()
+	if err != nil {
+		return 0, false, err
+	}
+	return total, true, nil
+}
+
+// withCountTimeout runs count under the metadata's count timeout. A count that times out
+// while the parent context is still alive reports an unknown total of -1 instead of an error.
+func withCountTimeout(parent context.Context, m *Metadata, count func(ctx context.Context) (int64, error)) (int64, error) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	if m.CountTimeout <= 0 {
+		return count(parent)
+	}
+
+	ctx, cancel := context.WithTimeout(parent, m.CountTimeout)
+	defer cancel()
+
+	total, err := count(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+		return -1, nil
+	}
+	return total, err
+}
+
 // Metadata represents pagination and sorting metadata for database queries.
 // It supports both offset-based and cursor-based pagination.
 //
@@ -45,12 +161,23 @@ type Metadata struct {
 	// PageSize is capacity of per page items
 	PageSize int `form:"page_size" json:"page_size"`
 
+	// Offset overrides the page-derived offset when set
+	Offset *int `form:"offset" json:"offset,omitempty"`
+
 	// Sort is string type which defines the sort field
 	Sort string `form:"sort" json:"sort"`
 
 	// SortDirection defines sort direction (asc/desc)
 	SortDirection string `form:"sort_direction" json:"sort_direction"`
 
+	// SortFields orders by several columns in the given order; Sort and SortDirection mirror the first
+	SortFields []SortField `json:"sort_fields,omitempty"`
+
+	// AppliedSort and AppliedDirection report the ordering effectively used after defaulting,
+	// so clients can reflect the server's actual sort state
+	AppliedSort      string `json:"applied_sort,omitempty"`
+	AppliedDirection string `json:"applied_direction,omitempty"`
+
 	// TotalRows defines the quantity of total rows
 	TotalRows int64 `json:"total_rows"`
 
@@ -69,19 +196,143 @@ type Metadata struct {
 	// ToRow indicates the ending row number of the current page
 	ToRow int64 `json:"to_row"`
 
+	// Truncated indicates that the page size exceeded MaxRows and the page was capped
+	Truncated bool `json:"truncated,omitempty"`
+
 	// Cursor-based pagination fields
 	Cursor      string `form:"cursor" json:"cursor"`
 	CursorField string `form:"cursor_field" json:"cursor_field"`
 	CursorOrder string `form:"cursor_order" json:"cursor_order"`
 
+	// CursorFieldType declares the kind of the cursor column; decoded cursors are checked against it
+	CursorFieldType reflect.Kind `json:"-"`
+
+	// CursorTieBreak is a unique column ordering rows with equal cursor values; cursors then hold both values
+	CursorTieBreak string `json:"-"`
+
+	// CursorTieBreakOrder is the order of the tie-break column; empty follows CursorOrder
+	CursorTieBreakOrder string `json:"-"`
+
+	// After and Before bound a cursor window: rows strictly after and strictly before the given cursors
+	After  string `form:"after" json:"after,omitempty"`
+	Before string `form:"before" json:"before,omitempty"`
+
 	// Field selection - choose specific fields to include in the result
 	SelectedFields []string `form:"fields" json:"fields"`
 
+	// Fieldsets holds JSON:API sparse fieldsets keyed by resource type
+	Fieldsets map[string][]string `json:"-"`
+
+	// Filters - conditions applied to both the data and the count query
+	Filters []Filter `json:"filters,omitempty"`
+
+	// Search - term matched case-insensitively against any of the search fields
+	SearchTerm     string   `json:"-"`
+	SearchFields   []string `json:"-"`
+	SearchFullText bool     `json:"-"`
+
+	// FTS - SQLite FTS5 table matched against the term, ranking rows by relevance
+	FTSTable string `json:"-"`
+	FTSTerm  string `json:"-"`
+
+	// AllowedFields restricts the sort, selected, cursor, filter and search fields
+	AllowedFields []string `json:"-"`
+
+	// CursorSecret signs generated cursors and verifies incoming ones
+	CursorSecret []byte `json:"-"`
+
+	// CursorState makes cursors carry the page size, cursor field and cursor order
+	CursorState bool `json:"-"`
+
+	// CursorExtra is arbitrary data carried inside generated cursors and decoded from incoming ones
+	CursorExtra map[string]any `json:"-"`
+
+	// HideCursorKeys removes the key columns added to the selection of cursor pages from map rows
+	HideCursorKeys bool `json:"-"`
+
+	// DriftColumn is the column whose maximum, with TotalRows, makes up the DriftToken
+	DriftColumn string `json:"-"`
+
+	// DriftToken identifies the state of the data a page was read from; clients send it back
+	// with the next page request
+	DriftToken string `form:"drift_token" json:"drift_token,omitempty"`
+
+	// Stale reports that the data changed since the page of the DriftToken sent by the client
+	Stale bool `json:"stale,omitempty"`
+
+	// Snapshot is an exported PostgreSQL snapshot that page transactions import
+	Snapshot string `json:"-"`
+
+	// ResponseHeaders selects the headers written by WriteHeaders; zero writes all of them
+	ResponseHeaders ResponseHeader `json:"-"`
+
 	// Debug mode - provides additional information for debugging
 	Debug bool `form:"debug" json:"debug"`
 
+	// DebugInfo holds the data and count queries of the last page in debug mode
+	DebugInfo *DebugInfo `json:"debug_info,omitempty"`
+
 	// ValidationRules - custom validation rules for metadata fields
 	ValidationRules map[string]string `json:"-"`
+
+	// ParamNames maps standard query parameter names (page, page_size, offset, sort, ...)
+	// to the names BindRequest reads instead
+	ParamNames map[string]string `json:"-"`
+
+	// CountMode defines how TotalRows is computed (exact, approximate or skipped)
+	CountMode CountMode `json:"-"`
+
+	// KnownTotal is a total supplied by the caller; when set no COUNT query is executed
+	KnownTotal *int64 `json:"-"`
+
+	// CountTimeout caps the COUNT query; on timeout TotalRows is reported as -1 (unknown)
+	CountTimeout time.Duration `json:"-"`
+
+	// CountCache caches totals by the signature of the count query
+	CountCache *CountCache `json:"-"`
+
+	// CountExpression replaces COUNT(*) in count queries, e.g. COUNT(1) or COUNT(id)
+	CountExpression string `json:"-"`
+
+	// MaxRows caps the rows returned per request regardless of the page size; 0 disables the cap
+	MaxRows int `json:"-"`
+
+	// MaxOffset caps the row offset of a page; 0 uses the default of math.MaxInt32
+	MaxOffset int64 `json:"-"`
+
+	// AllowNegativePageSize makes a negative PageSize select the last |PageSize| of TotalRows
+	AllowNegativePageSize bool `json:"-"`
+
+	// Placeholder overrides the dialect's bind parameter style in the SQL path
+	Placeholder Placeholder `json:"-"`
+
+	// JSONSortFields maps sortable API fields to values extracted from JSON columns
+	JSONSortFields map[string]JSONSortField `json:"-"`
+
+	// SortCollations maps sort fields to the collation used when ordering by them
+	SortCollations map[string]string `json:"-"`
+
+	// SortCoalesce maps sort fields to the value NULLs are ordered as
+	SortCoalesce map[string]string `json:"-"`
+
+	// PreserveOrder keeps an ORDER BY set on the GORM query instead of ordering by Sort or the
+	// cursor field; in cursor mode empty cursor settings are taken from that order
+	PreserveOrder bool `json:"-"`
+
+	// StableOrder appends StableOrderColumn, the primary key, to the ORDER BY of offset pages as a
+	// final tie-break; GORM fills an empty column from the model's primary key
+	StableOrder       bool   `json:"-"`
+	StableOrderColumn string `json:"-"`
+
+	// RequireSort rejects metadata without a sort or cursor field, ensuring a deterministic ORDER BY
+	RequireSort bool `json:"-"`
+
+	// GroupedCount counts the rows of the query wrapped in a subquery, which is
+	// required to count groups of a GROUP BY query
+	GroupedCount bool `json:"-"`
+
+	// FollowerReads is the staleness of CockroachDB AS OF SYSTEM TIME reads; zero disables them
+	FollowerReads time.Duration `json:"-"`
 }
 
 // NewMetadata creates a new Metadata instance with default values.
@@ -104,6 +355,23 @@ func NewMetadata() *Metadata {
 	}
 }
 
+// Reset restores the metadata to the defaults of NewMetadata in place, clearing the selected fields,
+// cursors, filters, computed totals and every other setting. It allows reusing instances, e.g. from a sync.Pool.
+//
+// Example:
+//
+//	var pool = sync.Pool{New: func() any { return NewMetadata() }}
+//
+//	metadata := pool.Get().(*Metadata)
+//	defer func() { metadata.Reset(); pool.Put(metadata) }()
+func (m *Metadata) Reset() {
+	*m = Metadata{
+		Page:          1,
+		PageSize:      defaultPageSize,
+		SortDirection: "asc",
+	}
+}
+
 // WithPage sets the page number and returns the metadata for method chaining.
 // Page numbers are 1-based.
 //
@@ -128,6 +396,19 @@ func (m *Metadata) WithPageSize(pageSize int) *Metadata {
 	return m
 }
 
+// WithOffset sets an explicit row offset and returns the metadata for method chaining.
+// The offset overrides the value derived from Page and PageSize, which is useful
+// for "load more from row X" scenarios.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPageSize(10).WithOffset(35)
+//	// metadata.GetOffset() == 35
+func (m *Metadata) WithOffset(offset int) *Metadata {
+	m.Offset = &offset
+	return m
+}
+
 // WithSort sets the sort field and returns the metadata for method chaining.
 // The sort field should match a column name in your database.
 //
@@ -137,11 +418,90 @@ func (m *Metadata) WithPageSize(pageSize int) *Metadata {
 //	// metadata.Sort == "created_at"
 func (m *Metadata) WithSort(sort string) *Metadata {
 	m.Sort = sort
+	m.SortFields = nil
+	return m
+}
+
+// WithSortFields sorts by several columns, emitted in ORDER BY in the order given, and returns
+// the metadata for method chaining. Sort and SortDirection are set to the first column.
+// Empty directions default to "asc".
+//
+// Example:
+//
+//	metadata := NewMetadata().WithSortFields([]SortField{
+//	  {Field: "priority", Direction: "desc"},
+//	  {Field: "created_at", Direction: "asc"},
+//	  {Field: "id"},
+//	})
+//	// metadata.GetSortClause() == "priority desc, created_at asc, id asc"
+func (m *Metadata) WithSortFields(fields []SortField) *Metadata {
+	m.SortFields = append([]SortField(nil), fields...)
+	m.syncSortFields()
 	return m
 }
 
+// WithSortString parses a comma-separated sort expression, where a "-" prefix sorts a field in
+// descending order and a "+" prefix or none in ascending order, and returns the metadata for method
+// chaining. Several fields become SortFields; a single field without prefix is set like WithSort,
+// keeping the sort direction. Empty entries are skipped.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithSortString("priority,-created_at")
+//	// metadata.SortFields == []SortField{{Field: "priority", Direction: Asc}, {Field: "created_at", Direction: Desc}}
+func (m *Metadata) WithSortString(sort string) *Metadata {
+	var fields []SortField
+	prefixed := false
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		direction := Asc
+		switch {
+		case strings.HasPrefix(part, "-"):
+			direction, part, prefixed = Desc, part[1:], true
+		case strings.HasPrefix(part, "+"):
+			part, prefixed = part[1:], true
+		}
+		if part = strings.TrimSpace(part); part != "" {
+			fields = append(fields, SortField{Field: part, Direction: direction})
+		}
+	}
+
+	switch {
+	case len(fields) == 0:
+		return m
+	case len(fields) == 1 && !prefixed:
+		return m.WithSort(fields[0].Field)
+	case len(fields) == 1:
+		return m.WithSort(fields[0].Field).WithSortDir(fields[0].Direction)
+	default:
+		return m.WithSortFields(fields)
+	}
+}
+
+// syncSortFields mirrors the first sort field into Sort and SortDirection
+func (m *Metadata) syncSortFields() {
+	if len(m.SortFields) == 0 {
+		return
+	}
+	m.Sort, m.SortDirection = m.SortFields[0].Field, string(m.SortFields[0].Direction)
+	if m.SortDirection == "" {
+		m.SortDirection = "asc"
+	}
+}
+
+// SortDirection is a typed sort direction, encoded as its lowercase string in JSON and forms
+type SortDirection string
+
+const (
+	// Asc sorts in ascending order
+	Asc SortDirection = "asc"
+
+	// Desc sorts in descending order
+	Desc SortDirection = "desc"
+)
+
 // WithSortDirection sets the sort direction and returns the metadata for method chaining.
-// Valid values are "asc" or "desc".
+// Valid values are "asc" or "desc". Use WithSortDir for the typed Asc and Desc constants.
 //
 // Example:
 //
@@ -152,6 +512,16 @@ func (m *Metadata) WithSortDirection(direction string) *Metadata {
 	return m
 }
 
+// WithSortDir sets the sort direction from a typed constant and returns the metadata for method chaining.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithSort("created_at").WithSortDir(Desc)
+//	// metadata.SortDirection == "desc"
+func (m *Metadata) WithSortDir(direction SortDirection) *Metadata {
+	return m.WithSortDirection(string(direction))
+}
+
 // ValidateAndSetDefaults validates and sets default values for the metadata.
 // This method should be called before using the metadata for pagination.
 //
@@ -160,6 +530,11 @@ func (m *Metadata) WithSortDirection(direction string) *Metadata {
 //   - PageSize: 10 (if < 1) or 100 (if > 100)
 //   - SortDirection: "asc" (if empty or invalid)
 //
+// Direction aliases such as "DESC", "ascending", "-" or "-1" are normalized to "asc" or "desc".
+// AppliedSort and AppliedDirection are set to the ordering effectively used.
+// In cursor mode an empty CursorField and CursorOrder are restored from the cursor state
+// (see WithCursorState) or inferred from Sort and SortDirection.
+//
 // Example:
 //
 //	metadata := NewMetadata()
@@ -169,40 +544,102 @@ func (m *Metadata) WithSortDirection(direction string) *Metadata {
 //	// metadata.Page == 1
 //	// metadata.PageSize == 100
 func (m *Metadata) ValidateAndSetDefaults() {
+	// Turn a page counted from the end into the equivalent offset once the total is known;
+	// until the rows are counted the page size stays negative
+	if m.TotalRows > 0 {
+		m.resolveFromEnd()
+	}
+
 	// Set default page
 	if m.Page < 1 {
 		m.Page = 1
 	}
 
-	// Set default page size
-	if m.PageSize < 1 {
-		m.PageSize = 10
-	} else if m.PageSize > 100 {
-		m.PageSize = 100
+	// Reset negative offsets
+	if m.Offset != nil && *m.Offset < 0 {
+		m.WithOffset(0)
 	}
 
-	// Set default sort direction
-	if m.SortDirection == "" {
-		m.SortDirection = "asc"
-	} else if m.SortDirection != "asc" && m.SortDirection != "desc" {
+	// Normalize selected fields set directly, e.g. by binding a request
+	if len(m.SelectedFields) > 0 {
+		m.SelectedFields = cleanFields(m.SelectedFields)
+	}
+
+	// Set default page size and flag pages capped by the row budget
+	if m.fromEnd() {
+		m.PageSize = -clampPageSize(m.pageSize())
+	} else {
+		m.PageSize = clampPageSize(m.PageSize)
+	}
+	m.Truncated = m.MaxRows > 0 && m.pageSize() > m.MaxRows
+
+	// Set default sort directions
+	for i, field := range m.SortFields {
+		m.SortFields[i].Direction = SortDirection(sortFieldDirection(field.Direction))
+	}
+	m.syncSortFields()
+	if direction, ok := normalizeDirection(m.SortDirection); ok && direction != "" {
+		m.SortDirection = direction
+	} else {
 		m.SortDirection = "asc"
 	}
 
+	// Restore cursor state and infer cursor settings from the sort, then normalize cursor order aliases
+	m.restoreCursorState()
+	m.inferCursorSettings()
+	if order, ok := normalizeDirection(m.CursorOrder); ok {
+		m.CursorOrder = order
+	}
+	if order, ok := normalizeDirection(m.CursorTieBreakOrder); ok {
+		m.CursorTieBreakOrder = order
+	}
+
+	// Record the effective ordering
+	m.AppliedSort, m.AppliedDirection = m.Sort, m.SortDirection
+	if m.IsCursorBased() {
+		m.AppliedSort, m.AppliedDirection = m.CursorField, m.CursorOrder
+		if m.AppliedDirection == "" {
+			m.AppliedDirection = "asc"
+		}
+	}
+
 	// Calculate pagination metadata
 	if m.TotalRows > 0 {
-		m.TotalPages = (m.TotalRows + int64(m.PageSize) - 1) / int64(m.PageSize)
-		m.HasNext = m.Page < int(m.TotalPages)
-		m.HasPrevious = m.Page > 1
-		m.FromRow = int64((m.Page-1)*m.PageSize + 1)
-		m.ToRow = int64(m.Page * m.PageSize)
+		offset := m.GetOffset64()
+		limit := int64(m.GetLimit())
+		m.TotalPages = (m.TotalRows + limit - 1) / limit
+		m.HasNext = offset+limit < m.TotalRows
+		m.HasPrevious = offset > 0
+		m.FromRow = offset + 1
+		m.ToRow = offset + limit
 		if m.ToRow > m.TotalRows {
 			m.ToRow = m.TotalRows
 		}
+		// Pages beyond the data must not report a row range past the total
+		if m.FromRow > m.TotalRows {
+			m.FromRow = m.TotalRows
+		}
+	}
+}
+
+// normalizeDirection maps a sort direction or one of its aliases to "asc" or "desc".
+// An empty direction is returned unchanged; false is returned for unknown values.
+func normalizeDirection(direction string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(direction)) {
+	case "":
+		return "", true
+	case "asc", "ascending", "+", "1":
+		return "asc", true
+	case "desc", "descending", "-", "-1":
+		return "desc", true
+	default:
+		return direction, false
 	}
 }
 
 // GetOffset returns the offset for the current page.
-// This is calculated as (page - 1) * pageSize.
+// This is calculated as (page - 1) * pageSize unless an explicit offset was set with WithOffset.
+// Out-of-range pages, page sizes and offsets are clamped even when ValidateAndSetDefaults was not called.
 //
 // Example:
 //
@@ -210,11 +647,122 @@ func (m *Metadata) ValidateAndSetDefaults() {
 //	offset := metadata.GetOffset()
 //	// offset == 10
 func (m *Metadata) GetOffset() int {
-	return (m.Page - 1) * m.PageSize
+	offset := m.GetOffset64()
+	if offset > math.MaxInt {
+		return math.MaxInt
+	}
+	return int(offset)
+}
+
+// GetOffset64 returns the offset for the current page like GetOffset, computed with int64
+// arithmetic so that huge page numbers cannot overflow into a negative offset on 32-bit platforms.
+// The offset is capped at MaxOffset; Validate reports offsets beyond it.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(math.MaxInt32).WithPageSize(100)
+//	offset := metadata.GetOffset64()
+//	// offset == math.MaxInt32
+func (m *Metadata) GetOffset64() int64 {
+	offset := m.rawOffset()
+	if offset > m.maxOffset() {
+		return m.maxOffset()
+	}
+	return offset
+}
+
+// rawOffset computes the offset of the current page without capping it at MaxOffset
+func (m *Metadata) rawOffset() int64 {
+	if m.fromEnd() {
+		offset := m.TotalRows - int64(m.GetLimit())
+		if offset < 0 {
+			return 0
+		}
+		return offset
+	}
+
+	if m.Offset != nil {
+		if *m.Offset < 0 {
+			return 0
+		}
+		return int64(*m.Offset)
+	}
+
+	page := int64(m.Page)
+	if page < 1 {
+		page = 1
+	}
+	limit := int64(m.GetLimit())
+	if page-1 > math.MaxInt64/limit {
+		return math.MaxInt64
+	}
+	return (page - 1) * limit
+}
+
+// defaultMaxOffset is the offset cap used when MaxOffset is not set
+const defaultMaxOffset = math.MaxInt32
+
+// maxOffset returns MaxOffset, or the default cap when it is not set
+func (m *Metadata) maxOffset() int64 {
+	if m.MaxOffset > 0 {
+		return m.MaxOffset
+	}
+	return defaultMaxOffset
+}
+
+// WithMaxOffset caps the row offset of a page at max and returns the metadata for method chaining.
+// Pages or offsets past the cap fail validation with OFFSET_TOO_LARGE instead of reaching the
+// database; 0 restores the default cap of math.MaxInt32.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(1001).WithPageSize(100).WithMaxOffset(100000)
+//	err := Paginate(db.Model(&User{}), metadata, &users)
+//	// err reports OFFSET_TOO_LARGE
+func (m *Metadata) WithMaxOffset(max int64) *Metadata {
+	m.MaxOffset = max
+	return m
+}
+
+// PageFromOffset returns the 1-based page containing the row at offset for the page size.
+// Offsets that are not a multiple of the page size round down to the page containing them,
+// negative offsets map to page 1 and page sizes below 1 use the default page size.
+//
+// Example:
+//
+//	page := PageFromOffset(25, 10)
+//	// page == 3
+func PageFromOffset(offset, pageSize int) int {
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return offset/pageSize + 1
+}
+
+// OffsetFromPage returns the offset of the first row of the 1-based page for the page size,
+// the inverse of PageFromOffset. Pages below 1 map to offset 0 and page sizes below 1 use
+// the default page size.
+//
+// Example:
+//
+//	offset := OffsetFromPage(3, 10)
+//	// offset == 20
+func OffsetFromPage(page, pageSize int) int {
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+	return (page - 1) * pageSize
 }
 
 // GetLimit returns the limit for the current page.
-// This is the same as the page size.
+// This is the page size, clamped like ValidateAndSetDefaults does when it was not applied,
+// and capped at MaxRows when set.
 //
 // Example:
 //
@@ -222,11 +770,118 @@ func (m *Metadata) GetOffset() int {
 //	limit := metadata.GetLimit()
 //	// limit == 20
 func (m *Metadata) GetLimit() int {
+	limit := clampPageSize(m.pageSize())
+	if m.MaxRows > 0 && limit > m.MaxRows {
+		return m.MaxRows
+	}
+	return limit
+}
+
+// WithAllowNegativePageSize lets a negative page size select the last |PageSize| rows and
+// returns the metadata for method chaining. The offset is computed from TotalRows, so the
+// total must be counted (any count mode except CountNone and CountWindow) or known.
+// Once the rows are counted, the page becomes a positive PageSize, an Offset and the last Page.
+// Building the page before, e.g. with Scope or BuildSQL, returns a PAGE_SIZE_REQUIRES_TOTAL
+// validation error instead of the first rows.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPageSize(-10).WithAllowNegativePageSize(true)
+//	err := Paginate(db.Model(&User{}), metadata, &users)
+//	// with 95 users: users holds rows 86-95, metadata.GetOffset() == 85
+func (m *Metadata) WithAllowNegativePageSize(allow bool) *Metadata {
+	m.AllowNegativePageSize = allow
+	return m
+}
+
+// fromEnd reports whether the page size selects the last rows of the total
+func (m *Metadata) fromEnd() bool {
+	return m.AllowNegativePageSize && m.PageSize < 0
+}
+
+// resolveFromEnd turns a page counted from the end into a positive PageSize and an Offset computed
+// from the counted TotalRows. The page is reported as the last one, which its rows end, even when
+// the offset doesn't start a page.
+func (m *Metadata) resolveFromEnd() {
+	if !m.fromEnd() {
+		return
+	}
+	offset, size := m.GetOffset(), -m.PageSize
+	m.WithOffset(offset)
+	m.PageSize = size
+	limit := int64(m.GetLimit())
+	m.Page = int((m.TotalRows + limit - 1) / limit)
+	if m.Page < 1 {
+		m.Page = 1
+	}
+}
+
+// awaitsTotal reports whether the page counts from the end of a total that isn't counted yet
+func (m *Metadata) awaitsTotal() bool {
+	return m.fromEnd() && m.TotalRows <= 0
+}
+
+// pageSizeRequiresTotalError returns the validation error reported for pages counted from the
+// end without a total
+func pageSizeRequiresTotalError() ValidationError {
+	return ValidationError{
+		Field:   "page_size",
+		Message: "Negative page sizes require the total number of rows",
+		Code:    "PAGE_SIZE_REQUIRES_TOTAL",
+	}
+}
+
+// pageSize returns the page size, made positive when it counts from the end
+func (m *Metadata) pageSize() int {
+	if m.fromEnd() {
+		return -m.PageSize
+	}
 	return m.PageSize
 }
 
+// totalAvailable reports whether TotalRows is known or counted before the page is fetched
+func (m *Metadata) totalAvailable() bool {
+	return m.KnownTotal != nil || m.TotalRows > 0 || (m.CountMode != CountNone && m.CountMode != CountWindow)
+}
+
+// defaultPageSize is the page size used when none is set
+const defaultPageSize = 10
+
+// clampPageSize applies the default page size to sizes below 1 and caps sizes above the maximum
+func clampPageSize(size int) int {
+	if size < 1 {
+		return defaultPageSize
+	}
+	if size > 100 {
+		return 100
+	}
+	return size
+}
+
+// ItemsOnPage returns the number of items on the current page, computed from FromRow and ToRow.
+// It is smaller than PageSize on a partial last page and 0 for empty pages, pages past the end
+// and cursor pages, which have no row range.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(3).WithPageSize(10)
+//	metadata.TotalRows = 25
+//	metadata.ValidateAndSetDefaults()
+//	// metadata.ItemsOnPage() == 5
+func (m *Metadata) ItemsOnPage() int64 {
+	if m.ToRow < m.FromRow || m.ToRow == 0 {
+		return 0
+	}
+	if m.TotalRows > 0 && int64(m.GetOffset()) >= m.TotalRows {
+		return 0
+	}
+	return m.ToRow - m.FromRow + 1
+}
+
 // GetSortClause returns the sort clause for the current sort settings.
 // Returns an empty string if no sort field is specified.
+// Collations and JSON sort fields are emitted in MySQL/SQLite syntax; use GetSortClauseFor
+// for other dialects.
 //
 // Example:
 //
@@ -234,50 +889,278 @@ func (m *Metadata) GetLimit() int {
 //	sortClause := metadata.GetSortClause()
 //	// sortClause == "created_at desc"
 func (m *Metadata) GetSortClause() string {
-	if m.Sort == "" {
-		return ""
-	}
-	return m.Sort + " " + m.SortDirection
+	return m.GetSortClauseFor(MySQL)
 }
 
-// Validate performs validation on the metadata and returns a ValidationResult.
-// This method checks:
-//   - Page is greater than 0
-//   - PageSize is between 1 and 100
-//   - SortDirection is either "asc" or "desc"
-//   - CursorField is provided when using cursor-based pagination
-//   - CursorOrder is either "asc" or "desc" when provided
-//   - Custom validation rules when specified
+// GetSortClauseFor returns the sort clause using the syntax of the given dialect,
+// such as quoting collation names and extracting JSON fields on PostgreSQL.
 //
 // Example:
 //
-//	metadata := NewMetadata()
-//	metadata.Page = 0
-//	result := metadata.Validate()
-//	// result.IsValid == false
-//	// result.Errors[0].Field == "page"
-//	// result.Errors[0].Message == "Page must be greater than 0"
-func (m *Metadata) Validate() ValidationResult {
-	var result ValidationResult
-	var errors []ValidationError
+//	metadata := NewMetadata().WithSort("name").WithSortCollation("name", "de-DE-x-icu")
+//	sortClause := metadata.GetSortClauseFor(PostgreSQL)
+//	// sortClause == `name COLLATE "de-DE-x-icu" asc`
+func (m *Metadata) GetSortClauseFor(dialect Dialect) string {
+	columns, direction := m.sortColumns(dialect)
+	if columns == "" {
+		return ""
+	}
+	return columns + " " + direction
+}
 
-	// Check page number
-	if m.Page < 1 {
-		errors = append(errors, ValidationError{
-			Field:   "page",
-			Message: "Page must be greater than 0",
-			Code:    "PAGE_NEGATIVE",
-		})
+// sortColumns returns the ORDER BY column list with the directions of all but the last column,
+// followed by the direction of the last column. The list is empty when no sort field is set.
+// The stable order column is appended when it is not sorted by already.
+// Full-text matches on offset pages (see WithFTS) are ordered by rank instead of the sort fields.
+func (m *Metadata) sortColumns(dialect Dialect) (string, string) {
+	if m.ranksMatches() {
+		return "rank", "asc"
+	}
+	columns, direction := m.sortFieldColumns(dialect)
+	if columns == "" || !m.StableOrder || m.StableOrderColumn == "" || m.IsCursorBased() || m.sortsBy(m.StableOrderColumn) {
+		return columns, direction
+	}
+	return fmt.Sprintf("%s %s, %s", columns, direction, m.StableOrderColumn), direction
+}
+
+// sortsBy reports whether the column is one of the sort fields
+func (m *Metadata) sortsBy(column string) bool {
+	if m.Sort == column {
+		return true
+	}
+	for _, field := range m.SortFields {
+		if field.Field == column {
+			return true
+		}
+	}
+	return false
+}
+
+// sortFieldColumns returns the ORDER BY column list of the sort fields like sortColumns
+func (m *Metadata) sortFieldColumns(dialect Dialect) (string, string) {
+	if m.Sort == "" {
+		return "", m.SortDirection
+	}
+	if len(m.SortFields) == 0 || m.SortFields[0].Field != m.Sort {
+		return m.sortExpression(m.Sort, dialect), m.SortDirection
+	}
+
+	columns := make([]string, len(m.SortFields))
+	for i, field := range m.SortFields {
+		columns[i] = m.sortExpression(field.Field, dialect)
+		if i < len(m.SortFields)-1 {
+			columns[i] += " " + sortFieldDirection(field.Direction)
+		}
+	}
+	return strings.Join(columns, ", "), sortFieldDirection(m.SortFields[len(m.SortFields)-1].Direction)
+}
+
+// sortFieldDirection normalizes the direction of a sort field, defaulting to "asc"
+func sortFieldDirection(direction SortDirection) string {
+	if normalized, ok := normalizeDirection(string(direction)); ok && normalized != "" {
+		return normalized
+	}
+	return "asc"
+}
+
+// sortExpression returns the sort column, or its JSON extraction, including its collation, if any
+func (m *Metadata) sortExpression(field string, dialect Dialect) string {
+	column := field
+	if jsonField, ok := m.JSONSortFields[field]; ok && jsonField.valid() {
+		column = jsonField.expression(dialect)
+	}
+	if value, ok := m.SortCoalesce[field]; ok && validCoalesceValue(value) {
+		column = fmt.Sprintf("COALESCE(%s,'%s')", column, strings.ReplaceAll(value, "'", "''"))
+	}
+
+	collation, ok := m.SortCollations[field]
+	if !ok || !collationPattern.MatchString(collation) {
+		return column
+	}
+
+	// PostgreSQL collation names are identifiers and must be quoted to keep their case and dashes
+	if dialect.postgresCompatible() {
+		return fmt.Sprintf("%s COLLATE \"%s\"", column, collation)
+	}
+	return fmt.Sprintf("%s COLLATE %s", column, collation)
+}
+
+// SortField is one column of a multi-column sort
+type SortField struct {
+	Field     string        `json:"field"`
+	Direction SortDirection `json:"direction"`
+}
+
+// JSONSortField maps a sortable API field to a value extracted from a JSON column
+type JSONSortField struct {
+	Column string // JSON column holding the document
+	Path   string // Dot-separated path to the value inside the document
+}
+
+// valid reports whether the column and path are safe to embed in SQL
+func (f JSONSortField) valid() bool {
+	return identifierPattern.MatchString(f.Column) && jsonPathPattern.MatchString(f.Path)
+}
+
+// expression returns the dialect-specific SQL extracting the value as text
+func (f JSONSortField) expression(dialect Dialect) string {
+	if dialect.postgresCompatible() {
+		if !strings.Contains(f.Path, ".") {
+			return fmt.Sprintf("%s->>'%s'", f.Column, f.Path)
+		}
+		return fmt.Sprintf("%s#>>'{%s}'", f.Column, strings.ReplaceAll(f.Path, ".", ","))
+	}
+	if dialect == SQLServer {
+		return fmt.Sprintf("JSON_VALUE(%s, '$.%s')", f.Column, f.Path)
+	}
+	return fmt.Sprintf("JSON_EXTRACT(%s, '$.%s')", f.Column, f.Path)
+}
+
+// WithJSONSortField declares a sortable field backed by a value inside a JSON column and returns the metadata for method chaining.
+// Sorting by name then orders by the extracted value, using "->>" on PostgreSQL, JSON_VALUE on SQL Server
+// and JSON_EXTRACT elsewhere.
+// Column must be a plain identifier and path a dot-separated list of keys.
+//
+// Example:
+//
+//	metadata := NewMetadata().
+//	  WithSort("priority").
+//	  WithJSONSortField("priority", "data", "priority")
+//	// metadata.GetSortClauseFor(PostgreSQL) == "data->>'priority' asc"
+//	// metadata.GetSortClauseFor(MySQL) == "JSON_EXTRACT(data, '$.priority') asc"
+func (m *Metadata) WithJSONSortField(name, column, path string) *Metadata {
+	if m.JSONSortFields == nil {
+		m.JSONSortFields = make(map[string]JSONSortField)
+	}
+	m.JSONSortFields[name] = JSONSortField{Column: column, Path: path}
+	return m
+}
+
+// WithSortCollation sets the collation used when sorting by field and returns the metadata for method chaining.
+// Collation names may only contain letters, digits, '_', '-', '.' and '@'.
+//
+// Example:
+//
+//	metadata := NewMetadata().
+//	  WithSort("name").
+//	  WithSortCollation("name", "utf8mb4_unicode_ci")
+//	// metadata.GetSortClauseFor(MySQL) == "name COLLATE utf8mb4_unicode_ci asc"
+func (m *Metadata) WithSortCollation(field, collation string) *Metadata {
+	if m.SortCollations == nil {
+		m.SortCollations = make(map[string]string)
+	}
+	m.SortCollations[field] = collation
+	return m
+}
+
+// WithSortCoalesce orders NULLs of field as value, emitted as COALESCE(field,'value'), and returns
+// the metadata for method chaining. It keeps NULLs and empty strings together in the order.
+// Quotes in value are escaped; backslashes and NUL characters are rejected by Validate.
+//
+// Example:
+//
+//	metadata := NewMetadata().
+//	  WithSort("name").
+//	  WithSortCoalesce("name", "")
+//	// metadata.GetSortClause() == "COALESCE(name,'') asc"
+func (m *Metadata) WithSortCoalesce(field, value string) *Metadata {
+	if m.SortCoalesce == nil {
+		m.SortCoalesce = make(map[string]string)
+	}
+	m.SortCoalesce[field] = value
+	return m
+}
+
+// validCoalesceValue reports whether the value can be embedded as a string literal in every dialect;
+// MySQL treats backslashes as escapes, so they could end the literal early
+func validCoalesceValue(value string) bool {
+	return !strings.ContainsAny(value, "\\\x00")
+}
+
+// Validate performs validation on the metadata and returns a ValidationResult.
+// This method checks:
+//   - Page is greater than 0
+//   - Offset is not negative when provided
+//   - The offset of the page does not exceed MaxOffset
+//   - PageSize is between 1 and 100
+//   - SortDirection is "asc", "desc" or one of their aliases (normalized in place)
+//   - Sort or CursorField is set when RequireSort is enabled
+//   - Sort collations contain only safe characters
+//   - JSON sort fields use plain column names and paths
+//   - Filters use valid columns, operators and value counts
+//   - Search fields are valid column names
+//   - Sort, selected, cursor, filter and search fields are in AllowedFields when set
+//   - Snapshot is a valid PostgreSQL snapshot identifier when provided
+//   - DriftColumn is a valid column name when provided
+//   - StableOrderColumn is a valid column name when provided
+//   - CursorField is provided when using cursor-based pagination
+//   - CursorOrder is "asc", "desc" or one of their aliases when provided (normalized in place)
+//   - After and Before cursors decode to the same type
+//   - Page and Offset are not combined with cursor-based pagination
+//   - Custom validation rules when specified
+//
+// Example:
+//
+//	metadata := NewMetadata()
+//	metadata.Page = 0
+//	result := metadata.Validate()
+//	// result.IsValid == false
+//	// result.Errors[0].Field == "page"
+//	// result.Errors[0].Message == "Page must be greater than 0"
+func (m *Metadata) Validate() ValidationResult {
+	var result ValidationResult
+	var errors []ValidationError
+
+	errors = append(errors, m.restoreCursorState()...)
+	m.inferCursorSettings()
+
+	// Check page number
+	if m.Page < 1 {
+		errors = append(errors, ValidationError{
+			Field:   "page",
+			Message: "Page must be greater than 0",
+			Code:    "PAGE_NEGATIVE",
+		})
+	}
+
+	// Check explicit offset
+	if m.Offset != nil && *m.Offset < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "offset",
+			Message: "Offset must be greater than or equal to 0",
+			Code:    "OFFSET_NEGATIVE",
+		})
+	}
+
+	// Check that the offset stays within MaxOffset
+	if !m.IsCursorBased() && m.rawOffset() > m.maxOffset() {
+		field := "page"
+		if m.Offset != nil {
+			field = "offset"
+		}
+		errors = append(errors, ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("Offset must be less than or equal to %d", m.maxOffset()),
+			Code:    "OFFSET_TOO_LARGE",
+		})
 	}
 
 	// Check page size
-	if m.PageSize < 1 {
+	if m.fromEnd() && m.IsCursorBased() {
+		errors = append(errors, ValidationError{
+			Field:   "page_size",
+			Message: "Negative page sizes cannot be combined with cursor-based pagination",
+			Code:    "MIXED_PAGINATION_MODE",
+		})
+	} else if m.fromEnd() && !m.totalAvailable() {
+		errors = append(errors, pageSizeRequiresTotalError())
+	} else if m.pageSize() < 1 {
 		errors = append(errors, ValidationError{
 			Field:   "page_size",
 			Message: "Page size must be greater than 0",
 			Code:    "PAGE_SIZE_NEGATIVE",
 		})
-	} else if m.PageSize > 100 {
+	} else if m.pageSize() > 100 {
 		errors = append(errors, ValidationError{
 			Field:   "page_size",
 			Message: "Page size must be less than or equal to 100",
@@ -285,8 +1168,24 @@ func (m *Metadata) Validate() ValidationResult {
 		})
 	}
 
+	// Check the direction of each sort field
+	for i, field := range m.SortFields {
+		if direction, ok := normalizeDirection(string(field.Direction)); ok {
+			m.SortFields[i].Direction = SortDirection(direction)
+		} else {
+			errors = append(errors, ValidationError{
+				Field:   "sort_fields",
+				Message: fmt.Sprintf("Sort direction of field '%s' must be either 'asc' or 'desc'", field.Field),
+				Code:    "INVALID_SORT_DIRECTION",
+			})
+		}
+	}
+	m.syncSortFields()
+
 	// Check sort direction if specified
-	if m.SortDirection != "" && m.SortDirection != "asc" && m.SortDirection != "desc" {
+	if direction, ok := normalizeDirection(m.SortDirection); ok {
+		m.SortDirection = direction
+	} else {
 		errors = append(errors, ValidationError{
 			Field:   "sort_direction",
 			Message: "Sort direction must be either 'asc' or 'desc'",
@@ -294,8 +1193,91 @@ func (m *Metadata) Validate() ValidationResult {
 		})
 	}
 
+	// Check that an ORDER BY can be built when one is required
+	if m.RequireSort && m.Sort == "" && m.CursorField == "" {
+		errors = append(errors, sortRequiredError())
+	}
+
+	// Check collation names to prevent SQL injection
+	for field, collation := range m.SortCollations {
+		if !collationPattern.MatchString(collation) {
+			errors = append(errors, ValidationError{
+				Field:   "sort",
+				Message: fmt.Sprintf("Collation '%s' for field '%s' contains invalid characters", collation, field),
+				Code:    "INVALID_COLLATION",
+			})
+		}
+	}
+
+	// Check coalesce values to prevent SQL injection
+	for field, value := range m.SortCoalesce {
+		if !validCoalesceValue(value) {
+			errors = append(errors, ValidationError{
+				Field:   "sort",
+				Message: fmt.Sprintf("Coalesce value for field '%s' must not contain backslashes or NUL characters", field),
+				Code:    "INVALID_SORT_COALESCE",
+			})
+		}
+	}
+
+	// Check JSON sort fields to prevent SQL injection
+	for name, jsonField := range m.JSONSortFields {
+		if !jsonField.valid() {
+			errors = append(errors, ValidationError{
+				Field:   "sort",
+				Message: fmt.Sprintf("JSON sort field '%s' has an invalid column or path", name),
+				Code:    "INVALID_JSON_SORT_FIELD",
+			})
+		}
+	}
+
+	// Check filters
+	for _, filter := range m.Filters {
+		if filterErr := filter.validate(); filterErr != nil {
+			errors = append(errors, *filterErr)
+		}
+	}
+
+	// Check search fields
+	for _, field := range m.SearchFields {
+		if !qualifiedIdentifierPattern.MatchString(field) {
+			errors = append(errors, ValidationError{
+				Field:   "search",
+				Message: fmt.Sprintf("Search field '%s' is not a valid column name", field),
+				Code:    "INVALID_SEARCH_FIELD",
+			})
+			break
+		}
+	}
+
+	// Check the stable order column, which is interpolated into the ORDER BY
+	if m.StableOrderColumn != "" && !qualifiedIdentifierPattern.MatchString(m.StableOrderColumn) {
+		errors = append(errors, ValidationError{
+			Field:   "stable_order",
+			Message: fmt.Sprintf("Stable order column '%s' is not a valid column name", m.StableOrderColumn),
+			Code:    "INVALID_STABLE_ORDER",
+		})
+	}
+
+	// Check snapshot identifier
+	if m.Snapshot != "" && !snapshotPattern.MatchString(m.Snapshot) {
+		errors = append(errors, invalidSnapshotError(m.Snapshot))
+	}
+
+	// Check drift column
+	if m.DriftColumn != "" && !qualifiedIdentifierPattern.MatchString(m.DriftColumn) {
+		errors = append(errors, ValidationError{
+			Field:   "drift_column",
+			Message: fmt.Sprintf("Drift column '%s' is not a valid column name", m.DriftColumn),
+			Code:    "INVALID_DRIFT_COLUMN",
+		})
+	}
+
+	// Check fields against the allow-list
+	errors = append(errors, m.allowedFieldErrors()...)
+
 	// Check cursor field when cursor is specified
-	if m.Cursor != "" && m.CursorField == "" {
+	if (m.Cursor != "" || m.After != "" || m.Before != "") && m.CursorField == "" {
 		errors = append(errors, ValidationError{
 			Field:   "cursor_field",
 			Message: "Cursor field is required when using cursor-based pagination",
@@ -303,8 +1285,39 @@ func (m *Metadata) Validate() ValidationResult {
 		})
 	}
 
+	// Check the count expression, which is interpolated into the count query
+	if m.CountExpression != "" && !countExpressionPattern.MatchString(m.CountExpression) {
+		errors = append(errors, ValidationError{
+			Field:   "count_expression",
+			Message: fmt.Sprintf("Count expression '%s' must be COUNT(*), COUNT(1) or COUNT of a column", m.CountExpression),
+			Code:    "INVALID_COUNT_EXPRESSION",
+		})
+	}
+
+	// Check the tie-break column, which is interpolated into the query
+	if m.CursorTieBreak != "" && !qualifiedIdentifierPattern.MatchString(m.CursorTieBreak) {
+		errors = append(errors, ValidationError{
+			Field:   "cursor_tie_break",
+			Message: fmt.Sprintf("Invalid cursor tie-break field '%s'", m.CursorTieBreak),
+			Code:    "INVALID_CURSOR_TIE_BREAK",
+		})
+	}
+
+	// Check the tie-break order, which may differ from the cursor order
+	if order, ok := normalizeDirection(m.CursorTieBreakOrder); ok {
+		m.CursorTieBreakOrder = order
+	} else {
+		errors = append(errors, ValidationError{
+			Field:   "cursor_tie_break_order",
+			Message: "Cursor tie-break order must be either 'asc' or 'desc'",
+			Code:    "INVALID_CURSOR_ORDER",
+		})
+	}
+
 	// Check cursor order when cursor field is specified
-	if m.CursorField != "" && m.CursorOrder != "" && m.CursorOrder != "asc" && m.CursorOrder != "desc" {
+	if order, ok := normalizeDirection(m.CursorOrder); ok {
+		m.CursorOrder = order
+	} else if m.CursorField != "" {
 		errors = append(errors, ValidationError{
 			Field:   "cursor_order",
 			Message: "Cursor order must be either 'asc' or 'desc'",
@@ -312,15 +1325,56 @@ func (m *Metadata) Validate() ValidationResult {
 		})
 	}
 
+	// Check that after and before cursors hold values of the same type
+	if m.After != "" && m.Before != "" {
+		after, _, afterErr := m.decodeCursorValue(m.After)
+		before, _, beforeErr := m.decodeCursorValue(m.Before)
+		if afterErr != nil || beforeErr != nil {
+			errors = append(errors, ValidationError{
+				Field:   "cursor",
+				Message: "After and before must be valid cursors",
+				Code:    "INVALID_CURSOR",
+			})
+		} else if cursorKind(after) != cursorKind(before) {
+			errors = append(errors, ValidationError{
+				Field:   "before",
+				Message: "After and before cursors must refer to values of the same type",
+				Code:    "CURSOR_TYPE_MISMATCH",
+			})
+		}
+	}
+
+	// Reject page numbers and offsets combined with cursor-based pagination, since they would be ignored
+	if m.IsCursorBased() && m.Page > 1 {
+		errors = append(errors, ValidationError{
+			Field:   "page",
+			Message: "Page cannot be combined with cursor-based pagination",
+			Code:    "MIXED_PAGINATION_MODE",
+		})
+	} else if m.IsCursorBased() && m.Offset != nil {
+		errors = append(errors, ValidationError{
+			Field:   "offset",
+			Message: "Offset cannot be combined with cursor-based pagination",
+			Code:    "MIXED_PAGINATION_MODE",
+		})
+	}
+
 	// Apply custom validation rules
 	if m.ValidationRules != nil {
 		for field, rule := range m.ValidationRules {
+			if strings.HasPrefix(rule, "regex:") {
+				if err := regexRuleError(field, strings.TrimPrefix(rule, "regex:"), m.ruleValues(field)); err != nil {
+					errors = append(errors, *err)
+				}
+				continue
+			}
+
 			switch field {
 			case "page_size":
 				if strings.HasPrefix(rule, "max:") {
 					maxStr := strings.TrimPrefix(rule, "max:")
 					max, err := strconv.Atoi(maxStr)
-					if err == nil && m.PageSize > max {
+					if err == nil && m.pageSize() > max {
 						errors = append(errors, ValidationError{
 							Field:   "page_size",
 							Message: fmt.Sprintf("Page size must be less than or equal to %d", max),
@@ -330,7 +1384,7 @@ func (m *Metadata) Validate() ValidationResult {
 				} else if strings.HasPrefix(rule, "min:") {
 					minStr := strings.TrimPrefix(rule, "min:")
 					min, err := strconv.Atoi(minStr)
-					if err == nil && m.PageSize < min {
+					if err == nil && m.pageSize() < min {
 						errors = append(errors, ValidationError{
 							Field:   "page_size",
 							Message: fmt.Sprintf("Page size must be greater than or equal to %d", min),
@@ -340,11 +1394,18 @@ func (m *Metadata) Validate() ValidationResult {
 				}
 			case "sort":
 				if strings.HasPrefix(rule, "in:") {
-					allowedValues := strings.Split(strings.TrimPrefix(rule, "in:"), ",")
-					if m.Sort != "" {
+					allowedValues := parseInRule(strings.TrimPrefix(rule, "in:"))
+					sortFields := []string{m.Sort}
+					for _, field := range m.SortFields {
+						sortFields = append(sortFields, field.Field)
+					}
+					for _, sort := range sortFields {
+						if sort == "" {
+							continue
+						}
 						valid := false
 						for _, v := range allowedValues {
-							if m.Sort == v {
+							if sort == v {
 								valid = true
 								break
 							}
@@ -355,12 +1416,13 @@ func (m *Metadata) Validate() ValidationResult {
 								Message: fmt.Sprintf("Sort field must be one of: %s", strings.Join(allowedValues, ", ")),
 								Code:    "INVALID_SORT_FIELD",
 							})
+							break
 						}
 					}
 				}
 			case "fields":
 				if strings.HasPrefix(rule, "in:") {
-					allowedValues := strings.Split(strings.TrimPrefix(rule, "in:"), ",")
+					allowedValues := parseInRule(strings.TrimPrefix(rule, "in:"))
 					for _, field := range m.SelectedFields {
 						if field == "*" {
 							continue
@@ -383,6 +1445,27 @@ func (m *Metadata) Validate() ValidationResult {
 						}
 					}
 				}
+			case "search":
+				if strings.HasPrefix(rule, "in:") {
+					allowedValues := parseInRule(strings.TrimPrefix(rule, "in:"))
+					for _, field := range m.SearchFields {
+						valid := false
+						for _, v := range allowedValues {
+							if field == v {
+								valid = true
+								break
+							}
+						}
+						if !valid {
+							errors = append(errors, ValidationError{
+								Field:   "search",
+								Message: fmt.Sprintf("Search field '%s' is not allowed. Allowed fields: %s", field, strings.Join(allowedValues, ", ")),
+								Code:    "INVALID_SEARCH_FIELD",
+							})
+							break
+						}
+					}
+				}
 			}
 		}
 	}
@@ -398,6 +1481,127 @@ func (m *Metadata) Validate() ValidationResult {
 	return result
 }
 
+// ValidateFirst validates the metadata like Validate and returns the first error it reports,
+// or nil when the metadata is valid. It suits fast-fail checks that only need a yes/no and a reason.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(0).WithPageSize(500)
+//	if err := metadata.ValidateFirst(); err != nil {
+//		// err.Field == "page", err.Code == "PAGE_NEGATIVE"
+//	}
+func (m *Metadata) ValidateFirst() *ValidationError {
+	result := m.Validate()
+	if result.IsValid || len(result.Errors) == 0 {
+		return nil
+	}
+	return &result.Errors[0]
+}
+
+// ruleValues returns the values a "regex:" rule for the field validates: the sort, selected,
+// search or filter fields, or the cursor field
+func (m *Metadata) ruleValues(field string) []string {
+	var values []string
+	switch field {
+	case "sort":
+		values = append(values, m.Sort)
+		for _, sortField := range m.SortFields {
+			values = append(values, sortField.Field)
+		}
+	case "fields":
+		for _, selected := range m.SelectedFields {
+			if selected != "*" {
+				values = append(values, selected)
+			}
+		}
+	case "search":
+		values = append(values, m.SearchFields...)
+	case "filter":
+		for _, filter := range m.Filters {
+			values = append(values, filter.Field)
+		}
+	case "cursor_field":
+		values = append(values, m.CursorField)
+	}
+	return values
+}
+
+// regexRuleError checks the non-empty values against the pattern of a "regex:" rule and
+// reports the first mismatch, or an invalid pattern. Compiled patterns are cached.
+func regexRuleError(field, pattern string, values []string) *ValidationError {
+	var re *regexp.Regexp
+	if cached, ok := regexRules.Load(pattern); ok {
+		re = cached.(*regexp.Regexp)
+	} else {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return &ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("Invalid regex rule %q: %v", pattern, err),
+				Code:    "INVALID_VALIDATION_RULE",
+			}
+		}
+		regexRules.Store(pattern, compiled)
+		re = compiled
+	}
+
+	for _, value := range values {
+		if value != "" && !re.MatchString(value) {
+			return &ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("Value '%s' does not match the pattern %s", value, pattern),
+				Code:    "REGEX_MISMATCH",
+			}
+		}
+	}
+	return nil
+}
+
+// parseInRule splits the values of an "in:" rule on commas, trimming spaces and skipping
+// empty values. Values in double quotes may contain commas and spaces; "" inside quotes is a quote.
+func parseInRule(values string) []string {
+	var (
+		parsed  []string
+		current strings.Builder
+		quoted  bool // the current value was quoted
+		inQuote bool
+	)
+	flush := func() {
+		value := current.String()
+		if !quoted {
+			value = strings.TrimSpace(value)
+		}
+		if value != "" {
+			parsed = append(parsed, value)
+		}
+		current.Reset()
+		quoted = false
+	}
+
+	for i := 0; i < len(values); i++ {
+		c := values[i]
+		switch {
+		case inQuote && c == '"' && i+1 < len(values) && values[i+1] == '"':
+			current.WriteByte('"')
+			i++
+		case c == '"' && (inQuote || strings.TrimSpace(current.String()) == ""):
+			if !inQuote {
+				current.Reset()
+			}
+			inQuote = !inQuote
+			quoted = true
+		case c == ',' && !inQuote:
+			flush()
+		case quoted && !inQuote:
+			// Ignore anything between a closing quote and the next comma
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return parsed
+}
+
 // WithCursor sets the cursor for cursor-based pagination and returns the metadata for method chaining.
 // The cursor should be a base64-encoded string containing the last item's data.
 //
@@ -411,7 +1615,9 @@ func (m *Metadata) WithCursor(cursor string) *Metadata {
 }
 
 // WithCursorField sets the field to use for cursor-based pagination and returns the metadata for method chaining.
-// This field should match a column name in your database.
+// This field should match a column name in your database. Qualify it with its table, e.g.
+// orders.created_at, when a join makes the column ambiguous; the value is then read from the
+// qualified name, the alias orders_created_at or the created_at column of the scanned rows.
 //
 // Example:
 //
@@ -434,8 +1640,58 @@ func (m *Metadata) WithCursorOrder(order string) *Metadata {
 	return m
 }
 
+// WithCursorFieldType declares the kind of the cursor field and returns the metadata for method chaining.
+// Decoded cursor values are converted to this kind, and cursors holding incompatible
+// values (e.g. a string cursor used against an integer column) fail with ErrCursorTypeMismatch.
+//
+// Example:
+//
+//	metadata := NewMetadata().
+//	  WithCursorField("id").
+//	  WithCursorFieldType(reflect.Int64)
+func (m *Metadata) WithCursorFieldType(kind reflect.Kind) *Metadata {
+	m.CursorFieldType = kind
+	return m
+}
+
+// WithAfter sets the cursor after which rows are returned and returns the metadata for method chaining.
+// Combined with WithBefore it fetches a bounded window of rows.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("id").WithAfter(after).WithBefore(before)
+//	// WHERE id > after AND id < before
+func (m *Metadata) WithAfter(cursor string) *Metadata {
+	m.After = cursor
+	return m
+}
+
+// WithBefore sets the cursor before which rows are returned and returns the metadata for method chaining.
+// Used alone it fetches the previous page: the rows closest to the cursor are queried with every key's
+// direction flipped and returned in the order of the forward pages. Combined with WithAfter it bounds a window.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("id").WithPageSize(10).WithBefore(page.PrevCursor)
+//	// WHERE id < before ORDER BY id desc LIMIT 10, returned in ascending order
+func (m *Metadata) WithBefore(cursor string) *Metadata {
+	m.Before = cursor
+	return m
+}
+
+// cursorKind groups decoded cursor values by type so that cursors can be compared for compatibility
+func cursorKind(value interface{}) string {
+	switch value.(type) {
+	case int64, float64:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
 // IsCursorBased returns true if cursor-based pagination is being used.
-// This is determined by checking if either Cursor or CursorField is set.
+// This is determined by checking if any of Cursor, After, Before or CursorField is set,
+// or if CursorOrder is set together with Sort (see inferCursorSettings).
 //
 // Example:
 //
@@ -445,18 +1701,71 @@ func (m *Metadata) WithCursorOrder(order string) *Metadata {
 //	metadata.WithCursorField("created_at")
 //	// metadata.IsCursorBased() == true
 func (m *Metadata) IsCursorBased() bool {
-	return m.Cursor != "" || m.CursorField != ""
+	return m.Cursor != "" || m.After != "" || m.Before != "" || m.CursorField != "" ||
+		(m.CursorOrder != "" && m.Sort != "")
+}
+
+// inferCursorSettings fills an empty CursorField from Sort and an empty CursorOrder from
+// SortDirection when cursor mode is indicated by Cursor, After, Before or CursorOrder.
+// Explicit cursor settings always take precedence over the sort settings.
+func (m *Metadata) inferCursorSettings() {
+	if m.CursorField == "" && m.Sort != "" && m.IsCursorBased() {
+		m.CursorField = m.Sort
+	}
+	if m.CursorOrder == "" && m.CursorField != "" && m.CursorField == m.Sort {
+		m.CursorOrder = m.SortDirection
+	}
 }
 
 // WithFields sets the selected fields to include in the result and returns the metadata for method chaining.
 // Only these fields will be included in the query result.
+// Fields are trimmed, and empty or duplicate entries are dropped while preserving order.
+// A "*" among the fields selects every column, so the other fields are dropped.
 //
 // Example:
 //
-//	metadata := NewMetadata().WithFields("id", "name", "email")
+//	metadata := NewMetadata().WithFields("id", "name", " email", "", "name")
 //	// metadata.SelectedFields == []string{"id", "name", "email"}
+//
+//	metadata = NewMetadata().WithFields("*", "name")
+//	// metadata.SelectedFields == []string{"*"}
 func (m *Metadata) WithFields(fields ...string) *Metadata {
-	m.SelectedFields = fields
+	m.SelectedFields = cleanFields(fields)
+	return m
+}
+
+// cleanFields trims the fields and drops empty and duplicate entries, preserving order.
+// A "*" wildcard replaces all other fields.
+func cleanFields(fields []string) []string {
+	cleaned := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "*" {
+			return []string{"*"}
+		}
+		if field == "" || seen[field] {
+			continue
+		}
+		seen[field] = true
+		cleaned = append(cleaned, field)
+	}
+	return cleaned
+}
+
+// WithFieldset selects the JSON:API sparse fieldset of the given resource type and returns the metadata for method chaining.
+// SelectedFields is left unchanged when the request specified no fieldset for the type.
+//
+// Example:
+//
+//	// ?fields[users]=name,email
+//	metadata, _ := FromRequest(r)
+//	metadata.WithFieldset("users")
+//	// metadata.SelectedFields == []string{"name", "email"}
+func (m *Metadata) WithFieldset(resourceType string) *Metadata {
+	if fields, ok := m.Fieldsets[resourceType]; ok {
+		m.SelectedFields = fields
+	}
 	return m
 }
 
@@ -473,10 +1782,11 @@ func (m *Metadata) WithFields(fields ...string) *Metadata {
 //	fields := metadata.GetSelectedFields()
 //	// fields == []string{"*"}
 func (m *Metadata) GetSelectedFields() []string {
-	if len(m.SelectedFields) == 0 {
+	fields := cleanFields(m.SelectedFields)
+	if len(fields) == 0 {
 		return []string{"*"}
 	}
-	return m.SelectedFields
+	return fields
 }
 
 // WithDebug enables or disables debug mode and returns the metadata for method chaining.
@@ -491,14 +1801,31 @@ func (m *Metadata) WithDebug(debug bool) *Metadata {
 	return m
 }
 
+// debugInfo returns the debug information, allocating it on first use
+func (m *Metadata) debugInfo() *DebugInfo {
+	if m.DebugInfo == nil {
+		m.DebugInfo = &DebugInfo{}
+	}
+	return m.DebugInfo
+}
+
+// countsExactly reports whether counting may run the exact count query
+func (m *Metadata) countsExactly() bool {
+	return m.KnownTotal == nil && m.CountMode != CountNone && m.CountMode != CountWindow
+}
+
 // WithValidationRule adds a validation rule for a specific field and returns the metadata for method chaining.
 // Rules can be used to validate metadata fields before executing the query.
+// Values of "in:" rules are trimmed, and values containing commas can be double-quoted.
+// "regex:" rules match the sort, fields, search, filter or cursor_field values against a pattern.
 //
 // Example:
 //
 //	metadata := NewMetadata().
 //	  WithValidationRule("page_size", "max:50").
-//	  WithValidationRule("sort", "in:id,name,created_at")
+//	  WithValidationRule("sort", "in:id, name, created_at").
+//	  WithValidationRule("fields", `in:id, "price,currency"`).
+//	  WithValidationRule("filter", "regex:^[a-z_]+$")
 func (m *Metadata) WithValidationRule(field, rule string) *Metadata {
 	if m.ValidationRules == nil {
 		m.ValidationRules = make(map[string]string)
@@ -507,6 +1834,267 @@ func (m *Metadata) WithValidationRule(field, rule string) *Metadata {
 	return m
 }
 
+// WithPreserveOrder keeps an order set on the GORM query beforehand with Order instead of
+// adding the Sort or cursor ordering, and returns the metadata for method chaining.
+// In cursor mode an empty CursorField and CursorOrder are read from the first order column,
+// and an empty CursorTieBreak from the second, so the keyset comparison matches the order.
+//
+// Example:
+//
+//	query := db.Model(&Event{}).Order("created_at desc, id desc")
+//	page, err := CursorPaginate(query, NewMetadata().WithPreserveOrder(true), &events)
+//	// ORDER BY created_at desc, id desc, paging on (created_at, id)
+func (m *Metadata) WithPreserveOrder(preserve bool) *Metadata {
+	m.PreserveOrder = preserve
+	return m
+}
+
+// WithStableOrder appends the primary key column to the ORDER BY of offset pages as a final
+// tie-break, unless the sort already includes it, and returns the metadata for method chaining.
+// Rows sharing a sort value then keep the same order across pages and are neither repeated nor
+// skipped. Pass "" to let Paginate use the primary key of the GORM model.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithSort("age").WithStableOrder("id")
+//	err := Paginate(db.Model(&User{}), metadata, &users)
+//	// ORDER BY age asc, id asc
+func (m *Metadata) WithStableOrder(pkColumn string) *Metadata {
+	m.StableOrder = true
+	m.StableOrderColumn = pkColumn
+	return m
+}
+
+// WithAllowedFields restricts the fields clients may sort, select, page, filter and search by
+// and returns the metadata for method chaining. A single list replaces separate "in:" rules
+// for each of them; each kind of field reports its own error code.
+//
+// Example:
+//
+//	metadata := NewMetadata().
+//	  WithAllowedFields("id", "name", "created_at").
+//	  WithSort("password")
+//	// metadata.Validate() reports INVALID_SORT_FIELD
+func (m *Metadata) WithAllowedFields(fields ...string) *Metadata {
+	m.AllowedFields = fields
+	return m
+}
+
+// allowedFieldErrors reports the fields that are not in AllowedFields
+func (m *Metadata) allowedFieldErrors() []ValidationError {
+	if len(m.AllowedFields) == 0 {
+		return nil
+	}
+
+	allowed := make(map[string]bool, len(m.AllowedFields))
+	for _, field := range m.AllowedFields {
+		allowed[field] = true
+	}
+
+	var errors []ValidationError
+	check := func(param, code, field string) bool {
+		if field == "" || allowed[field] {
+			return true
+		}
+		errors = append(errors, ValidationError{
+			Field:   param,
+			Message: fmt.Sprintf("Field '%s' is not allowed. Allowed fields: %s", field, strings.Join(m.AllowedFields, ", ")),
+			Code:    code,
+		})
+		return false
+	}
+
+	check("sort", "INVALID_SORT_FIELD", m.Sort)
+	for _, field := range m.SortFields {
+		if field.Field != m.Sort && !check("sort_fields", "INVALID_SORT_FIELD", field.Field) {
+			break
+		}
+	}
+	check("cursor_field", "INVALID_CURSOR_FIELD", m.CursorField)
+	check("cursor_tie_break", "INVALID_CURSOR_FIELD", m.CursorTieBreak)
+	for _, field := range m.SelectedFields {
+		if field != "*" && !check("fields", "INVALID_SELECTED_FIELD", field) {
+			break
+		}
+	}
+	for _, filter := range m.Filters {
+		if !check("filters", "INVALID_FILTER_FIELD", filter.Field) {
+			break
+		}
+	}
+	for _, field := range m.SearchFields {
+		if !check("search", "INVALID_SEARCH_FIELD", field) {
+			break
+		}
+	}
+	return errors
+}
+
+// WithCountMode sets how the total row count is obtained and returns the metadata for method chaining.
+// With CountNone no COUNT query is executed; HasNext is detected by fetching one extra row.
+//
+// Example:
+//
+//	metadata := NewMetadata().
+//	  WithCursorField("id").
+//	  WithCountMode(CountNone)
+func (m *Metadata) WithCountMode(mode CountMode) *Metadata {
+	m.CountMode = mode
+	return m
+}
+
+// WithCountStrategy sets how the total row count is obtained for this request and returns the metadata
+// for method chaining. It is equivalent to WithCountMode; both the GORM and the SQL path honor it.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCountStrategy(CountWindow)
+func (m *Metadata) WithCountStrategy(strategy CountStrategy) *Metadata {
+	return m.WithCountMode(strategy)
+}
+
+// WithRequireSort makes a sort (or cursor) field mandatory and returns the metadata for method chaining.
+// Without a sort field, the SQL path omits ORDER BY, which makes page contents nondeterministic.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithRequireSort(true)
+//	result := metadata.Validate()
+//	// result.Errors[0].Code == "SORT_REQUIRED"
+func (m *Metadata) WithRequireSort(require bool) *Metadata {
+	m.RequireSort = require
+	return m
+}
+
+// sortRequiredError is reported when pagination needs an ORDER BY but no sort field is set
+func sortRequiredError() ValidationError {
+	return ValidationError{
+		Field:   "sort",
+		Message: "Sort field is required",
+		Code:    "SORT_REQUIRED",
+	}
+}
+
+// WithKnownTotal sets a precomputed total and returns the metadata for method chaining.
+// Paginate, PaginateWithCount and QueryContextPaginate use it as TotalRows instead of
+// running a COUNT query, while still computing TotalPages, HasNext and the row range.
+// A known total of 0 is distinct from no known total.
+//
+// Example:
+//
+//	total, _ := cache.Get("users:count")
+//	metadata := NewMetadata().WithKnownTotal(total)
+func (m *Metadata) WithKnownTotal(total int64) *Metadata {
+	m.KnownTotal = &total
+	return m
+}
+
+// WithTotalRows sets TotalRows and immediately recomputes TotalPages, HasNext, HasPrevious,
+// FromRow and ToRow (applying defaults like ValidateAndSetDefaults), and returns the metadata for
+// method chaining. Unlike WithKnownTotal, it runs no query and suits metadata serialized without
+// paginating, e.g. with totals from a cache. A total of 0 clears the derived fields.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(2).WithPageSize(10).WithTotalRows(35)
+//	// metadata.TotalPages == 4
+//	// metadata.FromRow == 11 && metadata.ToRow == 20
+func (m *Metadata) WithTotalRows(total int64) *Metadata {
+	m.TotalRows = total
+	m.TotalPages, m.FromRow, m.ToRow = 0, 0, 0
+	m.HasNext, m.HasPrevious = false, false
+	m.ValidateAndSetDefaults()
+	return m
+}
+
+// detectsMore reports whether more rows must be detected by fetching an extra row,
+// which is the case when no total is counted or known, or the count timed out
+func (m *Metadata) detectsMore() bool {
+	return (m.CountMode == CountNone && m.KnownTotal == nil) || m.TotalRows < 0
+}
+
+// WithCountExpression replaces COUNT(*) in the count query of the GORM and SQL paths and returns
+// the metadata for method chaining. Accepted forms are COUNT(*), COUNT(1), COUNT(column) and
+// COUNT(DISTINCT column); COUNT(column) skips rows where the column is NULL.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCountExpression("COUNT(id)")
+//	// SELECT COUNT(id) FROM users
+func (m *Metadata) WithCountExpression(expr string) *Metadata {
+	m.CountExpression = expr
+	return m
+}
+
+// countExpression returns the valid count expression, defaulting to COUNT(*)
+func (m *Metadata) countExpression() string {
+	if m.CountExpression == "" || !countExpressionPattern.MatchString(m.CountExpression) {
+		return "COUNT(*)"
+	}
+	return m.CountExpression
+}
+
+// WithMaxRows caps the rows returned per request at max, whatever the requested page size,
+// and returns the metadata for method chaining. Pages are then max rows long and Truncated
+// reports that the page size was capped. OptimizedPaginate applies the QueryOptimizer's MaxRows
+// the same way.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPageSize(100).WithMaxRows(50)
+//	err := Paginate(db.Model(&User{}), metadata, &users)
+//	// len(users) <= 50, metadata.Truncated == true
+func (m *Metadata) WithMaxRows(max int) *Metadata {
+	m.MaxRows = max
+	return m
+}
+
+// WithCountTimeout caps the duration of the COUNT query and returns the metadata for method chaining.
+// When the count times out, TotalRows is set to -1 (unknown) and HasNext is detected by fetching
+// one extra row, while the data query runs without this limit.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCountTimeout(2 * time.Second)
+//	err := Paginate(db.Model(&Event{}), metadata, &events)
+//	// metadata.TotalRows == -1 when counting took longer than 2s
+func (m *Metadata) WithCountTimeout(timeout time.Duration) *Metadata {
+	m.CountTimeout = timeout
+	return m
+}
+
+// WithGroupedCount forces the total to be counted via a subquery wrapper and returns the metadata for method chaining.
+// Queries with a GROUP BY clause are detected automatically in the GORM path.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithGroupedCount(true)
+//	// SELECT count(*) FROM (SELECT age FROM users GROUP BY age) AS grouped_rows
+func (m *Metadata) WithGroupedCount(grouped bool) *Metadata {
+	m.GroupedCount = grouped
+	return m
+}
+
+// WithPlaceholder overrides the bind parameter style used by the SQL path and returns the metadata for method chaining.
+// By default PostgreSQL uses "$n" and other dialects use "?".
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPlaceholder(ColonPlaceholder)
+//	// LIMIT :1 OFFSET :2
+func (m *Metadata) WithPlaceholder(placeholder Placeholder) *Metadata {
+	m.Placeholder = placeholder
+	return m
+}
+
+// placeholderFor returns the placeholder strategy to use for the dialect
+func (m *Metadata) placeholderFor(dialect Dialect) Placeholder {
+	if m.Placeholder != nil {
+		return m.Placeholder
+	}
+	return dialect.Placeholder()
+}
+
 // Complete pagination examples:
 //
 // Example 1: Offset-based pagination with GORM
@@ -0,0 +1,65 @@
+// Package postgrestest holds integration tests that need a PostgreSQL database. It is a separate
+// module so that metakit users don't inherit the pgx driver.
+package postgrestest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	metakit "github.com/nccapo/paginate-metakit"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSnapshotConsistentPages requires a PostgreSQL database in METAKIT_POSTGRES_DSN
+func TestSnapshotConsistentPages(t *testing.T) {
+	dsn := os.Getenv("METAKIT_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("METAKIT_POSTGRES_DSN is not set")
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open("pgx", dsn)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "DROP TABLE IF EXISTS snapshot_items; CREATE TABLE snapshot_items (id INTEGER PRIMARY KEY)")
+	assert.NoError(t, err)
+	defer db.ExecContext(ctx, "DROP TABLE snapshot_items")
+	_, err = db.ExecContext(ctx, "INSERT INTO snapshot_items SELECT generate_series(2, 8, 2)")
+	assert.NoError(t, err)
+
+	holder, snapshot, err := metakit.ExportSnapshot(ctx, db)
+	assert.NoError(t, err)
+	defer holder.Rollback()
+
+	readPage := func(page int) []int {
+		metadata := metakit.NewMetadata().WithPage(page).WithPageSize(2).WithSort("id").WithSnapshot(snapshot)
+		tx, err := metadata.BeginTx(ctx, db, metakit.PostgreSQL)
+		assert.NoError(t, err)
+		defer tx.Rollback()
+
+		query, args, err := metadata.BuildSQL(metakit.PostgreSQL, "SELECT id FROM snapshot_items")
+		assert.NoError(t, err)
+		rows, err := tx.QueryContext(ctx, query, args...)
+		assert.NoError(t, err)
+		defer rows.Close()
+
+		var ids []int
+		for rows.Next() {
+			var id int
+			assert.NoError(t, rows.Scan(&id))
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []int{2, 4}, readPage(1))
+
+	// A concurrent insert before the second page doesn't shift the rows
+	_, err = db.ExecContext(ctx, "INSERT INTO snapshot_items VALUES (1)")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{6, 8}, readPage(2))
+}
@@ -0,0 +1,85 @@
+package metakit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// snapshotPattern matches PostgreSQL snapshot identifiers as returned by pg_export_snapshot()
+var snapshotPattern = regexp.MustCompile(`^[0-9A-Fa-f]+-[0-9A-Fa-f]+(-[0-9]+)?$`)
+
+// ExportSnapshot starts a REPEATABLE READ transaction on PostgreSQL and exports its snapshot.
+// The returned transaction must stay open while other transactions import the snapshot;
+// commit or roll it back once the traversal is finished.
+//
+// Example:
+//
+//	holder, snapshot, err := ExportSnapshot(ctx, db)
+//	defer holder.Rollback()
+//	metadata := NewMetadata().WithSnapshot(snapshot)
+func ExportSnapshot(ctx context.Context, db *sql.DB) (*sql.Tx, string, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var snapshot string
+	if err := tx.QueryRowContext(ctx, "SELECT pg_export_snapshot()").Scan(&snapshot); err != nil {
+		_ = tx.Rollback()
+		return nil, "", err
+	}
+	return tx, snapshot, nil
+}
+
+// WithSnapshot sets the exported PostgreSQL snapshot the pages are read from and returns the metadata
+// for method chaining. Transactions started with BeginTx import it, so every page sees the same data.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(2).WithSort("id").WithSnapshot("00000003-0000001B-1")
+func (m *Metadata) WithSnapshot(id string) *Metadata {
+	m.Snapshot = id
+	return m
+}
+
+// BeginTx starts a transaction for reading a page. On PostgreSQL with a snapshot set, the transaction
+// runs in REPEATABLE READ and imports the snapshot with SET TRANSACTION SNAPSHOT. Other dialects,
+// or metadata without a snapshot, get a regular read-only transaction.
+//
+// Example:
+//
+//	tx, err := metadata.BeginTx(ctx, db, PostgreSQL)
+//	defer tx.Rollback()
+//	query, args, err := metadata.BuildSQL(PostgreSQL, "SELECT * FROM users")
+//	rows, err := tx.QueryContext(ctx, query, args...)
+func (m *Metadata) BeginTx(ctx context.Context, db *sql.DB, dialect Dialect) (*sql.Tx, error) {
+	if dialect != PostgreSQL || m.Snapshot == "" {
+		return db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	}
+	if !snapshotPattern.MatchString(m.Snapshot) {
+		return nil, &InvalidMetadataError{Errors: []ValidationError{invalidSnapshotError(m.Snapshot)}}
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	// Snapshot identifiers can't be bound as parameters; the pattern above keeps them safe to inline
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", m.Snapshot)); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// invalidSnapshotError returns the validation error reported for malformed snapshot identifiers
+func invalidSnapshotError(snapshot string) ValidationError {
+	return ValidationError{
+		Field:   "snapshot",
+		Message: fmt.Sprintf("Snapshot '%s' is not a valid snapshot identifier", snapshot),
+		Code:    "INVALID_SNAPSHOT",
+	}
+}
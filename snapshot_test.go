@@ -0,0 +1,32 @@
+package metakit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotValidation(t *testing.T) {
+	assert.True(t, NewMetadata().WithSnapshot("00000003-0000001B-1").Validate().IsValid)
+
+	result := NewMetadata().WithSnapshot("1'; DROP TABLE users; --").Validate()
+	assert.False(t, result.IsValid)
+	assert.Equal(t, "INVALID_SNAPSHOT", result.Errors[0].Code)
+}
+
+func TestBeginTxWithoutPostgres(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Snapshots are ignored outside PostgreSQL
+	tx, err := NewMetadata().WithSnapshot("00000003-0000001B-1").BeginTx(context.Background(), db, SQLite)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Rollback())
+
+	_, err = NewMetadata().WithSnapshot("invalid snapshot").BeginTx(context.Background(), db, PostgreSQL)
+	assert.True(t, errors.Is(err, ErrValidation))
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,28 +17,288 @@ const (
 	MySQL Dialect = iota
 	PostgreSQL
 	SQLite
+
+	// CockroachDB uses PostgreSQL placeholders and syntax. Offset pagination gets slower
+	// with every page on distributed tables, so prefer keyset (cursor) pagination.
+	CockroachDB
+
+	// DB2 pages with OFFSET n ROWS FETCH FIRST m ROWS ONLY and "?" placeholders,
+	// and requires an ORDER BY to paginate.
+	DB2
+
+	// SQLServer pages with OFFSET n ROWS FETCH NEXT m ROWS ONLY and "@p1" placeholders,
+	// quotes identifiers in brackets and requires an ORDER BY to paginate.
+	SQLServer
+)
+
+// String returns the name of the dialect
+func (d Dialect) String() string {
+	switch d {
+	case MySQL:
+		return "mysql"
+	case PostgreSQL:
+		return "postgres"
+	case SQLite:
+		return "sqlite"
+	case CockroachDB:
+		return "cockroachdb"
+	case DB2:
+		return "db2"
+	case SQLServer:
+		return "sqlserver"
+	default:
+		if custom, ok := d.custom(); ok {
+			return custom.name
+		}
+		return fmt.Sprintf("Dialect(%d)", int(d))
+	}
+}
+
+// dialectFromName maps a driver or GORM dialector name to a Dialect
+func dialectFromName(name string) (Dialect, bool) {
+	switch name {
+	case "mysql":
+		return MySQL, true
+	case "postgres", "postgresql", "pgx":
+		return PostgreSQL, true
+	case "sqlite", "sqlite3":
+		return SQLite, true
+	case "cockroachdb", "cockroach":
+		return CockroachDB, true
+	case "db2", "go_ibm_db":
+		return DB2, true
+	case "sqlserver", "mssql":
+		return SQLServer, true
+	default:
+		return customDialectFromName(name)
+	}
+}
+
+// postgresCompatible reports whether the dialect follows PostgreSQL syntax
+func (d Dialect) postgresCompatible() bool {
+	return d == PostgreSQL || d == CockroachDB
+}
+
+// requiresOrderBy reports whether the dialect rejects LIMIT/OFFSET pagination without ORDER BY
+func (d Dialect) requiresOrderBy() bool {
+	return d == DB2 || d == SQLServer
+}
+
+// bindsOffsetFirst reports whether the dialect's row limiting clause names the offset before the limit
+func (d Dialect) bindsOffsetFirst() bool {
+	return d == DB2 || d == SQLServer
+}
+
+// booleanLiteral returns the literal the dialect compares boolean columns with: TRUE and FALSE,
+// or 1 and 0 for SQLite, DB2, SQL Server and registered dialects
+func (d Dialect) booleanLiteral(value bool) string {
+	switch d {
+	case MySQL, PostgreSQL, CockroachDB:
+		if value {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		if value {
+			return "1"
+		}
+		return "0"
+	}
+}
+
+// limitClause returns the row limiting clause of the dialect for the limit and, unless empty, offset markers
+func (d Dialect) limitClause(limit, offset string) string {
+	if d == DB2 {
+		if offset == "" {
+			return fmt.Sprintf(" FETCH FIRST %s ROWS ONLY", limit)
+		}
+		return fmt.Sprintf(" OFFSET %s ROWS FETCH FIRST %s ROWS ONLY", offset, limit)
+	}
+	if d == SQLServer {
+		if offset == "" {
+			offset = "0"
+		}
+		return fmt.Sprintf(" OFFSET %s ROWS FETCH NEXT %s ROWS ONLY", offset, limit)
+	}
+
+	if offset == "" {
+		return " LIMIT " + limit
+	}
+	return fmt.Sprintf(" LIMIT %s OFFSET %s", limit, offset)
+}
+
+// validate returns ErrUnsupportedDialect for dialects outside the known set
+func (d Dialect) validate() error {
+	switch d {
+	case MySQL, PostgreSQL, SQLite, CockroachDB, DB2, SQLServer:
+		return nil
+	default:
+		if _, ok := d.custom(); ok {
+			return nil
+		}
+		return fmt.Errorf("%w: %v", ErrUnsupportedDialect, d)
+	}
+}
+
+// DialectBuilder appends the row limiting clause of a custom dialect to query, which already
+// carries its WHERE and ORDER BY clauses. argIndex is the 1-based index of the next bind parameter,
+// and the returned arguments are bound after those of the query.
+type DialectBuilder func(query string, limit, offset int, argIndex int) (string, []any)
+
+// customDialect is a dialect registered with RegisterDialect
+type customDialect struct {
+	name    string
+	builder DialectBuilder
+}
+
+// firstCustomDialect is the value of the first dialect registered with RegisterDialect
+const firstCustomDialect Dialect = 1000
+
+var (
+	customDialectsMu sync.RWMutex
+	customDialects   []customDialect
+)
+
+// RegisterDialect registers a dialect whose pagination suffix is built by builder and returns it
+// for use with QueryContextPaginate and BuildSQL. Cursor pages call builder with an offset of 0.
+// The dialect uses "?" placeholders unless the metadata sets another Placeholder, and its name is
+// also accepted where driver names are mapped to dialects. Registering a name again replaces its
+// builder and returns the same dialect.
+//
+// Example:
+//
+//	Firebird := RegisterDialect("firebird", func(query string, limit, offset, argIndex int) (string, []any) {
+//	  return query + " ROWS ? TO ?", []any{offset + 1, offset + limit}
+//	})
+//	rows, err := QueryContextPaginate(ctx, db, Firebird, "SELECT * FROM users", metadata)
+func RegisterDialect(name string, builder DialectBuilder) Dialect {
+	customDialectsMu.Lock()
+	defer customDialectsMu.Unlock()
+
+	for i, custom := range customDialects {
+		if custom.name == name {
+			customDialects[i].builder = builder
+			return firstCustomDialect + Dialect(i)
+		}
+	}
+	customDialects = append(customDialects, customDialect{name: name, builder: builder})
+	return firstCustomDialect + Dialect(len(customDialects)-1)
+}
+
+// custom returns the registration of a dialect registered with RegisterDialect
+func (d Dialect) custom() (customDialect, bool) {
+	customDialectsMu.RLock()
+	defer customDialectsMu.RUnlock()
+
+	i := int(d - firstCustomDialect)
+	if i < 0 || i >= len(customDialects) {
+		return customDialect{}, false
+	}
+	return customDialects[i], true
+}
+
+// customDialectFromName returns the dialect registered under name
+func customDialectFromName(name string) (Dialect, bool) {
+	customDialectsMu.RLock()
+	defer customDialectsMu.RUnlock()
+
+	for i, custom := range customDialects {
+		if custom.name == name {
+			return firstCustomDialect + Dialect(i), true
+		}
+	}
+	return 0, false
+}
+
+// QuoteIdentifier quotes an identifier for the dialect: backticks for MySQL, brackets for SQL Server
+// and double quotes for the others. Closing quote characters inside the identifier are escaped by
+// doubling them. Dotted identifiers such as table.column are quoted part by part, and a "*" part
+// is kept as is.
+//
+// Example:
+//
+//	QuoteIdentifier(MySQL, "users.name")     // `users`.`name`
+//	QuoteIdentifier(PostgreSQL, `odd"name`) // "odd""name"
+//	QuoteIdentifier(SQLServer, "odd]name")  // [odd]]name]
+func QuoteIdentifier(dialect Dialect, ident string) string {
+	opening, closing := `"`, `"`
+	switch dialect {
+	case MySQL:
+		opening, closing = "`", "`"
+	case SQLServer:
+		opening, closing = "[", "]"
+	}
+
+	parts := strings.Split(ident, ".")
+	for i, part := range parts {
+		if part == "*" {
+			continue
+		}
+		parts[i] = opening + strings.ReplaceAll(part, closing, closing+closing) + closing
+	}
+	return strings.Join(parts, ".")
+}
+
+// Placeholder generates the bind parameter marker for the argument at the given 1-based index
+type Placeholder func(index int) string
+
+var (
+	// QuestionPlaceholder produces "?" markers (MySQL, SQLite)
+	QuestionPlaceholder Placeholder = func(int) string { return "?" }
+
+	// DollarPlaceholder produces "$1", "$2", ... markers (PostgreSQL)
+	DollarPlaceholder Placeholder = func(index int) string { return "$" + strconv.Itoa(index) }
+
+	// ColonPlaceholder produces ":1", ":2", ... markers (Oracle)
+	ColonPlaceholder Placeholder = func(index int) string { return ":" + strconv.Itoa(index) }
+
+	// AtPPlaceholder produces "@p1", "@p2", ... markers (SQL Server)
+	AtPPlaceholder Placeholder = func(index int) string { return "@p" + strconv.Itoa(index) }
 )
 
+// Placeholder returns the default placeholder strategy of the dialect
+func (d Dialect) Placeholder() Placeholder {
+	if d.postgresCompatible() {
+		return DollarPlaceholder
+	}
+	if d == SQLServer {
+		return AtPPlaceholder
+	}
+	return QuestionPlaceholder
+}
+
+// bindArg appends value to args and returns the placeholder referencing it.
+// Arguments already present in args are assumed to be bound by the base query.
+func bindArg(placeholder Placeholder, args *[]any, value any) string {
+	*args = append(*args, value)
+	return placeholder(len(*args))
+}
+
+// QueryerContext runs queries for the SQL path. *sql.DB, *sql.Tx and *sql.Conn satisfy it,
+// so pages can be read inside a transaction.
+type QueryerContext interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 // QueryContextPaginate calculates the total pages and offset based on the current metadata and applies pagination to the SQL query
-func QueryContextPaginate(ctx context.Context, db *sql.DB, dialect Dialect, query string, m *Metadata, args ...any) (*sql.Rows, error) {
+func QueryContextPaginate(ctx context.Context, db QueryerContext, dialect Dialect, query string, m *Metadata, args ...any) (*sql.Rows, error) {
+	// Return promptly when the context is already done
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Validate dialect
+	if err := dialect.validate(); err != nil {
+		return nil, err
+	}
+
+	// Take a sort passed as arguments before validating, so the allow-list and the sort rules apply to it
+	args = takeSortArgs(m, args)
+
 	// Validate metadata
-	validation := m.Validate()
-	if !validation.IsValid {
-		return nil, fmt.Errorf("invalid metadata: %v", validation.Errors)
-	}
-
-	// Check if sort field and direction are provided as separate arguments
-	if len(args) >= 2 {
-		// If the first two arguments are strings, they might be sort field and direction
-		if sortField, ok := args[0].(string); ok {
-			if sortDir, ok := args[1].(string); ok {
-				// Set the sort field and direction in the metadata
-				m.Sort = sortField
-				m.SortDirection = sortDir
-				// Remove these arguments from args
-				args = args[2:]
-			}
-		}
+	if err := m.Validate().Err(); err != nil {
+		return nil, err
 	}
 
 	// Apply cursor-based pagination if enabled
@@ -43,37 +306,27 @@ func QueryContextPaginate(ctx context.Context, db *sql.DB, dialect Dialect, quer
 		return applyCursorSQLPagination(ctx, db, dialect, query, m, args...)
 	}
 
-	// Calculate the total pages
-	if m.PageSize > 0 {
-		totalPages := (m.TotalRows + int64(m.PageSize) - 1) / int64(m.PageSize)
-		m.TotalPages = totalPages
-	} else {
-		m.TotalPages = 1
+	// Use a total provided by the caller, e.g. from a cache
+	if m.KnownTotal != nil {
+		m.TotalRows = *m.KnownTotal
+		m.resolveFromEnd()
+		m.ValidateAndSetDefaults()
 	}
 
-	// Calculate offset for the current page
-	offset := (m.Page - 1) * m.PageSize
-
-	// Build the paginated query
-	var paginatedQuery string
-	switch dialect {
-	case PostgreSQL:
-		// Count the number of existing parameters in the query
-		paramCount := 0
-		for i := 0; i < len(query); i++ {
-			if i+1 < len(query) && query[i] == '$' && query[i+1] >= '1' && query[i+1] <= '9' {
-				paramCount++
-			}
-		}
+	// Calculate the total pages
+	limit := int64(m.GetLimit())
+	m.TotalPages = (m.TotalRows + limit - 1) / limit
 
-		// Use $n for parameterized queries, where n is the next available parameter number
-		paginatedQuery = fmt.Sprintf("%s ORDER BY %s %s LIMIT $%d OFFSET $%d",
-			query, m.Sort, m.SortDirection, paramCount+1, paramCount+2)
-		args = append(args, m.PageSize, offset)
-	case MySQL, SQLite:
-		// Use ? for parameterized queries
-		paginatedQuery = fmt.Sprintf("%s ORDER BY %s %s LIMIT ? OFFSET ?", query, m.Sort, m.SortDirection)
-		args = append(args, m.PageSize, offset)
+	// Build the paginated query, not masking a context canceled meanwhile
+	paginatedQuery, args, err := buildOffsetQuery(query, m, dialect, args)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Debug {
+		m.debugInfo().SQL, m.debugInfo().Args = paginatedQuery, args
 	}
 
 	rows, err := db.QueryContext(ctx, paginatedQuery, args...)
@@ -84,66 +337,340 @@ func QueryContextPaginate(ctx context.Context, db *sql.DB, dialect Dialect, quer
 	return rows, nil
 }
 
-// applyCursorSQLPagination applies cursor-based pagination to the SQL query
-func applyCursorSQLPagination(ctx context.Context, db *sql.DB, dialect Dialect, query string, m *Metadata, args ...any) (*sql.Rows, error) {
-	var paginatedQuery string
-	var cursorCondition string
-
-	// Check if sort field and direction are provided as separate arguments
-	if len(args) >= 2 {
-		// If the first two arguments are strings, they might be sort field and direction
-		if sortField, ok := args[0].(string); ok {
-			if sortDir, ok := args[1].(string); ok {
-				// Set the sort field and direction in the metadata
-				m.Sort = sortField
-				m.SortDirection = sortDir
-				// Remove these arguments from args
-				args = args[2:]
+// CountContext counts the rows of the query following the metadata's count strategy and stores the
+// total in TotalRows. Filters and search apply as in QueryContextPaginate, and grouped or DISTINCT
+// queries are counted through a subquery. CountNone leaves the total unset, and CountApprox falls
+// back to an exact count since plain SQL queries carry no table statistics. CountWindow is rejected
+// with an UNSUPPORTED_COUNT_MODE error, since the rows returned by QueryContextPaginate are scanned
+// by the caller and cannot carry the window count column; a KnownTotal is still used.
+// Call it before QueryContextPaginate to fill in TotalRows.
+//
+// Example:
+//
+//	total, err := CountContext(ctx, db, PostgreSQL, "SELECT * FROM users", metadata)
+//	rows, err := QueryContextPaginate(ctx, db, PostgreSQL, "SELECT * FROM users", metadata)
+func CountContext(ctx context.Context, db QueryerContext, dialect Dialect, query string, m *Metadata, args ...any) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := dialect.validate(); err != nil {
+		return 0, err
+	}
+
+	if m.KnownTotal != nil {
+		m.TotalRows = *m.KnownTotal
+		m.resolveFromEnd()
+		m.ValidateAndSetDefaults()
+		return m.TotalRows, nil
+	}
+
+	if m.CountMode == CountWindow {
+		return 0, &InvalidMetadataError{Errors: []ValidationError{{
+			Field:   "count_mode",
+			Message: "Window counts are only supported by the GORM path",
+			Code:    "UNSUPPORTED_COUNT_MODE",
+		}}}
+	}
+
+	total, counted, err := countWith(m.CountMode, rowCounter{
+		exact: func() (int64, error) {
+			countQuery, countArgs, err := buildCountQuery(query, m, dialect, args)
+			if err != nil {
+				return 0, err
+			}
+			if m.Debug {
+				m.debugInfo().CountSQL = countQuery
 			}
+			count := func() (int64, error) {
+				return withCountTimeout(ctx, m, func(ctx context.Context) (int64, error) {
+					var total int64
+					err := db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&total)
+					return total, err
+				})
+			}
+			if !m.CountCache.enabled() {
+				return count()
+			}
+			return m.CountCache.count(countSignature(countQuery, countArgs), count)
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if counted {
+		m.TotalRows = total
+		m.resolveFromEnd()
+		m.ValidateAndSetDefaults()
+	}
+	return m.TotalRows, nil
+}
+
+// buildCountQuery wraps the filtered query in a COUNT(*) subquery
+func buildCountQuery(query string, m *Metadata, dialect Dialect, args []any) (string, []any, error) {
+	args = append([]any(nil), args...)
+	filterCondition, err := m.filterCondition(dialect, m.placeholderFor(dialect), &args)
+	if err != nil {
+		return "", nil, err
+	}
+	query = wrapBaseQuery(query, filterCondition != "")
+	countQuery := fmt.Sprintf("SELECT %s FROM (%s%s) AS count_rows", m.countExpression(), query, whereClause(filterCondition))
+	return m.followerReadsQuery(countQuery, dialect), args, nil
+}
+
+// buildOffsetQuery appends ORDER BY and LIMIT/OFFSET clauses to the query
+func buildOffsetQuery(query string, m *Metadata, dialect Dialect, args []any) (string, []any, error) {
+	placeholder := m.placeholderFor(dialect)
+
+	// Build filter condition
+	filterCondition, err := m.filterCondition(dialect, placeholder, &args)
+	if err != nil {
+		return "", nil, err
+	}
+	query = wrapBaseQuery(query, filterCondition != "")
+
+	sortColumns, sortDirection := m.sortColumns(dialect)
+	orderBy, err := orderByClause(dialect, sortColumns, sortDirection)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Calculate offset for the current page, which needs the total for pages counted from the end
+	if m.awaitsTotal() {
+		return "", nil, &InvalidMetadataError{Errors: []ValidationError{pageSizeRequiresTotalError()}}
+	}
+	offset := m.GetOffset()
+
+	// Registered dialects build their own suffix
+	if custom, ok := dialect.custom(); ok {
+		paginatedQuery, extra := custom.builder(query+whereClause(filterCondition)+orderBy, m.GetLimit(), offset, len(args)+1)
+		return paginatedQuery, append(args, extra...), nil
+	}
+
+	// DB2 and SQL Server bind the offset before the limit, following the order of their clauses
+	var limitParam, offsetParam string
+	if dialect.bindsOffsetFirst() {
+		offsetParam = bindArg(placeholder, &args, offset)
+		limitParam = bindArg(placeholder, &args, m.GetLimit())
+	} else {
+		limitParam = bindArg(placeholder, &args, m.GetLimit())
+		offsetParam = bindArg(placeholder, &args, offset)
+	}
+	paginatedQuery := fmt.Sprintf("%s%s%s%s", query, whereClause(filterCondition), orderBy, dialect.limitClause(limitParam, offsetParam))
+	return m.followerReadsQuery(paginatedQuery, dialect), args, nil
+}
+
+// compoundQueryPattern matches queries starting with a CTE or combining selects with UNION, INTERSECT or EXCEPT
+var compoundQueryPattern = regexp.MustCompile(`(?is)^\s*WITH\s|\b(UNION|INTERSECT|EXCEPT)\b`)
+
+// wrapCompoundQuery wraps CTE and UNION queries in a subquery, so that WHERE, ORDER BY and LIMIT
+// clauses apply to the whole result instead of its final SELECT
+func wrapCompoundQuery(query string) string {
+	if !compoundQueryPattern.MatchString(query) {
+		return query
+	}
+	return "SELECT * FROM (" + query + ") AS _sub"
+}
+
+// filteringClausePattern matches clauses of a base query that an added WHERE clause cannot follow
+var filteringClausePattern = regexp.MustCompile(`(?i)\b(WHERE|GROUP\s+BY|HAVING)\b`)
+
+// pagingClausePattern matches clauses of a base query that an added ORDER BY or LIMIT clause cannot follow
+var pagingClausePattern = regexp.MustCompile(`(?i)\b(ORDER\s+BY|LIMIT|OFFSET|FETCH)\b`)
+
+// wrapBaseQuery wraps the base query in a subquery when the clauses added to it would not be valid
+// after its own: queries with their own ORDER BY or LIMIT, queries with their own WHERE, GROUP BY
+// or HAVING when filtering adds a WHERE clause, and CTE and UNION queries. Other queries, including
+// joins, are extended in place, so their added clauses may refer to qualified columns.
+func wrapBaseQuery(query string, filtering bool) string {
+	if pagingClausePattern.MatchString(query) || (filtering && filteringClausePattern.MatchString(query)) {
+		return "SELECT * FROM (" + query + ") AS _sub"
+	}
+	return wrapCompoundQuery(query)
+}
+
+// whereClause combines the non-empty conditions into a WHERE clause, or returns an empty string
+func whereClause(conditions ...string) string {
+	var parts []string
+	for _, condition := range conditions {
+		if condition != "" {
+			parts = append(parts, condition)
 		}
 	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(parts, " AND ")
+}
 
-	// Count the number of existing parameters in the query for PostgreSQL
-	paramCount := 0
-	if dialect == PostgreSQL {
-		for i := 0; i < len(query); i++ {
-			if i+1 < len(query) && query[i] == '$' && query[i+1] >= '1' && query[i+1] <= '9' {
-				paramCount++
-			}
+// orderByClause returns the ORDER BY clause for the column, or an empty string when no column is set.
+// Dialects that cannot paginate without ORDER BY report a SORT_REQUIRED validation error instead.
+func orderByClause(dialect Dialect, column, direction string) (string, error) {
+	if column == "" {
+		if dialect.requiresOrderBy() {
+			return "", &InvalidMetadataError{Errors: []ValidationError{sortRequiredError()}}
 		}
+		return "", nil
 	}
 
-	// Build cursor condition
-	if m.Cursor != "" {
-		cursorValue, err := decodeCursor(m.Cursor)
-		if err != nil {
-			return nil, fmt.Errorf("invalid cursor: %v", err)
+	if direction == "" {
+		direction = "asc"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s", column, direction), nil
+}
+
+// BuildSQL returns the paginated SQL statement and its arguments without executing it.
+// The base query's own arguments are passed in args and come first in the result.
+// This is useful for logging and debugging the exact statement QueryContextPaginate runs.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithPage(2).WithPageSize(10).WithSort("id")
+//	query, args, err := metadata.BuildSQL(PostgreSQL, "SELECT * FROM users WHERE age > $1", 18)
+//	// query == "SELECT * FROM users WHERE age > $1 ORDER BY id asc LIMIT $2 OFFSET $3"
+//	// args == []any{18, 10, 10}
+func (m *Metadata) BuildSQL(dialect Dialect, baseQuery string, args ...any) (string, []any, error) {
+	if err := dialect.validate(); err != nil {
+		return "", nil, err
+	}
+	if err := m.Validate().Err(); err != nil {
+		return "", nil, err
+	}
+
+	if m.IsCursorBased() {
+		return buildCursorQuery(baseQuery, m, dialect, args)
+	}
+
+	return buildOffsetQuery(baseQuery, m, dialect, args)
+}
+
+// WithFollowerReads makes CockroachDB queries read historical data at the given staleness
+// using AS OF SYSTEM TIME, served by the nearest replica, and returns the metadata for method chaining.
+// All pages then read from a consistent recent snapshot. The clause is added to the outermost
+// statement, before its first clause following FROM, so it stays in place when the base query
+// is wrapped in a subquery. Other dialects ignore the setting.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithCursorField("id").WithFollowerReads(5 * time.Second)
+//	query, args, err := metadata.BuildSQL(CockroachDB, "SELECT * FROM users")
+//	// query == "SELECT * FROM users AS OF SYSTEM TIME '-5s' ORDER BY id asc LIMIT $1"
+func (m *Metadata) WithFollowerReads(staleness time.Duration) *Metadata {
+	m.FollowerReads = staleness
+	return m
+}
+
+// followerReadsQuery adds the AS OF SYSTEM TIME clause to the built statement when follower reads
+// are enabled, before its first top-level clause following FROM, since CockroachDB only accepts it there
+func (m *Metadata) followerReadsQuery(query string, dialect Dialect) string {
+	if dialect != CockroachDB || m.FollowerReads <= 0 {
+		return query
+	}
+
+	clause := fmt.Sprintf(" AS OF SYSTEM TIME '-%s'", m.FollowerReads)
+	if i := topLevelClauseIndex(query); i >= 0 {
+		return query[:i] + clause + query[i:]
+	}
+	return query + clause
+}
+
+// PreparedStatement returns a SQL template for the metadata that stays the same across pages,
+// together with the names of the values to bind in order, so the statement can be prepared once
+// and executed per request. Names are "filter:<field>" (one per bound filter value), "search"
+// (one per search field, or one for full-text search), "cursor", "after", "before", "limit" and "offset".
+// The template depends on the sort, selected fields, filter operators, value counts, boolean
+// and null equality values (rendered as literals and IS [NOT] NULL without binding) and on
+// whether a cursor is present, so these must be fixed for a prepared statement.
+// Placeholders are numbered from 1, so the base query must not bind parameters of its own.
+// An empty template is returned when the statement cannot be built.
+//
+// Example:
+//
+//	metadata := NewMetadata().WithSort("id").WithPageSize(20)
+//	stmtSQL, argOrder := metadata.PreparedStatement(PostgreSQL, "SELECT * FROM users")
+//	// stmtSQL == "SELECT * FROM users ORDER BY id asc LIMIT $1 OFFSET $2"
+//	// argOrder == []string{"limit", "offset"}
+//	stmt, err := db.Prepare(stmtSQL)
+//	rows, err := stmt.Query(metadata.GetLimit(), metadata.GetOffset())
+func (m *Metadata) PreparedStatement(dialect Dialect, baseQuery string) (stmtSQL string, argOrder []string) {
+	// The arguments of registered dialects are opaque
+	if _, ok := dialect.custom(); ok {
+		return "", nil
+	}
+
+	query, _, err := m.BuildSQL(dialect, baseQuery)
+	if err != nil {
+		return "", nil
+	}
+
+	for _, filter := range m.Filters {
+		for range filter.boundValues() {
+			argOrder = append(argOrder, "filter:"+filter.Field)
 		}
+	}
 
-		operator := ">"
-		if m.CursorOrder == "desc" {
-			operator = "<"
+	if m.SearchTerm != "" && len(m.SearchFields) > 0 {
+		count := len(m.SearchFields)
+		if m.SearchFullText && dialect.postgresCompatible() {
+			count = 1
 		}
+		for i := 0; i < count; i++ {
+			argOrder = append(argOrder, "search")
+		}
+	}
 
-		switch dialect {
-		case PostgreSQL:
-			cursorCondition = fmt.Sprintf("WHERE %s %s $%d", m.CursorField, operator, paramCount+1)
-			args = append(args, cursorValue)
-		case MySQL, SQLite:
-			cursorCondition = fmt.Sprintf("WHERE %s %s ?", m.CursorField, operator)
-			args = append(args, cursorValue)
+	if m.fts() {
+		argOrder = append(argOrder, "fts")
+	}
+
+	if m.IsCursorBased() {
+		for _, bound := range []struct{ name, cursor string }{{"cursor", m.Cursor}, {"after", m.After}, {"before", m.Before}} {
+			if bound.cursor != "" {
+				argOrder = append(argOrder, bound.name)
+			}
 		}
+		return query, append(argOrder, "limit")
+	}
+	if dialect.bindsOffsetFirst() {
+		return query, append(argOrder, "offset", "limit")
 	}
+	return query, append(argOrder, "limit", "offset")
+}
 
-	// Build the complete query
-	switch dialect {
-	case PostgreSQL:
-		paginatedQuery = fmt.Sprintf("%s %s ORDER BY %s %s LIMIT $%d",
-			query, cursorCondition, m.CursorField, m.CursorOrder, paramCount+len(args)+1)
-		args = append(args, m.PageSize)
-	case MySQL, SQLite:
-		paginatedQuery = fmt.Sprintf("%s %s ORDER BY %s %s LIMIT ?", query, cursorCondition, m.CursorField, m.CursorOrder)
-		args = append(args, m.PageSize)
+// takeSortArgs sets the sort field and direction from the first two arguments when both are
+// strings, and returns the remaining arguments
+func takeSortArgs(m *Metadata, args []any) []any {
+	if len(args) < 2 {
+		return args
+	}
+	sortField, ok := args[0].(string)
+	if !ok {
+		return args
+	}
+	sortDir, ok := args[1].(string)
+	if !ok {
+		return args
+	}
+	m.Sort = sortField
+	m.SortDirection = sortDir
+	return args[2:]
+}
+
+// applyCursorSQLPagination applies cursor-based pagination to the SQL query
+func applyCursorSQLPagination(ctx context.Context, db QueryerContext, dialect Dialect, query string, m *Metadata, args ...any) (*sql.Rows, error) {
+	if err := dialect.validate(); err != nil {
+		return nil, err
+	}
+
+	// Build the paginated query, not masking a context canceled while decoding the cursor
+	paginatedQuery, args, err := buildCursorQuery(query, m, dialect, args)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Debug {
+		m.debugInfo().SQL, m.debugInfo().Args = paginatedQuery, args
 	}
 
 	rows, err := db.QueryContext(ctx, paginatedQuery, args...)
@@ -154,6 +681,184 @@ func applyCursorSQLPagination(ctx context.Context, db *sql.DB, dialect Dialect,
 	return rows, nil
 }
 
+// buildCursorQuery appends the cursor condition, ORDER BY and LIMIT clauses to the query
+func buildCursorQuery(query string, m *Metadata, dialect Dialect, args []any) (string, []any, error) {
+	placeholder := m.placeholderFor(dialect)
+
+	// Build filter and cursor conditions
+	filterCondition, err := m.filterCondition(dialect, placeholder, &args)
+	if err != nil {
+		return "", nil, err
+	}
+	cursorCondition, err := m.cursorCondition(placeholder, &args)
+	if err != nil {
+		return "", nil, err
+	}
+	query = wrapBaseQuery(query, filterCondition != "" || cursorCondition != "")
+
+	orderColumns, orderDirection := m.cursorOrderColumns()
+	orderBy, err := orderByClause(dialect, orderColumns, orderDirection)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Build the complete query, letting registered dialects build their own suffix
+	if filterCondition != "" && strings.Contains(cursorCondition, " OR ") {
+		cursorCondition = "(" + cursorCondition + ")"
+	}
+	if custom, ok := dialect.custom(); ok {
+		paginatedQuery, extra := custom.builder(query+whereClause(filterCondition, cursorCondition)+orderBy, m.GetLimit(), 0, len(args)+1)
+		return m.forwardOrder(paginatedQuery), append(args, extra...), nil
+	}
+	limitParam := bindArg(placeholder, &args, m.GetLimit())
+	paginatedQuery := fmt.Sprintf("%s%s%s%s", query, whereClause(filterCondition, cursorCondition), orderBy, dialect.limitClause(limitParam, ""))
+	return m.followerReadsQuery(m.forwardOrder(paginatedQuery), dialect), args, nil
+}
+
+// forwardOrder restores the order of the forward pages on the rows of a backward page query,
+// queried in reversed key order, by ordering them again in an outer query
+func (m *Metadata) forwardOrder(query string) string {
+	if !m.backward() {
+		return query
+	}
+	columns, direction := m.orderColumns(unqualifiedColumn(m.CursorField), unqualifiedColumn(m.CursorTieBreak), false)
+	return fmt.Sprintf("SELECT * FROM (%s) AS _page ORDER BY %s %s", query, columns, direction)
+}
+
+// unqualifiedColumn strips the table name from a qualified column, which the outer query of a
+// subquery cannot refer to
+func unqualifiedColumn(column string) string {
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		return column[i+1:]
+	}
+	return column
+}
+
+// topLevelClausePattern matches a clause that may follow the FROM clause of a statement at the
+// start of the text
+var topLevelClausePattern = regexp.MustCompile(`(?i)^\s(WHERE|GROUP\s+BY|HAVING|ORDER\s+BY|LIMIT|OFFSET|FETCH)\b`)
+
+// topLevelClauseIndex returns the index of the first clause following FROM outside of any subquery,
+// string literal or quoted identifier, or -1 when the statement has none
+func topLevelClauseIndex(query string) int {
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"', '`':
+			// Skip to the closing quote; a doubled quote resumes scanning at the next one
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return -1
+			}
+			i += end + 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ' ', '\t', '\n', '\r':
+			if depth == 0 && topLevelClausePattern.MatchString(query[i:]) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// GetCursorClause returns the keyset condition and its bound values for the current cursor,
+// allowing the library's cursor logic to be composed into manually built queries.
+// The clause does not include the WHERE keyword and is empty on the first page.
+// Placeholders are numbered from 1 for dialects using numbered parameters.
+//
+// Example:
+//
+//	clause, args, err := metadata.GetCursorClause(PostgreSQL)
+//	// clause == "id > $1"
+//	// args == []any{int64(42)}
+func (m *Metadata) GetCursorClause(dialect Dialect) (string, []any, error) {
+	if err := dialect.validate(); err != nil {
+		return "", nil, err
+	}
+
+	var args []any
+	clause, err := m.cursorCondition(m.placeholderFor(dialect), &args)
+	if err != nil {
+		return "", nil, err
+	}
+	return clause, args, nil
+}
+
+// cursorCondition builds the keyset comparison for the current cursor and the
+// after/before bounds, binding their values to args
+func (m *Metadata) cursorCondition(placeholder Placeholder, args *[]any) (string, error) {
+	forward, backward := ">", "<"
+	if cursorOrder, _ := m.cursorDirections(); cursorOrder == "desc" {
+		forward, backward = "<", ">"
+	}
+
+	bounds := []struct {
+		cursor   string
+		operator string
+	}{
+		{m.Cursor, forward},
+		{m.After, forward},
+		{m.Before, backward},
+	}
+
+	var conditions []string
+	for _, bound := range bounds {
+		if bound.cursor == "" {
+			continue
+		}
+
+		cursorValue, _, err := m.decodeCursorValue(bound.cursor)
+		if err != nil {
+			return "", err
+		}
+		cursorValue, tieBreakValue, err := m.cursorKey(cursorValue)
+		if err != nil {
+			return "", err
+		}
+
+		if m.CursorTieBreak != "" {
+			conditions = append(conditions, m.tieBreakCondition(placeholder, args, bound.operator, cursorValue, tieBreakValue))
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s %s", m.CursorField, bound.operator, bindArg(placeholder, args, cursorValue)))
+	}
+
+	// Keep OR chains of several bounds apart
+	if len(conditions) > 1 {
+		for i, condition := range conditions {
+			if strings.Contains(condition, " OR ") {
+				conditions[i] = "(" + condition + ")"
+			}
+		}
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// tieBreakCondition compares the cursor field and tie-break column with their cursor values.
+// Columns sorted in the same direction are compared as a pair; mixed directions expand into
+// an OR chain, as a row follows the cursor when its cursor field is past the cursor value or
+// equal to it with the tie-break column past the tie-break value.
+func (m *Metadata) tieBreakCondition(placeholder Placeholder, args *[]any, operator string, cursorValue, tieBreakValue any) string {
+	cursorOrder, tieBreakOrder := m.cursorDirections()
+	if cursorOrder == tieBreakOrder {
+		return fmt.Sprintf("(%s, %s) %s (%s, %s)", m.CursorField, m.CursorTieBreak, operator,
+			bindArg(placeholder, args, cursorValue), bindArg(placeholder, args, tieBreakValue))
+	}
+
+	tieBreakOperator := ">"
+	if operator == ">" {
+		tieBreakOperator = "<"
+	}
+	first := bindArg(placeholder, args, cursorValue)
+	equal := bindArg(placeholder, args, cursorValue)
+	tieBreak := bindArg(placeholder, args, tieBreakValue)
+	return fmt.Sprintf("%s %s %s OR (%s = %s AND %s %s %s)", m.CursorField, operator, first,
+		m.CursorField, equal, m.CursorTieBreak, tieBreakOperator, tieBreak)
+}
+
 // New types for cursor pagination
 type CursorPage struct {
 	Data       []map[string]interface{} `json:"data"`
@@ -162,7 +867,15 @@ type CursorPage struct {
 	HasMore    bool                     `json:"has_more"`
 }
 
-// New cache types
+// CursorPageT is a cursor page whose rows keep their type, as returned by CursorPaginateT
+type CursorPageT[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// CacheConfig configures a cache, such as the CountCache
 type CacheConfig struct {
 	Enabled bool
 	TTL     time.Duration
@@ -185,6 +898,7 @@ type QueryOptimizer struct {
 	Timeout         time.Duration
 	MaxRows         int
 	UseMaterialized bool
+	QueryTag        string
 }
 
 // NewQueryOptimizer creates a new query optimizer with default settings
@@ -235,6 +949,19 @@ func (q *QueryOptimizer) WithMaterialized(use bool) *QueryOptimizer {
 	return q
 }
 
+// WithQueryTag sets a tag prepended to queries as a SQL comment, attributing them in
+// slow-query logs and pg_stat_statements. Comment delimiters in the tag are removed.
+//
+// Example:
+//
+//	optimizer := NewQueryOptimizer().WithQueryTag("service:orders endpoint:list")
+//	query := optimizer.OptimizeQuery("SELECT * FROM orders", PostgreSQL)
+//	// /* service:orders endpoint:list */ SELECT * FROM orders LIMIT 10000
+func (q *QueryOptimizer) WithQueryTag(tag string) *QueryOptimizer {
+	q.QueryTag = tag
+	return q
+}
+
 // OptimizeQuery applies optimization strategies to the query
 func (q *QueryOptimizer) OptimizeQuery(query string, dialect Dialect) string {
 	optimized := query
@@ -259,14 +986,77 @@ func (q *QueryOptimizer) OptimizeQuery(query string, dialect Dialect) string {
 		optimized = addRowLimit(optimized, q.MaxRows, dialect)
 	}
 
+	// Prepend the query tag comment
+	if comment := queryComment(q.QueryTag); comment != "" {
+		optimized = comment + " " + optimized
+	}
+
 	return optimized
 }
 
+// queryComment returns the tag as a SQL comment with comment delimiters removed so the tag
+// cannot close the comment, or an empty string when nothing of the tag remains
+func queryComment(tag string) string {
+	for strings.Contains(tag, "*/") || strings.Contains(tag, "/*") {
+		tag = strings.ReplaceAll(strings.ReplaceAll(tag, "*/", ""), "/*", "")
+	}
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return ""
+	}
+	return "/* " + tag + " */"
+}
+
+const (
+	// hintedIndex is the index forced by index hints
+	hintedIndex = "idx_created_at"
+
+	// hintedIndexColumn is the column indexed by hintedIndex
+	hintedIndexColumn = "created_at"
+)
+
+// IndexHintWarning returns a warning when index hints are enabled but m orders by columns other
+// than the one of the hinted index, which forces the index while the database still sorts the rows
+// (a filesort). It returns an empty string when the hint matches or m has no order.
+// The warning is advisory; OptimizedPaginate prints it in debug mode and never fails because of it.
+//
+// Example:
+//
+//	warning := NewQueryOptimizer().IndexHintWarning(NewMetadata().WithSort("name"))
+//	// warning == "index hint idx_created_at covers created_at, but the query is ordered by name"
+func (q *QueryOptimizer) IndexHintWarning(m *Metadata) string {
+	if !q.UseIndexHint {
+		return ""
+	}
+
+	var columns []string
+	if m.IsCursorBased() && m.CursorField != "" {
+		columns = append(columns, m.CursorField)
+	} else if len(m.SortFields) > 0 {
+		for _, field := range m.SortFields {
+			columns = append(columns, field.Field)
+		}
+	} else if m.Sort != "" {
+		columns = append(columns, m.Sort)
+	}
+	if len(columns) == 0 {
+		return ""
+	}
+
+	for _, column := range columns {
+		if column == hintedIndexColumn || strings.HasSuffix(column, "."+hintedIndexColumn) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("index hint %s covers %s, but the query is ordered by %s",
+		hintedIndex, hintedIndexColumn, strings.Join(columns, ", "))
+}
+
 // addMySQLIndexHints adds MySQL-specific index hints
 func addMySQLIndexHints(query string) string {
 	// Add FORCE INDEX hint for better performance
 	if strings.Contains(strings.ToLower(query), "where") {
-		return strings.Replace(query, "WHERE", "FORCE INDEX (idx_created_at) WHERE", 1)
+		return strings.Replace(query, "WHERE", "FORCE INDEX ("+hintedIndex+") WHERE", 1)
 	}
 	return query
 }
@@ -275,7 +1065,7 @@ func addMySQLIndexHints(query string) string {
 func addPostgreSQLIndexHints(query string) string {
 	// Add index hints using PostgreSQL syntax
 	if strings.Contains(strings.ToLower(query), "where") {
-		return strings.Replace(query, "WHERE", "WHERE /*+ IndexScan(table_name idx_created_at) */", 1)
+		return strings.Replace(query, "WHERE", "WHERE /*+ IndexScan(table_name "+hintedIndex+") */", 1)
 	}
 	return query
 }
@@ -295,10 +1085,12 @@ func addMaterializedView(query string, dialect Dialect) string {
 // addRowLimit adds a row limit to the query
 func addRowLimit(query string, limit int, dialect Dialect) string {
 	switch dialect {
-	case PostgreSQL:
+	case PostgreSQL, CockroachDB:
 		return query + fmt.Sprintf(" LIMIT %d", limit)
 	case MySQL, SQLite:
 		return query + fmt.Sprintf(" LIMIT %d", limit)
+	case DB2:
+		return query + fmt.Sprintf(" FETCH FIRST %d ROWS ONLY", limit)
 	default:
 		return query
 	}
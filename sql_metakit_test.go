@@ -3,8 +3,11 @@ package metakit
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -43,7 +46,7 @@ func TestSPaginate(t *testing.T) {
 
 	for _, test := range tests {
 		test.metadata.ValidateAndSetDefaults()
-		rows, err := QueryContextPaginate(context.Background(), db, 1, "SELECT * FROM items", &test.metadata)
+		rows, err := QueryContextPaginate(context.Background(), db, PostgreSQL, "SELECT * FROM items", &test.metadata)
 		if err != nil {
 			t.Fatalf("failed to execute paginated query: %v", err)
 		}
@@ -199,3 +202,1293 @@ func TestQueryContextPaginateWithPostgreSQLParams(t *testing.T) {
 		t.Log("No rows returned, which might be expected depending on the data")
 	}
 }
+
+func TestPlaceholderStrategies(t *testing.T) {
+	tests := []struct {
+		name        string
+		placeholder Placeholder
+		expected    []string
+	}{
+		{"Question", QuestionPlaceholder, []string{"?", "?", "?"}},
+		{"Dollar", DollarPlaceholder, []string{"$1", "$2", "$3"}},
+		{"Colon", ColonPlaceholder, []string{":1", ":2", ":3"}},
+		{"AtP", AtPPlaceholder, []string{"@p1", "@p2", "@p3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, expected := range tt.expected {
+				if got := tt.placeholder(i + 1); got != expected {
+					t.Errorf("expected %q, got %q", expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildQueriesWithPlaceholder(t *testing.T) {
+	tests := []struct {
+		name          string
+		dialect       Dialect
+		placeholder   Placeholder
+		args          []any
+		expectedQuery string
+	}{
+		{"MySQL", MySQL, nil, nil, "SELECT * FROM items ORDER BY id asc LIMIT ? OFFSET ?"},
+		{"PostgreSQL", PostgreSQL, nil, nil, "SELECT * FROM items ORDER BY id asc LIMIT $1 OFFSET $2"},
+		{"PostgreSQL with args", PostgreSQL, nil, []any{"a"}, "SELECT * FROM items ORDER BY id asc LIMIT $2 OFFSET $3"},
+		{"Oracle", MySQL, ColonPlaceholder, nil, "SELECT * FROM items ORDER BY id asc LIMIT :1 OFFSET :2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetadata().WithPage(3).WithPageSize(20).WithSort("id").WithPlaceholder(tt.placeholder)
+			query, args, err := buildOffsetQuery("SELECT * FROM items", m, tt.dialect, tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if query != tt.expectedQuery {
+				t.Errorf("expected %q, got %q", tt.expectedQuery, query)
+			}
+			if args[len(args)-2] != 20 || args[len(args)-1] != 40 {
+				t.Errorf("expected limit/offset args 20/40, got %v", args)
+			}
+		})
+	}
+
+	cursor := NewMetadata().
+		WithCursor(encodeCursor(10)).
+		WithCursorField("id").
+		WithCursorOrder("asc").
+		WithPageSize(5).
+		WithPlaceholder(AtPPlaceholder)
+	query, args, err := buildCursorQuery("SELECT * FROM items", cursor, MySQL, nil)
+	if err != nil {
+		t.Fatalf("failed to build cursor query: %v", err)
+	}
+	expected := "SELECT * FROM items WHERE id > @p1 ORDER BY id asc LIMIT @p2"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+	if len(args) != 2 || args[0] != int64(10) || args[1] != 5 {
+		t.Errorf("unexpected args %v", args)
+	}
+}
+
+func TestQueryContextPaginateCustomPlaceholder(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for i := 1; i <= 30; i++ {
+		if _, err = db.Exec("INSERT INTO items (name) VALUES (?)", fmt.Sprintf("Item %d", i)); err != nil {
+			t.Fatalf("failed to insert data: %v", err)
+		}
+	}
+
+	// SQLite understands numbered "$n" parameters as well
+	m := NewMetadata().WithPage(2).WithPageSize(10).WithSort("id").WithPlaceholder(DollarPlaceholder)
+	rows, err := QueryContextPaginate(context.Background(), db, SQLite, "SELECT id FROM items", m)
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("failed to scan row: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != 10 || ids[0] != 11 {
+		t.Errorf("expected 10 rows starting at id 11, got %v", ids)
+	}
+}
+
+func TestGetCursorClause(t *testing.T) {
+	tests := []struct {
+		dialect  Dialect
+		expected string
+	}{
+		{MySQL, "id < ?"},
+		{PostgreSQL, "id < $1"},
+		{SQLite, "id < ?"},
+	}
+
+	for _, tt := range tests {
+		// First page has no cursor condition
+		m := NewMetadata().WithCursorField("id").WithCursorOrder("desc")
+		clause, args, err := m.GetCursorClause(tt.dialect)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if clause != "" || len(args) != 0 {
+			t.Errorf("expected empty clause for first page, got %q %v", clause, args)
+		}
+
+		// Subsequent page compares against the cursor value
+		m.WithCursor(encodeCursor(42))
+		clause, args, err = m.GetCursorClause(tt.dialect)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if clause != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, clause)
+		}
+		if len(args) != 1 || args[0] != int64(42) {
+			t.Errorf("expected args [42], got %v", args)
+		}
+	}
+
+	// Malformed cursors are reported
+	m := NewMetadata().WithCursorField("id").WithCursor("not base64!")
+	if _, _, err := m.GetCursorClause(SQLite); err == nil {
+		t.Error("expected error for invalid cursor")
+	}
+}
+
+func TestUnsupportedDialect(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	m := NewMetadata().WithSort("id")
+	_, err = QueryContextPaginate(context.Background(), db, Dialect(42), "SELECT 1", m)
+	if !errors.Is(err, ErrUnsupportedDialect) {
+		t.Errorf("expected ErrUnsupportedDialect, got %v", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "Dialect(42)") {
+		t.Errorf("expected dialect name in error, got %q", err.Error())
+	}
+
+	m = NewMetadata().WithCursorField("id").WithCursor(encodeCursor(1))
+	if _, _, err = m.GetCursorClause(Dialect(-1)); !errors.Is(err, ErrUnsupportedDialect) {
+		t.Errorf("expected ErrUnsupportedDialect, got %v", err)
+	}
+
+	names := map[Dialect]string{MySQL: "mysql", PostgreSQL: "postgres", SQLite: "sqlite"}
+	for dialect, name := range names {
+		if dialect.String() != name {
+			t.Errorf("expected %q, got %q", name, dialect.String())
+		}
+	}
+}
+
+func TestSortCollation(t *testing.T) {
+	tests := []struct {
+		dialect   Dialect
+		collation string
+		expected  string
+	}{
+		{PostgreSQL, "de-DE-x-icu", `name COLLATE "de-DE-x-icu" asc`},
+		{MySQL, "utf8mb4_unicode_ci", "name COLLATE utf8mb4_unicode_ci asc"},
+		{SQLite, "NOCASE", "name COLLATE NOCASE asc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			m := NewMetadata().WithSort("name").WithSortCollation("name", tt.collation)
+			if got := m.GetSortClauseFor(tt.dialect); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+
+			query, _, _ := buildOffsetQuery("SELECT * FROM items", m, tt.dialect, nil)
+			if !strings.Contains(query, "ORDER BY "+tt.expected) {
+				t.Errorf("expected query to order by %q, got %q", tt.expected, query)
+			}
+		})
+	}
+
+	// Collations for other fields are ignored
+	m := NewMetadata().WithSort("id").WithSortCollation("name", "NOCASE")
+	if got := m.GetSortClause(); got != "id asc" {
+		t.Errorf("expected %q, got %q", "id asc", got)
+	}
+
+	// Injection attempts are rejected and never emitted
+	m = NewMetadata().WithSort("name").WithSortCollation("name", `C"; DROP TABLE users; --`)
+	validation := m.Validate()
+	if validation.IsValid || validation.Errors[0].Code != "INVALID_COLLATION" {
+		t.Errorf("expected INVALID_COLLATION, got %v", validation.Errors)
+	}
+	if got := m.GetSortClauseFor(PostgreSQL); got != "name asc" {
+		t.Errorf("expected collation to be dropped, got %q", got)
+	}
+}
+
+func TestBuildSQL(t *testing.T) {
+	m := NewMetadata().WithPage(2).WithPageSize(10).WithSort("id")
+	query, args, err := m.BuildSQL(PostgreSQL, "SELECT * FROM users WHERE age > $1", 18)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "SELECT * FROM users WHERE age > $1 ORDER BY id asc LIMIT $2 OFFSET $3"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+	if fmt.Sprint(args) != "[18 10 10]" {
+		t.Errorf("expected args [18 10 10], got %v", args)
+	}
+
+	m = NewMetadata().
+		WithPageSize(5).
+		WithCursorField("id").
+		WithCursorOrder("desc").
+		WithCursor(encodeCursor(100))
+	query, args, err = m.BuildSQL(MySQL, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "SELECT * FROM users WHERE id < ? ORDER BY id desc LIMIT ?"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+	if fmt.Sprint(args) != "[100 5]" {
+		t.Errorf("expected args [100 5], got %v", args)
+	}
+
+	// Invalid metadata is reported instead of building SQL
+	if _, _, err = NewMetadata().WithPageSize(0).BuildSQL(MySQL, "SELECT 1"); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected ErrValidation, got %v", err)
+	}
+}
+
+func TestEmptySortOmitsOrderBy(t *testing.T) {
+	for _, dialect := range []Dialect{MySQL, PostgreSQL, SQLite} {
+		t.Run(dialect.String(), func(t *testing.T) {
+			m := NewMetadata().WithPage(2).WithPageSize(10)
+			query, _, err := m.BuildSQL(dialect, "SELECT * FROM items")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Contains(query, "ORDER BY") {
+				t.Errorf("expected no ORDER BY, got %q", query)
+			}
+			if !strings.HasPrefix(query, "SELECT * FROM items LIMIT ") {
+				t.Errorf("unexpected query %q", query)
+			}
+
+			// Requiring a sort turns the missing field into a validation error
+			m.WithRequireSort(true)
+			_, _, err = m.BuildSQL(dialect, "SELECT * FROM items")
+			var invalid *InvalidMetadataError
+			if !errors.As(err, &invalid) || invalid.Errors[0].Code != "SORT_REQUIRED" {
+				t.Errorf("expected SORT_REQUIRED, got %v", err)
+			}
+
+			// A cursor field satisfies the requirement
+			m = NewMetadata().WithRequireSort(true).WithCursorField("id")
+			query, _, err = m.BuildSQL(dialect, "SELECT * FROM items")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(query, "ORDER BY id asc") {
+				t.Errorf("expected cursor ORDER BY, got %q", query)
+			}
+		})
+	}
+}
+
+func TestQueryContextPaginateKnownTotal(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	m := NewMetadata().WithPage(1).WithPageSize(10).WithKnownTotal(35)
+	rows, err := QueryContextPaginate(context.Background(), db, SQLite, "SELECT 1", m)
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	rows.Close()
+
+	if m.TotalRows != 35 || m.TotalPages != 4 || !m.HasNext {
+		t.Errorf("unexpected metadata: total=%d pages=%d hasNext=%v", m.TotalRows, m.TotalPages, m.HasNext)
+	}
+}
+
+func TestJSONSortField(t *testing.T) {
+	tests := []struct {
+		dialect  Dialect
+		path     string
+		expected string
+	}{
+		{PostgreSQL, "priority", "data->>'priority' desc"},
+		{PostgreSQL, "meta.rank", "data#>>'{meta,rank}' desc"},
+		{MySQL, "priority", "JSON_EXTRACT(data, '$.priority') desc"},
+		{SQLite, "meta.rank", "JSON_EXTRACT(data, '$.meta.rank') desc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String()+"/"+tt.path, func(t *testing.T) {
+			m := NewMetadata().
+				WithSort("priority").
+				WithSortDirection("desc").
+				WithJSONSortField("priority", "data", tt.path)
+			if got := m.GetSortClauseFor(tt.dialect); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// Unsafe paths are rejected and never emitted
+	m := NewMetadata().WithSort("priority").WithJSONSortField("priority", "data", "x'); DROP TABLE t; --")
+	if validation := m.Validate(); validation.IsValid || validation.Errors[0].Code != "INVALID_JSON_SORT_FIELD" {
+		t.Errorf("expected INVALID_JSON_SORT_FIELD, got %v", validation.Errors)
+	}
+	if got := m.GetSortClauseFor(PostgreSQL); got != "priority asc" {
+		t.Errorf("expected raw field, got %q", got)
+	}
+}
+
+func TestJSONSortFieldSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("CREATE TABLE tasks (id INTEGER PRIMARY KEY, data TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for _, priority := range []int{3, 1, 2} {
+		if _, err = db.Exec("INSERT INTO tasks (data) VALUES (?)", fmt.Sprintf(`{"priority": %d}`, priority)); err != nil {
+			t.Fatalf("failed to insert data: %v", err)
+		}
+	}
+
+	m := NewMetadata().WithSort("priority").WithJSONSortField("priority", "data", "priority")
+	rows, err := QueryContextPaginate(context.Background(), db, SQLite, "SELECT id FROM tasks", m)
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("failed to scan row: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if fmt.Sprint(ids) != "[2 3 1]" {
+		t.Errorf("expected ids ordered by priority [2 3 1], got %v", ids)
+	}
+}
+
+func TestCockroachDBFollowerReads(t *testing.T) {
+	m := NewMetadata().
+		WithCursorField("id").
+		WithPageSize(10).
+		WithFollowerReads(5 * time.Second)
+	query, args, err := m.BuildSQL(CockroachDB, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "SELECT * FROM users AS OF SYSTEM TIME '-5s' ORDER BY id asc LIMIT $1"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+	if fmt.Sprint(args) != "[10]" {
+		t.Errorf("expected args [10], got %v", args)
+	}
+
+	// The clause goes before the base query's own WHERE clause
+	m = NewMetadata().WithPageSize(10).WithSort("id").WithFollowerReads(5 * time.Second)
+	query, _, err = m.BuildSQL(CockroachDB, "SELECT * FROM users WHERE age > $1", 18)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "SELECT * FROM users AS OF SYSTEM TIME '-5s' WHERE age > $1 ORDER BY id asc LIMIT $2 OFFSET $3"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+
+	// Parentheses and keywords inside literals and quoted identifiers are not clauses
+	m = NewMetadata().WithPageSize(10).WithSort("id").WithFollowerReads(5 * time.Second)
+	query, _, err = m.BuildSQL(CockroachDB, `SELECT id, ':-(' AS face, " where" FROM users`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = `SELECT id, ':-(' AS face, " where" FROM users AS OF SYSTEM TIME '-5s' ORDER BY id asc LIMIT $1 OFFSET $2`
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+	query, _, err = m.BuildSQL(CockroachDB, "SELECT id, 'it''s (' AS note FROM users WHERE age > $1", 18)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "SELECT id, 'it''s (' AS note FROM users AS OF SYSTEM TIME '-5s' WHERE age > $1 ORDER BY id asc LIMIT $2 OFFSET $3"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+
+	// Cursor pages wrap a base query with its own WHERE and keep the clause on the outer statement
+	m = NewMetadata().WithPageSize(10).WithCursorField("id").WithCursor(encodeCursor(40)).WithFollowerReads(5 * time.Second)
+	query, args, err = m.BuildSQL(CockroachDB, "SELECT * FROM users WHERE age > $1", 18)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "SELECT * FROM (SELECT * FROM users WHERE age > $1) AS _sub AS OF SYSTEM TIME '-5s' WHERE id > $2 ORDER BY id asc LIMIT $3"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+	if fmt.Sprint(args) != "[18 40 10]" {
+		t.Errorf("expected args [18 40 10], got %v", args)
+	}
+
+	// Backward pages keep it on the outer query restoring the forward order
+	m = NewMetadata().WithPageSize(10).WithCursorField("id").WithBefore(encodeCursor(40)).WithFollowerReads(5 * time.Second)
+	query, _, err = m.BuildSQL(CockroachDB, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "SELECT * FROM (SELECT * FROM users WHERE id < $1 ORDER BY id desc LIMIT $2) AS _page AS OF SYSTEM TIME '-5s' ORDER BY id asc"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+
+	// Other dialects ignore follower reads
+	query, _, err = m.BuildSQL(PostgreSQL, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(query, "AS OF SYSTEM TIME") {
+		t.Errorf("expected no AS OF SYSTEM TIME clause, got %q", query)
+	}
+}
+
+func TestPreparedStatement(t *testing.T) {
+	var templates []string
+	for _, page := range []int{1, 3} {
+		m := NewMetadata().WithPage(page).WithPageSize(20).WithSort("id")
+		stmtSQL, argOrder := m.PreparedStatement(PostgreSQL, "SELECT * FROM users")
+		templates = append(templates, stmtSQL)
+		if fmt.Sprint(argOrder) != "[limit offset]" {
+			t.Errorf("expected arg order [limit offset], got %v", argOrder)
+		}
+	}
+
+	expected := "SELECT * FROM users ORDER BY id asc LIMIT $1 OFFSET $2"
+	for _, stmtSQL := range templates {
+		if stmtSQL != expected {
+			t.Errorf("expected %q, got %q", expected, stmtSQL)
+		}
+	}
+
+	m := NewMetadata().
+		WithPageSize(20).
+		WithCursorField("id").
+		WithCursor(encodeCursor(40)).
+		WithFilter("age", FilterBetween, []int{18, 30})
+	stmtSQL, argOrder := m.PreparedStatement(PostgreSQL, "SELECT * FROM users")
+	expected = "SELECT * FROM users WHERE age BETWEEN $1 AND $2 AND id > $3 ORDER BY id asc LIMIT $4"
+	if stmtSQL != expected {
+		t.Errorf("expected %q, got %q", expected, stmtSQL)
+	}
+	if fmt.Sprint(argOrder) != "[filter:age filter:age cursor limit]" {
+		t.Errorf("expected arg order [filter:age filter:age cursor limit], got %v", argOrder)
+	}
+
+	// Boolean and null filters render literals and bind nothing
+	m = NewMetadata().
+		WithPageSize(20).
+		WithFilter("active", FilterEq, true).
+		WithFilter("deleted_at", FilterEq, nil).
+		WithFilter("age", FilterGt, 3)
+	stmtSQL, argOrder = m.PreparedStatement(PostgreSQL, "SELECT * FROM users")
+	expected = "SELECT * FROM users WHERE active = TRUE AND deleted_at IS NULL AND age > $1 LIMIT $2 OFFSET $3"
+	if stmtSQL != expected {
+		t.Errorf("expected %q, got %q", expected, stmtSQL)
+	}
+	if fmt.Sprint(argOrder) != "[filter:age limit offset]" {
+		t.Errorf("expected arg order [filter:age limit offset], got %v", argOrder)
+	}
+}
+
+func TestCountContextStrategies(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, age INTEGER)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for i := 1; i <= 25; i++ {
+		if _, err := db.Exec("INSERT INTO users (age) VALUES (?)", 20+i%5); err != nil {
+			t.Fatalf("failed to insert row: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		strategy CountStrategy
+		query    string
+		filter   bool
+		expected int64
+	}{
+		{"exact", CountExact, "SELECT * FROM users", false, 25},
+		{"exact filtered", CountExact, "SELECT * FROM users", true, 10},
+		{"exact grouped", CountExact, "SELECT age FROM users GROUP BY age", false, 5},
+		{"approx falls back to exact", CountApprox, "SELECT * FROM users", false, 25},
+		{"none", CountNone, "SELECT * FROM users", false, 0},
+	}
+
+	for _, test := range tests {
+		m := NewMetadata().WithPageSize(10).WithCountStrategy(test.strategy)
+		if test.filter {
+			m.WithFilter("age", FilterGte, 23)
+		}
+
+		total, err := CountContext(context.Background(), db, SQLite, test.query, m)
+		if err != nil {
+			t.Fatalf("%s: failed to count: %v", test.name, err)
+		}
+		if total != test.expected || m.TotalRows != test.expected {
+			t.Errorf("%s: expected total %d, got %d (TotalRows %d)", test.name, test.expected, total, m.TotalRows)
+		}
+	}
+
+	// Window counts need the data query's rows, which the caller scans, so they are rejected
+	m := NewMetadata().WithPageSize(10).WithCountStrategy(CountWindow)
+	_, err = CountContext(context.Background(), db, SQLite, "SELECT * FROM users", m)
+	var invalid *InvalidMetadataError
+	if !errors.As(err, &invalid) || invalid.Errors[0].Code != "UNSUPPORTED_COUNT_MODE" {
+		t.Errorf("expected UNSUPPORTED_COUNT_MODE, got %v", err)
+	}
+	if total, err := CountContext(context.Background(), db, SQLite, "SELECT * FROM users", m.WithKnownTotal(25)); err != nil || total != 25 {
+		t.Errorf("expected the known total 25, got %d (%v)", total, err)
+	}
+
+	m = NewMetadata().WithPageSize(10)
+	if _, err := CountContext(context.Background(), db, SQLite, "SELECT * FROM users", m); err != nil {
+		t.Fatalf("failed to count: %v", err)
+	}
+	rows, err := QueryContextPaginate(context.Background(), db, SQLite, "SELECT * FROM users", m)
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	rows.Close()
+	if m.TotalPages != 3 || !m.HasNext {
+		t.Errorf("unexpected metadata: pages=%d hasNext=%v", m.TotalPages, m.HasNext)
+	}
+}
+
+func TestQueryContextPaginateCanceled(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		m    *Metadata
+	}{
+		{"offset", NewMetadata().WithSort("id")},
+		{"cursor", NewMetadata().WithCursorField("id").WithCursor(encodeCursor(5))},
+		// A malformed cursor must not mask the canceled context
+		{"invalid cursor", NewMetadata().WithCursorField("id").WithCursor("%%%")},
+	}
+
+	for _, test := range tests {
+		rows, err := QueryContextPaginate(ctx, db, SQLite, "SELECT 1 AS id", test.m)
+		if rows != nil {
+			rows.Close()
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", test.name, err)
+		}
+	}
+
+	if _, err := CountContext(ctx, db, SQLite, "SELECT 1 AS id", NewMetadata()); !errors.Is(err, context.Canceled) {
+		t.Errorf("count: expected context.Canceled, got %v", err)
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		dialect  Dialect
+		ident    string
+		expected string
+	}{
+		{MySQL, "name", "`name`"},
+		{PostgreSQL, "name", `"name"`},
+		{SQLite, "name", `"name"`},
+		{CockroachDB, "name", `"name"`},
+		{MySQL, "users.name", "`users`.`name`"},
+		{PostgreSQL, "public.users.name", `"public"."users"."name"`},
+		{MySQL, "odd`name", "`odd``name`"},
+		{PostgreSQL, `odd"name`, `"odd""name"`},
+		{MySQL, `odd"name`, "`odd\"name`"},
+		{PostgreSQL, "users.*", `"users".*`},
+		{SQLite, `x"; DROP TABLE users; --`, `"x""; DROP TABLE users; --"`},
+		{SQLServer, "name", "[name]"},
+		{SQLServer, "dbo.users.name", "[dbo].[users].[name]"},
+		{SQLServer, "odd]name", "[odd]]name]"},
+		{SQLServer, "odd[name", "[odd[name]"},
+		{SQLServer, "users.*", "[users].*"},
+	}
+
+	for _, test := range tests {
+		if got := QuoteIdentifier(test.dialect, test.ident); got != test.expected {
+			t.Errorf("QuoteIdentifier(%v, %q) = %s, expected %s", test.dialect, test.ident, got, test.expected)
+		}
+	}
+}
+
+func TestQuoteIdentifierSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	column := QuoteIdentifier(SQLite, `odd"column`)
+	if _, err := db.Exec(fmt.Sprintf("CREATE TABLE items (%s INTEGER)", column)); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("INSERT INTO items (%s) VALUES (7)", column)); err != nil {
+		t.Fatalf("failed to insert row: %v", err)
+	}
+
+	var value int
+	query := fmt.Sprintf("SELECT %s FROM items", QuoteIdentifier(SQLite, `items.odd"column`))
+	if err := db.QueryRow(query).Scan(&value); err != nil || value != 7 {
+		t.Errorf("expected 7, got %d (%v)", value, err)
+	}
+}
+
+func TestCountContextExpression(t *testing.T) {
+	m := NewMetadata().WithCountExpression("COUNT(email)")
+	query, _, err := buildCountQuery("SELECT * FROM users", m, SQLite, nil)
+	if err != nil {
+		t.Fatalf("failed to build count query: %v", err)
+	}
+	if expected := "SELECT COUNT(email) FROM (SELECT * FROM users) AS count_rows"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO users (email) VALUES ('a@example.com'), (NULL), ('b@example.com')"); err != nil {
+		t.Fatalf("failed to insert rows: %v", err)
+	}
+
+	// COUNT(column) skips NULL values
+	total, err := CountContext(context.Background(), db, SQLite, "SELECT * FROM users", m)
+	if err != nil {
+		t.Fatalf("failed to count: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("expected 2 rows with an email, got %d", total)
+	}
+}
+
+func TestDB2Dialect(t *testing.T) {
+	m := NewMetadata().WithPage(3).WithPageSize(25).WithSort("id")
+	query, args, err := m.BuildSQL(DB2, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	if expected := "SELECT * FROM users ORDER BY id asc OFFSET ? ROWS FETCH FIRST ? ROWS ONLY"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+	if len(args) != 2 || args[0] != 50 || args[1] != 25 {
+		t.Errorf("expected offset and limit args [50 25], got %v", args)
+	}
+	if _, argOrder := m.PreparedStatement(DB2, "SELECT * FROM users"); strings.Join(argOrder, ",") != "offset,limit" {
+		t.Errorf("expected offset,limit arg order, got %v", argOrder)
+	}
+
+	cursor := NewMetadata().WithPageSize(25).WithCursorField("id").WithCursor(encodeCursor(100))
+	query, args, err = cursor.BuildSQL(DB2, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("failed to build cursor query: %v", err)
+	}
+	if expected := "SELECT * FROM users WHERE id > ? ORDER BY id asc FETCH FIRST ? ROWS ONLY"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+	if len(args) != 2 || args[0] != int64(100) || args[1] != 25 {
+		t.Errorf("expected cursor and limit args, got %v", args)
+	}
+
+	// DB2 requires an ORDER BY
+	_, _, err = NewMetadata().BuildSQL(DB2, "SELECT * FROM users")
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("expected a validation error without sort, got %v", err)
+	}
+
+	optimized := NewQueryOptimizer().WithMaxRows(500).OptimizeQuery("SELECT * FROM users", DB2)
+	if expected := "SELECT * FROM users FETCH FIRST 500 ROWS ONLY"; optimized != expected {
+		t.Errorf("expected %s, got %s", expected, optimized)
+	}
+
+	if dialect, ok := dialectFromName("go_ibm_db"); !ok || dialect != DB2 || dialect.String() != "db2" {
+		t.Errorf("expected the go_ibm_db driver to map to DB2, got %v", dialect)
+	}
+}
+
+func TestSQLServerDialect(t *testing.T) {
+	m := NewMetadata().WithPage(3).WithPageSize(25).WithSort("id").WithFilter("age", FilterGt, 18)
+	query, args, err := m.BuildSQL(SQLServer, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	if expected := "SELECT * FROM users WHERE age > @p1 ORDER BY id asc OFFSET @p2 ROWS FETCH NEXT @p3 ROWS ONLY"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+	if !reflect.DeepEqual(args, []any{18, 50, 25}) {
+		t.Errorf("expected args [18 50 25], got %v", args)
+	}
+	if _, argOrder := m.PreparedStatement(SQLServer, "SELECT * FROM users"); strings.Join(argOrder, ",") != "filter:age,offset,limit" {
+		t.Errorf("expected filter:age,offset,limit arg order, got %v", argOrder)
+	}
+
+	cursor := NewMetadata().WithPageSize(25).WithCursorField("id").WithCursor(encodeCursor(100))
+	query, _, err = cursor.BuildSQL(SQLServer, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("failed to build cursor query: %v", err)
+	}
+	if expected := "SELECT * FROM users WHERE id > @p1 ORDER BY id asc OFFSET 0 ROWS FETCH NEXT @p2 ROWS ONLY"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+
+	// SQL Server requires an ORDER BY
+	if _, _, err = NewMetadata().BuildSQL(SQLServer, "SELECT * FROM users"); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected a validation error without sort, got %v", err)
+	}
+
+	if dialect, ok := dialectFromName("sqlserver"); !ok || dialect != SQLServer || dialect.String() != "sqlserver" {
+		t.Errorf("expected the sqlserver driver to map to SQLServer, got %v", dialect)
+	}
+}
+
+func TestQueryTag(t *testing.T) {
+	optimizer := NewQueryOptimizer().WithIndexHint(false).WithMaxRows(0).WithQueryTag("service:orders endpoint:list")
+	query := optimizer.OptimizeQuery("SELECT * FROM orders", PostgreSQL)
+	if expected := "/* service:orders endpoint:list */ SELECT * FROM orders"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+
+	// A tag cannot close the comment
+	query = optimizer.WithQueryTag("x */ DROP TABLE orders; -- **//").OptimizeQuery("SELECT * FROM orders", PostgreSQL)
+	if expected := "/* x  DROP TABLE orders; -- */ SELECT * FROM orders"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+	if strings.Count(query, "*/") != 1 {
+		t.Errorf("expected a single comment terminator, got %s", query)
+	}
+
+	// Empty tags add no comment
+	query = optimizer.WithQueryTag(" /**/ ").OptimizeQuery("SELECT * FROM orders", PostgreSQL)
+	if query != "SELECT * FROM orders" {
+		t.Errorf("expected no comment, got %s", query)
+	}
+}
+
+func TestQueryContextPaginateTx(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Rows written in the transaction are visible to its pages
+	if _, err := tx.ExecContext(ctx, "CREATE TABLE items (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for i := 1; i <= 12; i++ {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO items (id) VALUES (?)", i); err != nil {
+			t.Fatalf("failed to insert row: %v", err)
+		}
+	}
+
+	m := NewMetadata().WithPage(2).WithPageSize(5).WithSort("id")
+	total, err := CountContext(ctx, tx, SQLite, "SELECT id FROM items", m)
+	if err != nil {
+		t.Fatalf("failed to count rows: %v", err)
+	}
+	if total != 12 {
+		t.Errorf("expected 12 rows, got %d", total)
+	}
+
+	rows, err := QueryContextPaginate(ctx, tx, SQLite, "SELECT id FROM items", m)
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("failed to scan row: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if len(ids) != 5 || ids[0] != 6 || ids[4] != 10 {
+		t.Errorf("expected ids 6-10, got %v", ids)
+	}
+	if m.TotalPages != 3 {
+		t.Errorf("expected 3 total pages, got %d", m.TotalPages)
+	}
+}
+
+func TestIndexHintWarning(t *testing.T) {
+	optimizer := NewQueryOptimizer()
+
+	warning := optimizer.IndexHintWarning(NewMetadata().WithSort("name"))
+	if expected := "index hint idx_created_at covers created_at, but the query is ordered by name"; warning != expected {
+		t.Errorf("expected %q, got %q", expected, warning)
+	}
+
+	for _, m := range []*Metadata{
+		NewMetadata().WithSort("created_at"),
+		NewMetadata().WithSort("users.created_at"),
+		NewMetadata().WithSortFields([]SortField{{Field: "created_at"}, {Field: "id"}}),
+		NewMetadata().WithCursorField("created_at").WithSort("name"),
+		NewMetadata(),
+	} {
+		if warning := optimizer.IndexHintWarning(m); warning != "" {
+			t.Errorf("expected no warning for sort %q, got %q", m.Sort, warning)
+		}
+	}
+
+	if warning := optimizer.WithIndexHint(false).IndexHintWarning(NewMetadata().WithSort("name")); warning != "" {
+		t.Errorf("expected no warning without index hints, got %q", warning)
+	}
+}
+
+func TestCountContextDebugInfo(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, status TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	ctx := context.Background()
+	m := NewMetadata().WithSort("id").WithDebug(true).WithFilter("status", FilterEq, "active")
+	if _, err := CountContext(ctx, db, SQLite, "SELECT id FROM items", m); err != nil {
+		t.Fatalf("failed to count rows: %v", err)
+	}
+	rows, err := QueryContextPaginate(ctx, db, SQLite, "SELECT id FROM items", m)
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	rows.Close()
+
+	if m.DebugInfo == nil {
+		t.Fatal("expected debug info")
+	}
+	if expected := "SELECT COUNT(*) FROM (SELECT id FROM items WHERE status = ?) AS count_rows"; m.DebugInfo.CountSQL != expected {
+		t.Errorf("expected count SQL %q, got %q", expected, m.DebugInfo.CountSQL)
+	}
+	if !strings.Contains(m.DebugInfo.SQL, "LIMIT") {
+		t.Errorf("expected the data query, got %q", m.DebugInfo.SQL)
+	}
+}
+
+func TestRegisterDialect(t *testing.T) {
+	var gotIndex int
+	commaLimit := RegisterDialect("comma_limit", func(query string, limit, offset int, argIndex int) (string, []any) {
+		gotIndex = argIndex
+		return query + " LIMIT ?, ?", []any{offset, limit}
+	})
+	if commaLimit.String() != "comma_limit" {
+		t.Errorf("expected the registered name, got %s", commaLimit)
+	}
+	if dialect, ok := dialectFromName("comma_limit"); !ok || dialect != commaLimit {
+		t.Errorf("expected the name to map to the registered dialect, got %v", dialect)
+	}
+	if again := RegisterDialect("comma_limit", func(query string, limit, offset int, argIndex int) (string, []any) {
+		gotIndex = argIndex
+		return query + " LIMIT ?, ?", []any{offset, limit}
+	}); again != commaLimit {
+		t.Errorf("expected re-registering to return the same dialect, got %v", again)
+	}
+
+	m := NewMetadata().WithPage(2).WithPageSize(3).WithSort("id").WithFilter("id", FilterGt, 1)
+	query, args, err := m.BuildSQL(commaLimit, "SELECT id FROM items")
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	if expected := "SELECT id FROM items WHERE id > ? ORDER BY id asc LIMIT ?, ?"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+	if len(args) != 3 || args[1] != 3 || args[2] != 3 || gotIndex != 2 {
+		t.Errorf("unexpected args %v or arg index %d", args, gotIndex)
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for i := 1; i <= 10; i++ {
+		if _, err := db.Exec("INSERT INTO items (id) VALUES (?)", i); err != nil {
+			t.Fatalf("failed to insert row: %v", err)
+		}
+	}
+
+	rows, err := QueryContextPaginate(context.Background(), db, commaLimit, "SELECT id FROM items", m)
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("failed to scan row: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) != 3 || ids[0] != 5 || ids[2] != 7 {
+		t.Errorf("expected ids 5-7, got %v", ids)
+	}
+
+	// Cursor pages use an offset of 0
+	cursor := NewMetadata().WithPageSize(2).WithCursorField("id").WithCursor(encodeCursor(4))
+	query, args, err = cursor.BuildSQL(commaLimit, "SELECT id FROM items")
+	if err != nil {
+		t.Fatalf("failed to build cursor query: %v", err)
+	}
+	if expected := "SELECT id FROM items WHERE id > ? ORDER BY id asc LIMIT ?, ?"; query != expected || args[1] != 0 || args[2] != 2 {
+		t.Errorf("unexpected cursor query %s with args %v", query, args)
+	}
+
+	if _, err := QueryContextPaginate(context.Background(), db, Dialect(999), "SELECT id FROM items", NewMetadata()); !errors.Is(err, ErrUnsupportedDialect) {
+		t.Errorf("expected unregistered dialects to be rejected, got %v", err)
+	}
+}
+
+func TestSortCoalesce(t *testing.T) {
+	m := NewMetadata().WithSort("name").WithSortCoalesce("name", "")
+	if got := m.GetSortClause(); got != "COALESCE(name,'') asc" {
+		t.Errorf("expected COALESCE(name,'') asc, got %q", got)
+	}
+
+	query, _, err := m.BuildSQL(PostgreSQL, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	if expected := "SELECT * FROM users ORDER BY COALESCE(name,'') asc LIMIT $1 OFFSET $2"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+
+	// Quotes are escaped and combine with collations
+	m = NewMetadata().WithSort("name").WithSortDirection("desc").WithSortCoalesce("name", "o'clock").WithSortCollation("name", "C")
+	if got := m.GetSortClauseFor(PostgreSQL); got != `COALESCE(name,'o''clock') COLLATE "C" desc` {
+		t.Errorf("unexpected sort clause %q", got)
+	}
+
+	// Backslashes could end the literal early on MySQL
+	m = NewMetadata().WithSort("name").WithSortCoalesce("name", `\'); DROP TABLE users; --`)
+	if validation := m.Validate(); validation.IsValid || validation.Errors[0].Code != "INVALID_SORT_COALESCE" {
+		t.Errorf("expected INVALID_SORT_COALESCE, got %v", validation.Errors)
+	}
+	if got := m.GetSortClauseFor(MySQL); got != "name asc" {
+		t.Errorf("expected the raw field, got %q", got)
+	}
+}
+
+func TestCompoundQuery(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for i := 1; i <= 12; i++ {
+		if _, err := db.Exec("INSERT INTO items (id) VALUES (?)", i); err != nil {
+			t.Fatalf("failed to insert row: %v", err)
+		}
+	}
+
+	const cte = "WITH recent AS (SELECT id FROM items WHERE id > 2) SELECT id FROM recent"
+	scan := func(m *Metadata, query string) []int {
+		rows, err := QueryContextPaginate(context.Background(), db, SQLite, query, m)
+		if err != nil {
+			t.Fatalf("failed to execute paginated query: %v", err)
+		}
+		defer rows.Close()
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("failed to scan row: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	// Offset pages wrap the CTE in a subquery
+	m := NewMetadata().WithPage(2).WithPageSize(4).WithSort("id").WithFilter("id", FilterLte, 10)
+	query, _, err := m.BuildSQL(SQLite, cte)
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	if expected := "SELECT * FROM (" + cte + ") AS _sub WHERE id <= ? ORDER BY id asc LIMIT ? OFFSET ?"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+	if ids := scan(m, cte); len(ids) != 4 || ids[0] != 7 || ids[3] != 10 {
+		t.Errorf("expected ids 7-10, got %v", ids)
+	}
+	if total, err := CountContext(context.Background(), db, SQLite, cte, m); err != nil || total != 8 {
+		t.Errorf("expected 8 rows, got %d (%v)", total, err)
+	}
+
+	// Cursor pages too
+	m = NewMetadata().WithPageSize(4).WithCursorField("id").WithCursor(encodeCursor(8))
+	if ids := scan(m, cte); len(ids) != 4 || ids[0] != 9 || ids[3] != 12 {
+		t.Errorf("expected ids 9-12, got %v", ids)
+	}
+
+	// And UNION queries
+	m = NewMetadata().WithPageSize(3).WithSort("id").WithSortDirection("desc")
+	if ids := scan(m, "SELECT id FROM items WHERE id < 3 UNION SELECT id FROM items WHERE id > 10"); len(ids) != 3 || ids[0] != 12 || ids[2] != 2 {
+		t.Errorf("expected ids 12, 11, 2, got %v", ids)
+	}
+
+	// Plain queries are left as they are
+	if query := wrapCompoundQuery("SELECT * FROM unions_log"); query != "SELECT * FROM unions_log" {
+		t.Errorf("unexpected wrapped query %s", query)
+	}
+}
+
+func TestDebugInfoArgs(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, status TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	m := NewMetadata().WithPage(3).WithPageSize(5).WithSort("id").WithDebug(true).WithFilter("status", FilterEq, "active")
+	rows, err := QueryContextPaginate(context.Background(), db, SQLite, "SELECT id FROM items", m)
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	rows.Close()
+
+	expected := []any{"active", 5, 10}
+	if m.DebugInfo == nil || !reflect.DeepEqual(m.DebugInfo.Args, expected) {
+		t.Errorf("expected args %v, got %+v", expected, m.DebugInfo)
+	}
+
+	// Cursor pages bind the cursor value and the limit
+	m = NewMetadata().WithPageSize(5).WithCursorField("id").WithCursor(encodeCursor(7)).WithDebug(true)
+	rows, err = QueryContextPaginate(context.Background(), db, SQLite, "SELECT id FROM items", m)
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	rows.Close()
+
+	expected = []any{int64(7), 5}
+	if !reflect.DeepEqual(m.DebugInfo.Args, expected) {
+		t.Errorf("expected args %v, got %v", expected, m.DebugInfo.Args)
+	}
+}
+
+func TestBaseQueryClauses(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER, active BOOLEAN)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for i := 1; i <= 10; i++ {
+		if _, err := db.Exec("INSERT INTO users (id, name, age, active) VALUES (?, ?, ?, ?)", i, fmt.Sprintf("user %02d", 11-i), 20+i, i%2 == 0); err != nil {
+			t.Fatalf("failed to insert row: %v", err)
+		}
+	}
+
+	scan := func(m *Metadata, query string, args ...any) []int {
+		rows, err := QueryContextPaginate(context.Background(), db, SQLite, query, m, args...)
+		if err != nil {
+			t.Fatalf("failed to execute paginated query: %v", err)
+		}
+		defer rows.Close()
+		columns, _ := rows.Columns()
+		var ids []int
+		for rows.Next() {
+			var id int
+			dest := []any{&id}
+			for range columns[1:] {
+				dest = append(dest, new(any))
+			}
+			if err := rows.Scan(dest...); err != nil {
+				t.Fatalf("failed to scan row: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	// A base query with its own WHERE is wrapped when filters add another condition
+	const where = "SELECT id FROM users WHERE active = ?"
+	m := NewMetadata().WithPageSize(2).WithSort("id").WithFilter("age", FilterGt, 23)
+	query, args, err := m.BuildSQL(SQLite, where, true)
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	if expected := "SELECT * FROM (" + where + ") AS _sub WHERE age > ? ORDER BY id asc LIMIT ? OFFSET ?"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+	if !reflect.DeepEqual(args, []any{true, 23, 2, 0}) {
+		t.Errorf("expected args [true 23 2 0], got %v", args)
+	}
+	if ids := scan(m, "SELECT id, age FROM users WHERE active = ?", true); !reflect.DeepEqual(ids, []int{4, 6}) {
+		t.Errorf("expected ids [4 6], got %v", ids)
+	}
+
+	// Without filters the base WHERE is kept in place
+	query, _, err = NewMetadata().WithPageSize(2).WithSort("id").BuildSQL(SQLite, where, true)
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	if expected := where + " ORDER BY id asc LIMIT ? OFFSET ?"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+
+	// A base query with its own ORDER BY is always wrapped
+	const ordered = "SELECT id, age FROM users ORDER BY name"
+	m = NewMetadata().WithPageSize(3).WithSort("id").WithFilter("age", FilterGt, 25)
+	query, _, err = m.BuildSQL(SQLite, ordered)
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	if expected := "SELECT * FROM (" + ordered + ") AS _sub WHERE age > ? ORDER BY id asc LIMIT ? OFFSET ?"; query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+	}
+	if ids := scan(m, ordered); !reflect.DeepEqual(ids, []int{6, 7, 8}) {
+		t.Errorf("expected ids [6 7 8], got %v", ids)
+	}
+
+	// Cursor pages and counts wrap the same way
+	m = NewMetadata().WithPageSize(2).WithCursorField("id").WithCursor(encodeCursor(4))
+	if ids := scan(m, "SELECT id FROM users WHERE active = ?", true); !reflect.DeepEqual(ids, []int{6, 8}) {
+		t.Errorf("expected ids [6 8], got %v", ids)
+	}
+	total, err := CountContext(context.Background(), db, SQLite, "SELECT id, age FROM users WHERE active = ? ORDER BY name",
+		NewMetadata().WithFilter("age", FilterGt, 25), true)
+	if err != nil {
+		t.Fatalf("failed to count: %v", err)
+	}
+	if total != 3 {
+		t.Errorf("expected 3 rows, got %d", total)
+	}
+}
+
+func TestQueryContextPaginateSortArgsAllowList(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, password TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	if _, err = db.Exec("INSERT INTO users (name, password) VALUES ('a', 'secret')"); err != nil {
+		t.Fatalf("failed to insert data: %v", err)
+	}
+
+	// A sort passed as arguments is checked against the allow-list like one set on the metadata
+	var invalid *InvalidMetadataError
+	for _, cursor := range []bool{false, true} {
+		m := NewMetadata().WithAllowedFields("id", "name")
+		if cursor {
+			m.WithCursorField("id")
+		}
+		_, err = QueryContextPaginate(context.Background(), db, SQLite, "SELECT * FROM users", m, "(SELECT password FROM users LIMIT 1)", "asc")
+		if !errors.As(err, &invalid) {
+			t.Fatalf("expected a validation error (cursor=%v), got %v", cursor, err)
+		}
+	}
+
+	m := NewMetadata().WithAllowedFields("id", "name")
+	rows, err := QueryContextPaginate(context.Background(), db, SQLite, "SELECT * FROM users", m, "name", "desc")
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	rows.Close()
+	if m.Sort != "name" || m.SortDirection != "desc" {
+		t.Errorf("expected the sort from the arguments, got %q %q", m.Sort, m.SortDirection)
+	}
+}
+
+func TestQueryContextPaginateSortArgsRegexRule(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	// "regex:" rules on the sort apply to a sort passed as arguments
+	m := NewMetadata().WithValidationRule("sort", "regex:^[a-z_]+$")
+	_, err = QueryContextPaginate(context.Background(), db, SQLite, "SELECT * FROM users", m, "id; DROP TABLE users", "asc")
+	var invalid *InvalidMetadataError
+	if !errors.As(err, &invalid) || invalid.Errors[0].Code != "REGEX_MISMATCH" {
+		t.Fatalf("expected REGEX_MISMATCH, got %v", err)
+	}
+
+	rows, err := QueryContextPaginate(context.Background(), db, SQLite, "SELECT * FROM users", m, "name", "asc")
+	if err != nil {
+		t.Fatalf("failed to execute paginated query: %v", err)
+	}
+	rows.Close()
+}